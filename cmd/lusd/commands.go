@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"lusd/internal/config"
+	"lusd/internal/logging"
+)
+
+// usage is printed for -h and for invalid command lines
+const usage = `Usage: lusd [flags] [command]
+
+Commands:
+  serve                  run the directory (default)
+  config validate        check the config file, exiting non-zero if invalid
+  config sources         print where each setting comes from
+  config paths           print the config file and state directory in use
+  config print-default   print the default config file
+  version                print version and build information
+
+Flags:
+`
+
+// errInvalidConfig is returned by config validate for a config with
+// problems, and by serve for a config it refuses to start with
+var errInvalidConfig = errors.New("invalid config")
+
+// options are the flags accepted before and after every command
+type options struct {
+	configPath string // config file, searched for if empty
+	stateDir   string // directory of logs, snapshots and admin changes, derived if empty
+	listen     string // HTTP listen address, overrides port
+	logLevel   string // overrides logLevel, also across reloads
+}
+
+// flagSet returns a flag set for name that parses into o
+func (o *options) flagSet(name string, output io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&o.configPath, "config", o.configPath, "path of config.json, searched for in /etc/lusd, the user config directory and next to the executable by default")
+	flags.StringVar(&o.stateDir, "state-dir", o.stateDir, "directory for logs, snapshots and admin changes, derived from the config location by default")
+	flags.StringVar(&o.listen, "listen", o.listen, "HTTP listen address such as :8080, overrides the configured port")
+	flags.StringVar(&o.logLevel, "log-level", o.logLevel, "log level (debug, info, warn, error), overrides logLevel")
+	flags.Usage = func() {
+		fmt.Fprint(output, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseArgs parses the command line into options and the command words.
+// Flags are accepted both before and after the command.
+func parseArgs(args []string, output io.Writer) (options, []string, error) {
+	var o options
+	flags := o.flagSet("lusd", output)
+	if err := flags.Parse(args); err != nil {
+		return o, nil, err
+	}
+
+	var command []string
+	rest := flags.Args()
+	for len(rest) > 0 {
+		// Collect command words up to the next flag, then parse flags again
+		for len(rest) > 0 && (rest[0] == "" || rest[0][0] != '-') {
+			command = append(command, rest[0])
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			break
+		}
+		flags = o.flagSet("lusd", output)
+		if err := flags.Parse(rest); err != nil {
+			return o, nil, err
+		}
+		rest = flags.Args()
+	}
+	if len(command) == 0 {
+		command = []string{"serve"}
+	}
+
+	if o.configPath != "" {
+		o.configPath = filepath.Clean(o.configPath)
+	}
+	if o.stateDir != "" {
+		o.stateDir = filepath.Clean(o.stateDir)
+	}
+	if o.listen != "" {
+		if _, _, err := net.SplitHostPort(o.listen); err != nil {
+			return o, nil, fmt.Errorf("invalid -listen address %q", o.listen)
+		}
+	}
+	if o.logLevel != "" {
+		if _, err := logging.ParseLevel(o.logLevel); err != nil {
+			return o, nil, fmt.Errorf("invalid -log-level: %v", err)
+		}
+	}
+	return o, command, nil
+}
+
+// validateConfig reads the config file with the environment overrides and
+// prints every problem with its field path and value. Unlike serve it does
+// not fall back to defaults, even without strict mode, so a missing or
+// invalid file is an error.
+func validateConfig(configPath string, getenv func(string) string, stdout io.Writer) error {
+	_, problems, err := config.Read(configPath, getenv)
+	if err != nil {
+		fmt.Fprintf(stdout, "%s: %v\n", configPath, err)
+		return errInvalidConfig
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(stdout, "%s: %s\n", configPath, problem)
+	}
+	if len(problems) > 0 {
+		return errInvalidConfig
+	}
+	fmt.Fprintf(stdout, "%s: ok\n", configPath)
+	return nil
+}
+
+// printSources prints every setting with the file, default, environment
+// variable or state file its effective value comes from
+func printSources(l locations, getenv func(string) string, stdout io.Writer) error {
+	cfg, _, err := config.Read(l.configPath, getenv)
+	if err != nil {
+		return err
+	}
+	if err := config.ApplyState(l.statePath(), &cfg); err != nil {
+		return fmt.Errorf("invalid state file %s: %w", l.statePath(), err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	for _, path := range slices.Sorted(maps.Keys(cfg.Sources)) {
+		fmt.Fprintf(w, "%s\t%s\n", path, cfg.Sources[path])
+	}
+	return w.Flush()
+}
+
+// printPaths prints the config file and state directory in use
+func printPaths(l locations, stdout io.Writer) error {
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "config\t%s\n", l.configPath)
+	fmt.Fprintf(w, "state\t%s\n", l.stateDir)
+	return w.Flush()
+}
+
+// splitErrors returns the errors joined into err, or err itself
+func splitErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// printDefaultConfig prints the config file written on first start
+func printDefaultConfig(stdout io.Writer) error {
+	data, err := config.DefaultJSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s\n", data)
+	return err
+}
+
+// printVersion prints the build information set by the build flags
+func printVersion(stdout io.Writer) {
+	fmt.Fprintf(stdout, "lusd %s\nBuild time: %s\nCommit: %s\n", Version, BuildTime, CommitHash)
+}
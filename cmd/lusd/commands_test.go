@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command []string
+		opts    options
+	}{
+		{nil, []string{"serve"}, options{}},
+		{[]string{"--config", "/etc/lusd/config.json", "serve"}, []string{"serve"}, options{configPath: "/etc/lusd/config.json"}},
+		{[]string{"serve", "-listen", ":8080", "--log-level=debug"}, []string{"serve"}, options{listen: ":8080", logLevel: "debug"}},
+		{[]string{"config", "--config", "a/../b.json", "validate"}, []string{"config", "validate"}, options{configPath: "b.json"}},
+		{[]string{"--state-dir", "/var/lib/lusd/", "serve"}, []string{"serve"}, options{stateDir: "/var/lib/lusd"}},
+	}
+	for _, tt := range tests {
+		opts, command, err := parseArgs(tt.args, io.Discard)
+		if err != nil {
+			t.Errorf("parseArgs(%v) failed: %v", tt.args, err)
+			continue
+		}
+		if !slices.Equal(command, tt.command) || opts != tt.opts {
+			t.Errorf("parseArgs(%v) = %+v %v, expected %+v %v", tt.args, opts, command, tt.opts, tt.command)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--bogus"},
+		{"--listen", "8080"},
+		{"--log-level", "verbose"},
+	} {
+		if _, _, err := parseArgs(args, io.Discard); err == nil {
+			t.Errorf("Expected parseArgs(%v) to fail", args)
+		}
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	var out bytes.Buffer
+	a, err := run(context.Background(), []string{"version"}, noEnv, &out)
+	if err != nil || a != nil {
+		t.Fatalf("Expected version to complete without an app, got %v %v", a, err)
+	}
+	for _, expected := range []string{"lusd " + Version, "Build time: " + BuildTime, "Commit: " + CommitHash} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected version output to contain %q, got %q", expected, out.String())
+		}
+	}
+}
+
+func TestRunConfigCommands(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := run(context.Background(), []string{"config", "print-default"}, noEnv, &out); err != nil {
+		t.Fatalf("print-default failed: %v", err)
+	}
+	var printed map[string]any
+	if err := json.Unmarshal(out.Bytes(), &printed); err != nil || printed["port"] != float64(80) {
+		t.Fatalf("Expected the default config as JSON, got %q: %v", out.String(), err)
+	}
+
+	// The printed default validates
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, out.String())
+	out.Reset()
+	if _, err := run(context.Background(), []string{"--config", path, "config", "validate"}, noEnv, &out); err != nil {
+		t.Errorf("Expected the default config to validate, got %v: %s", err, out.String())
+	}
+
+	// Problems are reported instead of falling back to defaults
+	writeTestConfig(t, path, `{"port": 70000, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "soon", "logFile": "lusd.log"}`)
+	out.Reset()
+	_, err := run(context.Background(), []string{"config", "validate", "--config", path}, noEnv, &out)
+	if !errors.Is(err, errInvalidConfig) || strings.Count(out.String(), "\n") != 2 {
+		t.Errorf("Expected two problems, got %v: %s", err, out.String())
+	}
+
+	// Sources name the variable a setting came from
+	out.Reset()
+	env := func(key string) string { return map[string]string{"LUSD_PORT": "8080"}[key] }
+	if _, err := run(context.Background(), []string{"config", "sources", "--config", path}, env, &out); err != nil {
+		t.Fatalf("sources failed: %v", err)
+	}
+	for _, want := range []string{"port", "LUSD_PORT", "allowedUserAgent", "file", "probeEnabled", "default"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the sources, got %s", want, out.String())
+		}
+	}
+
+	// Paths show the config file and the state directory next to it
+	out.Reset()
+	if _, err := run(context.Background(), []string{"config", "paths", "--config", path}, noEnv, &out); err != nil || !strings.Contains(out.String(), path) {
+		t.Errorf("Expected the config path, got %v: %s", err, out.String())
+	}
+
+	// A missing file is an error, it is not created
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	if _, err := run(context.Background(), []string{"config", "validate", "--config", missing}, noEnv, io.Discard); !errors.Is(err, errInvalidConfig) {
+		t.Errorf("Expected a missing file to be invalid, got %v", err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Error("Expected validate not to create the config file")
+	}
+
+	if _, err := run(context.Background(), []string{"config", "bogus"}, noEnv, io.Discard); err == nil {
+		t.Error("Expected unknown command to fail")
+	}
+}
+
+func TestRunServeFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log", "logLevel": "info", "logEnabled": false}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, err := run(ctx, []string{"serve", "--config", path, "--listen", "127.0.0.1:9090", "--log-level", "debug"}, noEnv, io.Discard)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if a.listenAddr != "127.0.0.1:9090" {
+		t.Errorf("Expected the -listen address, got %s", a.listenAddr)
+	}
+	if a.cfg.LogLevel != slog.LevelDebug || !a.logLevelFlag {
+		t.Errorf("Expected the -log-level override, got %v", a.cfg.LogLevel)
+	}
+}
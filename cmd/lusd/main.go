@@ -2,29 +2,47 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
+
+	"lusd/internal/api"
+	"lusd/internal/config"
+	"lusd/internal/events"
+	"lusd/internal/federation"
+	"lusd/internal/history"
+	"lusd/internal/logging"
+	"lusd/internal/logrotate"
+	"lusd/internal/metrics"
+	"lusd/internal/middleware"
+	"lusd/internal/proxyproto"
+	"lusd/internal/ratelimit"
+	"lusd/internal/realip"
+	"lusd/internal/store"
+	"lusd/internal/webhook"
 )
 
 // Security constants
 const (
-	maxConfigFileSize = 1024 * 1024 * 32  // 32MB max config file size
-	maxLogFileSize    = 100 * 1024 * 1024 // 100MB max log file size
-	configFileMode    = 0600              // Owner read/write only
-	logFileMode       = 0644              // Owner read/write, group/others read only
+	logFileMode = 0644 // Owner read/write, group/others read only
+)
+
+// Server constants
+const (
+	rateLimitSweepInterval = time.Minute
+	shutdownTimeout        = 30 * time.Second
 )
 
 // Build information (set by build flags)
@@ -34,657 +52,513 @@ var (
 	CommitHash = "unknown"
 )
 
-type Config struct {
-	Port             int           `json:"port"`
-	AllowedUserAgent string        `json:"allowedUserAgent"`
-	StaleTimeout     time.Duration `json:"staleTimeout"`
-	Blacklist        map[string]bool
-	OfficialServers  []string
-	LogFile          string
-	LogEnabled       bool
+// app is a configured directory. It serves the production routes as an
+// http.Handler, serve runs the listeners around them.
+type app struct {
+	http.Handler
+
+	cfg          config.Config // config at startup
+	listenAddr   string        // HTTP listen address
+	logLevelFlag bool          // log level set on the command line, kept across reloads
+	locations    locations
+	getenv       func(string) string
+	snapshotPath string
+	servers      *store.ServerList
+	metrics      *metrics.Metrics
+	limiter      *ratelimit.Limiter
+	events       *events.Bus
+	webhooks     *webhook.Dispatcher
+	history      *history.Recorder // nil unless enabled
+	logFile      *logrotate.Writer
 }
 
-// jsonConfig represents the structure of the config.json file
-type jsonConfig struct {
-	Port             int      `json:"port"`
-	AllowedUserAgent string   `json:"allowedUserAgent"`
-	StaleTimeout     string   `json:"staleTimeout"`
-	Blacklist        []string `json:"blacklist"`
-	OfficialServers  []string `json:"officialServers"`
-	LogFile          string   `json:"logFile"`
-	LogEnabled       bool     `json:"logEnabled"`
+// fatal logs msg at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
-type ServerList struct {
-	sync.Mutex
-	Entries map[string]int64
-	Config  Config
-}
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-func NewServerList(cfg Config) *ServerList {
-	s := &ServerList{
-		Entries: make(map[string]int64),
-		Config:  cfg,
+	a, err := run(ctx, os.Args[1:], os.Getenv, os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	go s.cleanupLoop()
-	return s
-}
-
-func (s *ServerList) Report(ip string, port int) {
-	addr := fmt.Sprintf("%s:%d", ip, port)
-	s.Lock()
-	defer s.Unlock()
-	s.Entries[addr] = time.Now().Unix()
-}
-
-func (s *ServerList) GetActive() []string {
-	cutoff := time.Now().Add(-s.Config.StaleTimeout).Unix()
-	s.Lock()
-	defer s.Unlock()
-
-	// Use a map to avoid duplicates
-	activeMap := make(map[string]bool)
-
-	// Add all non-stale servers from reported entries
-	for addr, ts := range s.Entries {
-		if ts >= cutoff {
-			activeMap[addr] = true
-		}
-	}
-	// Add all official servers
-	for _, addr := range s.Config.OfficialServers {
-		activeMap[addr] = true
+	if err != nil {
+		fatal("Failed to start", "error", err)
 	}
-
-	// Convert to sorted slice
-	var list []string
-	for addr := range activeMap {
-		list = append(list, addr)
+	if a == nil {
+		// The command ran to completion
+		return
 	}
-	sort.Strings(list)
-	return list
-}
-
-func (s *ServerList) cleanupLoop() {
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		cutoff := time.Now().Add(-s.Config.StaleTimeout).Unix()
-		s.Lock()
-		for addr, ts := range s.Entries {
-			if ts < cutoff {
-				log.Printf("Removing stale server: %s (last seen at %d)", addr, ts)
-				delete(s.Entries, addr)
-			}
-		}
-		s.Unlock()
+	if err := a.serve(ctx); err != nil {
+		os.Exit(1)
 	}
 }
 
-// loadConfig attempts to load configuration from a JSON file.
-// Falls back to default configuration if file not found or invalid.
-func loadConfig(configPath string) Config { // Default configuration
-	defaultCfg := Config{
-		Port:             80,
-		AllowedUserAgent: "LU-Server/0.1",
-		StaleTimeout:     10 * time.Minute,
-		Blacklist:        map[string]bool{},
-		OfficialServers:  []string{},
-		LogFile:          "lusd_server.log",
-		LogEnabled:       true,
-	}
-
-	// Validate config path
-	configPath = filepath.Clean(configPath)
-	if strings.Contains(configPath, "..") {
-		log.Printf("Invalid config path detected, using defaults")
-		return defaultCfg
-	}
-
-	// Check if config file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Printf("Config file not found, creating default config")
-
-		// Create default JSON config
-		defaultJsonCfg := jsonConfig{
-			Port:             defaultCfg.Port,
-			AllowedUserAgent: defaultCfg.AllowedUserAgent,
-			StaleTimeout:     "10m",
-			LogFile:          defaultCfg.LogFile,
-			LogEnabled:       defaultCfg.LogEnabled,
-		}
-
-		// Convert blacklist map to slice
-		for ip := range defaultCfg.Blacklist {
-			defaultJsonCfg.Blacklist = append(defaultJsonCfg.Blacklist, ip)
-		}
-
-		// Convert to JSON with indentation
-		jsonData, err := json.MarshalIndent(defaultJsonCfg, "", "  ")
-		if err != nil {
-			log.Printf("Error creating default config, using defaults")
-			return defaultCfg
-		}
-
-		// Write to file with secure permissions
-		if err := secureWriteFile(configPath, jsonData, configFileMode); err != nil {
-			log.Printf("Error writing default config, using defaults")
-		} else {
-			log.Printf("Created default config")
-		}
-
-		return defaultCfg
-	}
-
-	// Read the config file with security checks
-	data, err := secureReadFile(configPath, maxConfigFileSize)
+// run executes the command line args with the environment read through
+// getenv, writing output and logs to stdout. For serve it builds the
+// directory and returns it without opening a listener, so tests and
+// embedders can drive the production routes directly; background work
+// stops when ctx is done. Other commands run to completion and return a nil
+// app.
+func run(ctx context.Context, args []string, getenv func(string) string, stdout io.Writer) (*app, error) {
+	opts, command, err := parseArgs(args, stdout)
 	if err != nil {
-		log.Printf("Error reading config file, using defaults")
-		return defaultCfg
-	}
-	// Parse the JSON
-	var jsonCfg jsonConfig
-	if err := json.Unmarshal(data, &jsonCfg); err != nil {
-		log.Printf("Error parsing config file, using defaults")
-		return defaultCfg
-	}
-	// Convert JSON config to internal config
-	cfg := Config{
-		Port:             jsonCfg.Port,
-		AllowedUserAgent: jsonCfg.AllowedUserAgent,
-		Blacklist:        make(map[string]bool),
-		OfficialServers:  jsonCfg.OfficialServers,
-		LogFile:          jsonCfg.LogFile,
-		LogEnabled:       jsonCfg.LogEnabled,
-	}
-
-	// Parse stale timeout
-	if duration, err := time.ParseDuration(jsonCfg.StaleTimeout); err != nil {
-		log.Printf("Invalid staleTimeout format, using default")
-		cfg.StaleTimeout = defaultCfg.StaleTimeout
-	} else {
-		cfg.StaleTimeout = duration
+		return nil, err
 	}
 
-	// Parse blacklist with validation
-	for _, ip := range jsonCfg.Blacklist {
-		ip = strings.TrimSpace(ip)
-		if ip == "" {
-			continue
-		}
-		// Validate IP address format
-		if net.ParseIP(ip) == nil {
-			log.Printf("Skipping invalid IP in blacklist: %s", ip)
-			continue
-		}
-		cfg.Blacklist[ip] = true
+	// Find the config file and state directory with secure path validation
+	execPath, err := os.Executable()
+	if err != nil {
+		slog.Warn("Could not determine executable path, using current directory")
+		execPath = "."
 	}
+	l, err := resolveLocations(opts, getenv, execPath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.Join(command, " ") {
+	case "serve":
+		return newApp(ctx, opts, l, getenv, stdout)
+	case "config validate":
+		return nil, validateConfig(l.configPath, getenv, stdout)
+	case "config sources":
+		return nil, printSources(l, getenv, stdout)
+	case "config paths":
+		return nil, printPaths(l, stdout)
+	case "config print-default":
+		return nil, printDefaultConfig(stdout)
+	case "version":
+		printVersion(stdout)
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown command %q, see lusd -h", strings.Join(command, " "))
+}
 
-	// Clean up official servers list - remove empty entries and validate IPs
-	var validOfficialServers []string
-	for _, addr := range jsonCfg.OfficialServers {
-		addr = strings.TrimSpace(addr)
-		if addr == "" {
-			continue
-		}
-
-		// Check if it's a valid IP address
-		host, _, err := net.SplitHostPort(addr)
-		if err != nil {
-			host = addr // If not in host:port format, use the whole string
-		}
+// newApp builds the directory from the config file and state directory at
+// l and the command line options
+func newApp(ctx context.Context, opts options, l locations, getenv func(string) string, stdout io.Writer) (*app, error) {
+	// Record start time for uptime calculation
+	startTime := time.Now()
 
-		if net.ParseIP(host) == nil {
-			log.Printf("Skipping official server: not a valid IP")
-			continue
+	// Load configuration, refusing to start on a strict config with problems
+	cfg, err := config.Load(l.configPath, getenv)
+	if err != nil {
+		for _, problem := range splitErrors(err) {
+			slog.Error("Invalid config", "path", l.configPath, "problem", problem)
 		}
-
-		validOfficialServers = append(validOfficialServers, addr)
+		return nil, errInvalidConfig
 	}
-	cfg.OfficialServers = validOfficialServers
-
-	// Validate port
-	if cfg.Port < 1 || cfg.Port > 65535 {
-		log.Printf("Invalid port number, using default")
-		cfg.Port = defaultCfg.Port
+	if err := config.ApplyState(l.statePath(), &cfg); err != nil {
+		slog.Error("Error loading admin state, using the config file", "path", l.statePath(), "error", err)
 	}
-
-	// Validate allowed user agent
-	if cfg.AllowedUserAgent == "" {
-		log.Printf("Empty allowedUserAgent, using default")
-		cfg.AllowedUserAgent = defaultCfg.AllowedUserAgent
+	if _, err := os.Stat(l.statePath()); err == nil && !cfg.AdminPersist {
+		slog.Warn("Ignoring saved admin changes, adminPersist is off", "path", l.statePath())
 	}
-
-	// Validate log file
-	if cfg.LogFile == "" {
-		log.Printf("Empty logFile, using default")
-		cfg.LogFile = defaultCfg.LogFile
+	if err := os.MkdirAll(l.stateDir, stateDirMode); err != nil {
+		slog.Error("Error creating state directory", "path", l.stateDir, "error", err)
 	}
-	log.Printf("Successfully loaded config")
-	// Override with environment variables if present (with validation)
-	if port := os.Getenv("LUSD_PORT"); port != "" {
-		if p, err := strconv.Atoi(port); err == nil && p > 0 && p <= 65535 {
-			cfg.Port = p
-			log.Printf("Port overridden by environment variable")
-		} else {
-			log.Printf("Invalid LUSD_PORT environment variable, ignoring")
-		}
+	if opts.logLevel != "" {
+		cfg.LogLevel, _ = logging.ParseLevel(opts.logLevel)
 	}
-
-	if userAgent := os.Getenv("LUSD_USER_AGENT"); userAgent != "" {
-		// Validate user agent string (basic validation)
-		if len(userAgent) > 0 && len(userAgent) <= 100 {
-			cfg.AllowedUserAgent = userAgent
-			log.Printf("User agent overridden by environment variable")
-		} else {
-			log.Printf("Invalid LUSD_USER_AGENT environment variable, ignoring")
-		}
+	listenAddr := opts.listen
+	if listenAddr == "" {
+		listenAddr = fmt.Sprintf(":%d", cfg.Port)
 	}
 
-	if timeout := os.Getenv("LUSD_STALE_TIMEOUT"); timeout != "" {
-		if duration, err := time.ParseDuration(timeout); err == nil && duration > 0 {
-			cfg.StaleTimeout = duration
-			log.Printf("Stale timeout overridden by environment variable")
+	// Setup structured logging, to file as well if enabled with security checks
+	logging.Level.Set(cfg.LogLevel)
+	logOutput := stdout
+	var logFile *logrotate.Writer
+	if cfg.LogEnabled && cfg.LogFile != "" {
+		logFilePath, err := validateLogPath(cfg.LogFile, l.stateDir)
+		if err != nil {
+			slog.Error("Error validating log file path, continuing with console logging only", "error", err)
 		} else {
-			log.Printf("Invalid LUSD_STALE_TIMEOUT environment variable, ignoring")
+			logFile, err = logrotate.New(logFilePath, logrotate.Options{
+				MaxSize:    cfg.LogMaxSize,
+				Daily:      cfg.LogRotateDaily,
+				MaxBackups: cfg.LogMaxBackups,
+				Compress:   cfg.LogCompress,
+				FileMode:   logFileMode,
+			})
+			if err != nil {
+				slog.Error("Error opening log file, continuing with console logging only", "error", err)
+			} else {
+				logOutput = io.MultiWriter(stdout, logFile)
+			}
 		}
 	}
-
-	if logFile := os.Getenv("LUSD_LOG_FILE"); logFile != "" {
-		// Validate log file path
-		if len(logFile) > 0 && len(logFile) <= 255 && !strings.Contains(logFile, "..") {
-			cfg.LogFile = logFile
-			log.Printf("Log file overridden by environment variable")
-		} else {
-			log.Printf("Invalid LUSD_LOG_FILE environment variable, ignoring")
-		}
+	slog.SetDefault(logging.New(logOutput, cfg.LogFormat))
+	if logFile != nil {
+		slog.Info("Logging to file enabled")
 	}
+	slog.Info("Using config file", "path", l.configPath, "stateDir", l.stateDir)
 
-	if logEnabled := os.Getenv("LUSD_LOG_ENABLED"); logEnabled != "" {
-		if enabled, err := strconv.ParseBool(logEnabled); err == nil {
-			cfg.LogEnabled = enabled
-			log.Printf("Log enabled overridden by environment variable")
+	servers := store.New(cfg)
+	go servers.CleanupLoop(ctx)
+
+	// Restore the previous server list and keep persisting it if enabled
+	var snapshotPath string
+	if cfg.SnapshotEnabled {
+		// Snapshots follow the same placement rules as the log file
+		path, err := validateLogPath(cfg.SnapshotFile, l.stateDir)
+		if err != nil {
+			slog.Error("Error validating snapshot path, snapshots disabled", "error", err)
 		} else {
-			log.Printf("Invalid LUSD_LOG_ENABLED environment variable, ignoring")
+			snapshotPath = path
+			if restored, err := servers.LoadSnapshot(snapshotPath); err != nil {
+				slog.Error("Error loading snapshot, starting with an empty list", "error", err)
+			} else {
+				slog.Info("Restored servers from snapshot", "count", restored)
+			}
+			go servers.SnapshotLoop(ctx, snapshotPath, cfg.SnapshotInterval)
 		}
 	}
 
-	return cfg
-}
-
-// secureReadFile safely reads a file with size limits and path validation
-func secureReadFile(path string, maxSize int64) ([]byte, error) {
-	// Validate and clean the path
-	cleanPath := filepath.Clean(path)
-	if cleanPath != path {
-		return nil, fmt.Errorf("invalid file path")
+	// Only list servers that answer the game's query protocol if enabled
+	if cfg.ProbeEnabled {
+		slog.Info("Liveness probing enabled", "interval", cfg.ProbeInterval)
+		servers.StartProbing(ctx, store.UDPProber{})
 	}
 
-	// Check if path is absolute and within expected boundaries
-	if filepath.IsAbs(cleanPath) {
-		// For absolute paths, ensure they don't escape to system directories
-		if strings.Contains(cleanPath, "..") {
-			return nil, fmt.Errorf("path traversal detected")
-		}
+	// Only list servers that echo a nonce sent to the reported address if enabled
+	if cfg.ChallengeEnabled {
+		slog.Info("Ownership challenges enabled")
+		servers.StartChallenges(store.UDPChallenger{})
 	}
 
-	// Check file info first
-	info, err := os.Stat(cleanPath)
-	if err != nil {
-		return nil, fmt.Errorf("file access error")
+	// Mirror peer directories and push listed local servers to them
+	fed := federation.New(servers, "lusd/"+Version)
+	if peers := cfg.FederationPeers; len(peers) > 0 {
+		slog.Info("Federation enabled", "node", cfg.FederationNodeID, "peers", len(peers))
 	}
+	servers.PushListed(fed)
+	go fed.Run(ctx)
 
-	// Check file size
-	if info.Size() > maxSize {
-		return nil, fmt.Errorf("file too large")
+	// Notify webhook targets, resuming deliveries queued before a restart
+	hooks := webhook.New(servers.GetConfig, "lusd/"+Version, l.webhookQueuePath())
+	if restored, err := hooks.Load(); err != nil {
+		slog.Error("Error loading webhook queue, starting with an empty queue", "error", err)
+	} else if restored > 0 {
+		slog.Info("Restored webhook queue", "count", restored)
 	}
-
-	// Read file
-	data, err := os.ReadFile(cleanPath)
-	if err != nil {
-		return nil, fmt.Errorf("file read error")
+	if targets := cfg.WebhookTargets; len(targets) > 0 {
+		slog.Info("Webhooks enabled", "targets", len(targets))
 	}
+	servers.NotifyWebhooks(hooks)
+	go hooks.Run(ctx)
 
-	return data, nil
+	// Keep uptime and player counts per server, continuing the history of
+	// previous runs
+	var hist *history.Recorder
+	if cfg.HistoryEnabled {
+		hist = history.New(l.historyPath(), cfg.HistoryMaxServers)
+		if restored, err := hist.Load(); err != nil {
+			slog.Error("Error loading server history, starting with an empty history", "error", err)
+		} else {
+			slog.Info("Server history enabled", "restored", restored)
+		}
+		servers.RecordHistory(hist)
+		go hist.Run(ctx)
+	}
+
+	// Changes of the list streamed at /api/v1/events, served while enabled
+	bus := events.New(events.Options{
+		History:        cfg.EventsHistory,
+		MaxSubscribers: cfg.EventsMaxSubscribers,
+		Buffer:         cfg.EventsBufferSize,
+	})
+	servers.PublishEvents(bus)
+
+	// Counters exported at /metrics
+	m := metrics.New()
+
+	// Token bucket rate limiter, bounded in the number of clients it tracks
+	limiter := ratelimit.New(ratelimit.Options{
+		MaxKeys:     cfg.RateLimitMaxKeys,
+		IdleTimeout: cfg.RateLimitIdleTimeout,
+	})
+	go limiter.Run(ctx, rateLimitSweepInterval)
+
+	mux := http.NewServeMux()
+	security := middleware.Security(servers.GetConfig, limiter, m, hooks)
+	routes := &api.API{
+		Servers:    servers,
+		Metrics:    m,
+		Federation: fed,
+		Events:     bus,
+		Webhooks:   hooks,
+		History:    hist,
+		StatePath:  l.statePath(),
+		Version:    Version,
+		StartTime:  startTime,
+	}
+	routes.Register(mux, security)
+	if cfg.AdminToken != "" || cfg.TLSClientCAFile != "" {
+		slog.Info("Admin API enabled")
+	}
+
+	// Metrics endpoint, unless it is served on a separate internal listener
+	if cfg.MetricsEnabled && cfg.MetricsListen == "" {
+		mux.HandleFunc("/metrics", security(m.Handler(servers, limiter.Len)))
+	}
+
+	return &app{
+		Handler:      mux,
+		cfg:          cfg,
+		listenAddr:   listenAddr,
+		logLevelFlag: opts.logLevel != "",
+		locations:    l,
+		getenv:       getenv,
+		snapshotPath: snapshotPath,
+		servers:      servers,
+		metrics:      m,
+		limiter:      limiter,
+		events:       bus,
+		webhooks:     hooks,
+		history:      hist,
+		logFile:      logFile,
+	}, nil
 }
 
-// secureWriteFile safely writes a file with proper permissions and path validation
-func secureWriteFile(path string, data []byte, perm os.FileMode) error {
-	// Validate and clean the path
-	cleanPath := filepath.Clean(path)
-	if cleanPath != path {
-		return fmt.Errorf("invalid file path")
-	}
-
-	// Check for path traversal
-	if strings.Contains(cleanPath, "..") {
-		return fmt.Errorf("path traversal detected")
-	}
-
-	// Ensure parent directory exists
-	dir := filepath.Dir(cleanPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory")
-	}
-
-	// Write file with secure permissions
-	if err := os.WriteFile(cleanPath, data, perm); err != nil {
-		return fmt.Errorf("file write error")
+// newHTTPServer returns a server for handler with security timeouts and
+// limits
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		IdleTimeout:    60 * time.Second,
+		MaxHeaderBytes: 1 << 20, // 1 MB
 	}
-
-	return nil
 }
 
-// secureOpenFile safely opens a file for logging with proper permissions
-func secureOpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
-	// Validate and clean the path
-	cleanPath := filepath.Clean(path)
-	if cleanPath != path {
-		return nil, fmt.Errorf("invalid file path")
-	}
-
-	// Check for path traversal
-	if strings.Contains(cleanPath, "..") {
-		return nil, fmt.Errorf("path traversal detected")
+// listen opens a TCP listener, accepting PROXY protocol headers from
+// trusted proxies if enabled
+func (a *app) listen(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
 	}
-
-	// If file exists, check its size for log rotation
-	if info, err := os.Stat(cleanPath); err == nil {
-		if info.Size() > maxLogFileSize {
-			// Rotate log file
-			backupPath := cleanPath + ".old"
-			if err := os.Rename(cleanPath, backupPath); err != nil {
-				log.Printf("Warning: Could not rotate log file: %v", err)
-			}
-		}
+	if !a.cfg.ProxyProtocol {
+		return listener, nil
 	}
+	return &proxyproto.Listener{
+		Listener: listener,
+		Trusted: func(ip netip.Addr) bool {
+			return realip.Trusted(ip, a.servers.GetConfig().TrustedProxies)
+		},
+	}, nil
+}
 
-	// Open file with secure permissions
-	file, err := os.OpenFile(cleanPath, flag, perm)
+// serve runs the directory until ctx is done, then closes the log file.
+// Returns an error, already logged, if a listener failed.
+func (a *app) serve(ctx context.Context) error {
+	err := a.listenAndServe(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("file open error")
+		slog.Error("Server failed", "error", err)
+	} else {
+		slog.Info("Server exited")
 	}
-
-	return file, nil
-}
-
-// validateConfigPath ensures config file path is safe
-func validateConfigPath(execPath string) string {
-	// Always place config file next to executable for security
-	execDir := filepath.Dir(execPath)
-	configPath := filepath.Join(execDir, "config.json")
-
-	// Ensure the path is clean and doesn't contain traversal attempts
-	return filepath.Clean(configPath)
-}
-
-// validateLogPath ensures log file path is safe
-func validateLogPath(logFile, execPath string) (string, error) {
-	if logFile == "" {
-		return "", fmt.Errorf("empty log file path")
+	if a.logFile != nil {
+		a.logFile.Close()
 	}
+	return err
+}
 
-	var logPath string
-	if filepath.IsAbs(logFile) {
-		// For absolute paths, ensure they're within reasonable bounds
-		logPath = filepath.Clean(logFile)
-
-		// Prevent writing to system directories
-		systemDirs := []string{"/etc", "/bin", "/sbin", "/usr/bin", "/usr/sbin", "C:\\Windows", "C:\\Program Files"}
-		for _, sysDir := range systemDirs {
-			if strings.HasPrefix(strings.ToLower(logPath), strings.ToLower(sysDir)) {
-				return "", fmt.Errorf("cannot write logs to system directory")
+// listenAndServe runs the listeners, reloads the config on SIGHUP and file
+// changes, and shuts down gracefully once ctx is done or a listener fails
+func (a *app) listenAndServe(ctx context.Context) error {
+	cfg := a.cfg
+	var httpServers []*http.Server
+	errc := make(chan error, 3)
+
+	// start serves srv in a goroutine, reporting a failure to errc
+	start := func(srv *http.Server, serve func() error) {
+		httpServers = append(httpServers, srv)
+		go func() {
+			if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errc <- err
 			}
-		}
-	} else {
-		// For relative paths, place next to executable
-		execDir := filepath.Dir(execPath)
-		logPath = filepath.Join(execDir, logFile)
+		}()
 	}
 
-	// Final validation
-	logPath = filepath.Clean(logPath)
-	if strings.Contains(logPath, "..") {
-		return "", fmt.Errorf("path traversal detected in log path")
+	// Metrics on a separate internal listener
+	if cfg.MetricsEnabled && cfg.MetricsListen != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("/metrics", a.metrics.Handler(a.servers, a.limiter.Len))
+		metricsServer := newHTTPServer(cfg.MetricsListen, metricsMux)
+		slog.Info("Starting metrics server", "addr", cfg.MetricsListen)
+		start(metricsServer, metricsServer.ListenAndServe)
 	}
 
-	return logPath, nil
-}
-
-func main() {
-	// Record start time for uptime calculation
-	startTime := time.Now()
-
-	// Determine config file path - use secure path validation
-	execPath, err := os.Executable()
-	if err != nil {
-		log.Printf("Warning: Could not determine executable path, using current directory")
-		execPath = "."
+	if cfg.ProxyProtocol {
+		slog.Info("PROXY protocol enabled for trusted proxies")
 	}
-	configPath := validateConfigPath(execPath)
-
-	// Load configuration
-	cfg := loadConfig(configPath)
 
-	// Setup logging to file if enabled with security checks
-	if cfg.LogEnabled && cfg.LogFile != "" {
-		logFilePath, err := validateLogPath(cfg.LogFile, execPath)
+	// Plain HTTP stays on for the game client, which cannot do TLS, unless
+	// disabled
+	if !cfg.TLSDisableHTTP {
+		server := newHTTPServer(a.listenAddr, a)
+		listener, err := a.listen(server.Addr)
 		if err != nil {
-			log.Printf("Error validating log file path: %v, continuing with console logging only", err)
-		} else {
-			logFile, err := secureOpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, logFileMode)
-			if err != nil {
-				log.Printf("Error opening log file: %v, continuing with console logging only", err)
-			} else {
-				log.Printf("Logging to file enabled")
-				multiWriter := io.MultiWriter(os.Stdout, logFile)
-				log.SetOutput(multiWriter)
-			}
+			a.shutdown(httpServers)
+			return err
 		}
+		slog.Info("Starting server", "addr", a.listenAddr)
+		start(server, func() error { return server.Serve(listener) })
 	}
 
-	// Add security headers and input validation to HTTP handlers
-	servers := NewServerList(cfg)
-
-	// Rate limiting map (simple in-memory rate limiting)
-	var rateLimitMutex sync.Mutex
-	rateLimitMap := make(map[string][]int64)
-	const maxRequestsPerMinute = 60
-
-	// Helper function to check rate limits
-	checkRateLimit := func(ip string) bool {
-		rateLimitMutex.Lock()
-		defer rateLimitMutex.Unlock()
-
-		now := time.Now().Unix()
-		minute := now / 60
-
-		if times, exists := rateLimitMap[ip]; exists {
-			// Remove old entries
-			var newTimes []int64
-			for _, t := range times {
-				if t >= minute-1 { // Keep last 2 minutes
-					newTimes = append(newTimes, t)
-				}
-			}
-			rateLimitMap[ip] = newTimes
-
-			// Count requests in current minute
-			count := 0
-			for _, t := range newTimes {
-				if t == minute {
-					count++
-				}
-			}
-
-			if count >= maxRequestsPerMinute {
-				return false
-			}
+	// HTTPS server, certificates are reloaded without a restart
+	var certs *certReloader
+	if cfg.TLSListen != "" {
+		var err error
+		certs, err = newCertReloader(resolveReadPath(cfg.TLSCertFile, a.locations.configPath), resolveReadPath(cfg.TLSKeyFile, a.locations.configPath))
+		if err != nil {
+			a.shutdown(httpServers)
+			return fmt.Errorf("loading TLS certificate: %w", err)
 		}
-
-		// Add current request
-		rateLimitMap[ip] = append(rateLimitMap[ip], minute)
-		return true
-	}
-
-	// Security middleware
-	securityMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			// Add security headers
-			w.Header().Set("X-Content-Type-Options", "nosniff")
-			w.Header().Set("X-Frame-Options", "DENY")
-			w.Header().Set("X-XSS-Protection", "1; mode=block")
-
-			// Get client IP
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		var clientCAs *x509.CertPool
+		if cfg.TLSClientCAFile != "" {
+			clientCAs, err = loadClientCAs(resolveReadPath(cfg.TLSClientCAFile, a.locations.configPath))
 			if err != nil {
-				http.Error(w, "Invalid request", http.StatusBadRequest)
-				return
-			}
-
-			// Check rate limit
-			if !checkRateLimit(ip) {
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-				return
+				a.shutdown(httpServers)
+				return fmt.Errorf("loading TLS client CAs: %w", err)
 			}
-
-			next(w, r)
-		}
-	}
-
-	http.HandleFunc("/report.php", securityMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			return
 		}
-		if r.UserAgent() != cfg.AllowedUserAgent {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
+		tlsServer := newHTTPServer(cfg.TLSListen, a)
+		tlsServer.TLSConfig = newTLSConfig(certs, clientCAs)
+		listener, err := a.listen(cfg.TLSListen)
+		if err != nil {
+			a.shutdown(httpServers)
+			return err
 		}
-
-		// Parse form with size limit
-		r.Body = http.MaxBytesReader(w, r.Body, 1024) // 1KB limit
-		if err := r.ParseForm(); err != nil {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+		slog.Info("Starting TLS server", "addr", cfg.TLSListen)
+		start(tlsServer, func() error { return tlsServer.ServeTLS(listener, "", "") })
+	}
+	reloadCerts := func() {
+		if certs == nil {
 			return
 		}
-
-		portStr := r.FormValue("port")
-		if portStr == "" {
-			http.Error(w, "Missing port parameter", http.StatusBadRequest)
+		if err := certs.Reload(); err != nil {
+			slog.Warn("TLS certificate reload failed, keeping current certificate", "error", err)
 			return
 		}
+		slog.Info("TLS certificate reloaded")
+	}
 
-		port, err := strconv.Atoi(portStr)
-		if err != nil || port < 1024 || port > 65535 {
-			http.Error(w, "Invalid port", http.StatusBadRequest)
-			return
+	// Reload the config on SIGHUP, and on file changes if enabled
+	var reloadMutex sync.Mutex
+	reload := func() {
+		reloadMutex.Lock()
+		defer reloadMutex.Unlock()
+		err := reloadConfig(a.locations, a.servers, a.getenv)
+		a.metrics.ConfigReload(err)
+		if err != nil {
+			slog.Error("Config reload failed, keeping current config", "error", err)
+		} else if !a.logLevelFlag {
+			logging.Level.Set(a.servers.GetConfig().LogLevel)
 		}
-
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil || cfg.Blacklist[ip] {
-			// Silent drop for blacklisted IPs
-			w.WriteHeader(http.StatusOK)
-			return
+		reloadCerts()
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				slog.Info("Received SIGHUP, reloading config")
+				reload()
+			}
 		}
+	}()
 
-		// Validate IP address
-		if net.ParseIP(ip) == nil {
-			http.Error(w, "Invalid IP address", http.StatusBadRequest)
-			return
+	// Reopen the log file when an external logrotate moved it away
+	if a.logFile != nil && len(reopenSignals) > 0 {
+		reopen := make(chan os.Signal, 1)
+		signal.Notify(reopen, reopenSignals...)
+		defer signal.Stop(reopen)
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-reopen:
+					if err := a.logFile.Reopen(); err != nil {
+						slog.Error("Error reopening log file", "error", err)
+					} else {
+						slog.Info("Reopened log file")
+					}
+				}
+			}
+		}()
+	}
+
+	if cfg.ConfigWatch {
+		go watchFile(ctx, a.locations.configPath, configWatchInterval, func() {
+			slog.Info("Config file changed, reloading")
+			reload()
+		})
+		if certs != nil {
+			for _, path := range []string{certs.certFile, certs.keyFile} {
+				go watchFile(ctx, path, configWatchInterval, func() {
+					slog.Info("TLS certificate changed, reloading")
+					reloadCerts()
+				})
+			}
 		}
-		log.Printf("Received report from %s:%d", ip, port)
+	}
 
-		servers.Report(ip, port)
-		w.WriteHeader(http.StatusOK)
-	}))
+	// Wait for the interrupt signal, or a listener failing
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errc:
+	}
+	slog.Info("Shutting down server")
+	a.shutdown(httpServers)
+	return serveErr
+}
 
-	http.HandleFunc("/servers.txt", securityMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		active := servers.GetActive()
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		_, _ = w.Write([]byte(strings.Join(active, "\n")))
-	}))
-
-	http.HandleFunc("/official.txt", securityMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		_, _ = w.Write([]byte(strings.Join(servers.Config.OfficialServers, "\n")))
-	}))
-
-	// Health check endpoint
-	http.HandleFunc("/health", securityMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		health := map[string]interface{}{
-			"status":        "ok",
-			"version":       Version,
-			"timestamp":     time.Now().Unix(),
-			"uptime":        time.Since(startTime).Seconds(),
-			"activeServers": len(servers.GetActive()),
-		}
-		json.NewEncoder(w).Encode(health)
-	}))
+// shutdown gracefully stops httpServers and writes the final snapshot, the
+// webhook queue and the server history. The log file stays open for serve
+// to close.
+func (a *app) shutdown(httpServers []*http.Server) {
+	// Create a deadline for graceful shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	// Version endpoint
-	http.HandleFunc("/version", securityMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		version := map[string]string{
-			"version": Version,
+	// End the event streams, Shutdown would wait for them
+	a.events.Close()
+	for _, srv := range httpServers {
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Warn("Server forced to shutdown", "addr", srv.Addr, "error", err)
 		}
-		json.NewEncoder(w).Encode(version)
-	}))
-	// Create HTTP server with security timeouts and limits
-	addr := fmt.Sprintf(":%d", cfg.Port)
-	server := &http.Server{
-		Addr:           addr,
-		Handler:        nil,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		IdleTimeout:    60 * time.Second,
-		MaxHeaderBytes: 1 << 20, // 1 MB
 	}
 
-	// Start server in a goroutine
-	go func() {
-		log.Printf("Starting server on port %d...", cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+	// Persist the final state so the next start has a warm list
+	if a.snapshotPath != "" {
+		if err := a.servers.SaveSnapshot(a.snapshotPath); err != nil {
+			slog.Error("Error writing final snapshot", "error", err)
+		} else {
+			slog.Info("Wrote final snapshot")
 		}
-	}()
-
-	// Wait for interrupt signal to gracefully shutdown the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down server...")
-
-	// Create a deadline for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Attempt graceful shutdown
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
 	}
 
-	log.Println("Server exited")
+	// Undelivered webhook events are sent after the next start
+	if err := a.webhooks.Save(); err != nil {
+		slog.Error("Error writing webhook queue", "error", err)
+	}
+	if err := a.history.Save(); err != nil {
+		slog.Error("Error writing server history", "error", err)
+	}
 }
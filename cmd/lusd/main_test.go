@@ -1,218 +1,113 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strings"
 	"testing"
-	"time"
 )
 
-func TestLoadConfig(t *testing.T) {
-	// Test loading non-existent config (should return defaults)
-	cfg := loadConfig("nonexistent.json")
-	
-	if cfg.Port != 80 {
-		t.Errorf("Expected default port 80, got %d", cfg.Port)
-	}
-	
-	if cfg.AllowedUserAgent != "LU-Server/0.1" {
-		t.Errorf("Expected default user agent 'LU-Server/0.1', got %s", cfg.AllowedUserAgent)
-	}
-	
-	if cfg.StaleTimeout != 10*time.Minute {
-		t.Errorf("Expected default stale timeout 10m, got %v", cfg.StaleTimeout)
-	}
-}
+// newTestApp runs the directory with a config written to a temporary
+// directory, without file logging or snapshots
+func newTestApp(t *testing.T, extra string) *app {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m",
+		"officialServers": ["192.168.1.100:1234"], "logFile": "lusd.log", "logEnabled": false, "snapshotEnabled": false`+extra+`}`)
 
-func TestServerList(t *testing.T) {
-	cfg := Config{
-		Port:             80,
-		AllowedUserAgent: "LU-Server/0.1",
-		StaleTimeout:     time.Minute,
-		Blacklist:        make(map[string]bool),
-		OfficialServers:  []string{"192.168.1.100:1234"},
-		LogFile:          "",
-		LogEnabled:       false,
-	}
-	
-	servers := NewServerList(cfg)
-	
-	// Test reporting a server
-	servers.Report("127.0.0.1", 2301)
-	
-	active := servers.GetActive()
-	found := false
-	for _, addr := range active {
-		if addr == "127.0.0.1:2301" {
-			found = true
-			break
-		}
-	}
-	
-	if !found {
-		t.Error("Expected to find reported server in active list")
-	}
-	
-	// Test official servers are included
-	found = false
-	for _, addr := range active {
-		if addr == "192.168.1.100:1234" {
-			found = true
-			break
-		}
-	}
-	
-	if !found {
-		t.Error("Expected to find official server in active list")
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	a, err := run(ctx, []string{"-config", path}, noEnv, io.Discard)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
 	}
+	return a
 }
 
-func TestReportEndpoint(t *testing.T) {
-	cfg := Config{
-		Port:             80,
-		AllowedUserAgent: "LU-Server/0.1",
-		StaleTimeout:     time.Minute,
-		Blacklist:        make(map[string]bool),
-		OfficialServers:  []string{},
-		LogFile:          "",
-		LogEnabled:       false,
-	}
-	
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		if r.UserAgent() != cfg.AllowedUserAgent {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
+// get requests target from the app and returns the response
+func get(a *app, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w
+}
 
-		portStr := r.FormValue("port")
-		if portStr == "" {
-			http.Error(w, "Invalid port", http.StatusBadRequest)
-			return
-		}
+func TestRunServesRoutes(t *testing.T) {
+	a := newTestApp(t, `, "metricsEnabled": true`)
 
-		w.WriteHeader(http.StatusOK)
-	}
-	
-	// Test valid request
-	form := url.Values{}
-	form.Add("port", "2301")
+	form := url.Values{"port": {"2301"}}
 	req := httptest.NewRequest("POST", "/report.php", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("User-Agent", "LU-Server/0.1")
-	
 	w := httptest.NewRecorder()
-	handler(w, req)
-	
+	a.ServeHTTP(w, req)
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
-	}
-	
-	// Test invalid user agent
-	req.Header.Set("User-Agent", "Invalid")
-	w = httptest.NewRecorder()
-	handler(w, req)
-	
-	if w.Code != http.StatusForbidden {
-		t.Errorf("Expected status 403 for invalid user agent, got %d", w.Code)
+		t.Fatalf("Expected status 200 for report, got %d", w.Code)
 	}
-	
-	// Test invalid method
-	req = httptest.NewRequest("GET", "/report.php", nil)
-	w = httptest.NewRecorder()
-	handler(w, req)
-	
-	if w.Code != http.StatusMethodNotAllowed {
-		t.Errorf("Expected status 405 for invalid method, got %d", w.Code)
-	}
-}
 
-func TestHealthEndpoint(t *testing.T) {
-	startTime := time.Now()
-	
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		health := map[string]interface{}{
-			"status":        "ok",
-			"version":       "test",
-			"buildTime":     "test-time",
-			"commit":        "test-commit",
-			"timestamp":     time.Now().Unix(),
-			"uptime":        time.Since(startTime).Seconds(),
-			"activeServers": 0,
+	w = get(a, "/servers.txt")
+	if w.Code != http.StatusOK || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Expected status 200 with security headers, got %d", w.Code)
+	}
+	for _, addr := range []string{"192.0.2.1:2301", "192.168.1.100:1234"} {
+		if !strings.Contains(w.Body.String(), addr) {
+			t.Errorf("Expected servers.txt to contain %s, got %q", addr, w.Body.String())
 		}
-		json.NewEncoder(w).Encode(health)
 	}
-	
-	req := httptest.NewRequest("GET", "/health", nil)
-	w := httptest.NewRecorder()
-	
-	handler(w, req)
-	
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+
+	var list struct {
+		Servers []struct {
+			Address string `json:"address"`
+		} `json:"servers"`
 	}
-	
-	if w.Header().Get("Content-Type") != "application/json" {
-		t.Errorf("Expected Content-Type application/json, got %s", w.Header().Get("Content-Type"))
+	if err := json.Unmarshal(get(a, "/servers.json").Body.Bytes(), &list); err != nil || len(list.Servers) != 2 {
+		t.Errorf("Expected two servers in servers.json, got %+v, %v", list, err)
 	}
-	
+
 	var health map[string]interface{}
-	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
-		t.Errorf("Failed to unmarshal health response: %v", err)
+	if err := json.Unmarshal(get(a, "/health").Body.Bytes(), &health); err != nil {
+		t.Fatalf("Failed to unmarshal health response: %v", err)
 	}
-	
-	if health["status"] != "ok" {
-		t.Errorf("Expected status 'ok', got %v", health["status"])
+	if health["status"] != "ok" || health["version"] != Version || health["activeServers"] != float64(2) {
+		t.Errorf("Unexpected health response: %v", health)
 	}
-}
 
-func TestServersEndpoint(t *testing.T) {
-	cfg := Config{
-		Port:             80,
-		AllowedUserAgent: "LU-Server/0.1",
-		StaleTimeout:     time.Minute,
-		Blacklist:        make(map[string]bool),
-		OfficialServers:  []string{"192.168.1.100:1234"},
-		LogFile:          "",
-		LogEnabled:       false,
+	if w := get(a, "/version"); !strings.Contains(w.Body.String(), `"version":"`+Version+`"`) {
+		t.Errorf("Unexpected version response: %s", w.Body.String())
 	}
-	
-	servers := NewServerList(cfg)
-	servers.Report("127.0.0.1", 2301)
-	
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		active := servers.GetActive()
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte(strings.Join(active, "\n")))
+
+	// Without an admin token the admin API does not exist
+	if w := get(a, "/admin/bans"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for admin API without token, got %d", w.Code)
 	}
-	
-	req := httptest.NewRequest("GET", "/servers.txt", nil)
-	w := httptest.NewRecorder()
-	
-	handler(w, req)
-	
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+
+	if w := get(a, "/metrics"); !strings.Contains(w.Body.String(), "lusd_reports_accepted_total 1\n") {
+		t.Errorf("Expected the accepted report to be counted, got:\n%s", w.Body.String())
 	}
-	
-	if w.Header().Get("Content-Type") != "text/plain" {
-		t.Errorf("Expected Content-Type text/plain, got %s", w.Header().Get("Content-Type"))
+}
+
+func TestRunMetricsDisabled(t *testing.T) {
+	a := newTestApp(t, "")
+	if w := get(a, "/metrics"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for metrics when disabled, got %d", w.Code)
 	}
-	
-	body := w.Body.String()
-	if !strings.Contains(body, "127.0.0.1:2301") {
-		t.Error("Expected response to contain reported server")
+}
+
+func TestRunRefusesInvalidStrictConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"strict": true, "port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log", "blacklst": []}`)
+	if _, err := run(context.Background(), []string{"-config", path}, noEnv, io.Discard); !errors.Is(err, errInvalidConfig) {
+		t.Errorf("Expected an invalid strict config to be refused, got %v", err)
 	}
-	
-	if !strings.Contains(body, "192.168.1.100:1234") {
-		t.Error("Expected response to contain official server")
+}
+
+func TestRunRejectsUnknownFlags(t *testing.T) {
+	if _, err := run(context.Background(), []string{"-bogus"}, noEnv, io.Discard); err == nil {
+		t.Error("Expected unknown flag to fail")
 	}
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lusd/internal/config"
+	"lusd/internal/history"
+	"lusd/internal/webhook"
+)
+
+// File location constants
+const (
+	appName        = "lusd"
+	configFileName = "config.json"
+	stateDirMode   = 0750 // Owner full access, group read only
+)
+
+// systemDirs are never written to, wherever a path comes from
+var systemDirs = []string{"/etc", "/bin", "/sbin", "/usr/bin", "/usr/sbin", "C:\\Windows", "C:\\Program Files"}
+
+// locations are where lusd reads its config and writes its state. The
+// config file may be read only; logs, snapshots and admin changes go to the
+// state directory.
+type locations struct {
+	configPath string
+	stateDir   string
+}
+
+// statePath returns the path of the admin state file
+func (l locations) statePath() string {
+	return filepath.Join(l.stateDir, config.StateFile)
+}
+
+// webhookQueuePath returns the path of the webhook delivery queue
+func (l locations) webhookQueuePath() string {
+	return filepath.Join(l.stateDir, webhook.QueueFile)
+}
+
+// historyPath returns the path of the server history file
+func (l locations) historyPath() string {
+	return filepath.Join(l.stateDir, history.File)
+}
+
+// resolveLocations finds the config file and the state directory.
+//
+// The config file is the --config flag, else LUSD_CONFIG, else the first
+// config.json that exists in the system config directory (/etc/lusd), the
+// user config directory ($XDG_CONFIG_HOME/lusd) and next to the executable.
+// Without any, the default config is created next to the executable.
+//
+// The state directory is the --state-dir flag, else LUSD_STATE_DIR, else
+// the directory systemd created for StateDirectory=. Otherwise it follows
+// the config file: the executable directory for a config next to the
+// executable, the system state directory (/var/lib/lusd) for one in the
+// system config directory, and the user state directory
+// ($XDG_STATE_HOME/lusd), or the config file directory, for any other.
+func resolveLocations(opts options, getenv func(string) string, execPath string) (locations, error) {
+	execDir := filepath.Dir(execPath)
+	l := locations{configPath: opts.configPath}
+	if l.configPath == "" {
+		l.configPath = filepath.Clean(getenv("LUSD_CONFIG"))
+	}
+	if l.configPath == "." {
+		l.configPath = filepath.Join(execDir, configFileName)
+		for _, dir := range []string{systemConfigDir(getenv), userConfigDir(getenv)} {
+			if dir == "" {
+				continue
+			}
+			if path := filepath.Join(dir, configFileName); fileExists(path) {
+				l.configPath = path
+				break
+			}
+		}
+	}
+	if strings.Contains(l.configPath, "..") {
+		return l, fmt.Errorf("path traversal detected in config path")
+	}
+
+	l.stateDir = opts.stateDir
+	if l.stateDir == "" {
+		l.stateDir = getenv("LUSD_STATE_DIR")
+	}
+	if l.stateDir == "" {
+		// systemd passes a colon separated list, the first is ours
+		l.stateDir, _, _ = strings.Cut(getenv("STATE_DIRECTORY"), ":")
+	}
+	if l.stateDir == "" {
+		configDir := filepath.Dir(l.configPath)
+		switch {
+		case configDir == execDir:
+			l.stateDir = execDir
+		case configDir == systemConfigDir(getenv):
+			l.stateDir = systemStateDir(getenv)
+		default:
+			l.stateDir = userStateDir(getenv)
+		}
+		if l.stateDir == "" {
+			l.stateDir = configDir
+		}
+	}
+	l.stateDir = filepath.Clean(l.stateDir)
+	if strings.Contains(l.stateDir, "..") {
+		return l, fmt.Errorf("path traversal detected in state directory")
+	}
+	if inSystemDir(l.stateDir) {
+		return l, fmt.Errorf("cannot use a system directory as state directory")
+	}
+	return l, nil
+}
+
+// fileExists reports whether path is an existing regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// inSystemDir reports whether path is in one of the system directories
+func inSystemDir(path string) bool {
+	for _, sysDir := range systemDirs {
+		if strings.HasPrefix(strings.ToLower(path), strings.ToLower(sysDir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateLogPath ensures log file path is safe. Relative paths are placed
+// in the state directory.
+func validateLogPath(logFile, stateDir string) (string, error) {
+	if logFile == "" {
+		return "", fmt.Errorf("empty log file path")
+	}
+
+	// Relative paths must stay within the state directory
+	if strings.Contains(logFile, "..") {
+		return "", fmt.Errorf("path traversal detected in log path")
+	}
+	logPath := logFile
+	if !filepath.IsAbs(logFile) {
+		logPath = filepath.Join(stateDir, logFile)
+	}
+
+	// Prevent writing to system directories
+	logPath = filepath.Clean(logPath)
+	if inSystemDir(logPath) {
+		return "", fmt.Errorf("cannot write logs to system directory")
+	}
+
+	return logPath, nil
+}
+
+// resolveReadPath resolves a relative path of a file lusd only reads, such
+// as a certificate, against the config file directory
+func resolveReadPath(path, configPath string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(configPath), path)
+}
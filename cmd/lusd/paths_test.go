@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolveLocations(t *testing.T) {
+	if fileExists(filepath.Join(systemConfigDir(noEnv), configFileName)) {
+		t.Skip("A system config file exists on this machine")
+	}
+	execPath := filepath.Join(t.TempDir(), "lusd")
+	home := t.TempDir()
+	userConfig := filepath.Join(home, "config")
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+
+	// Without any config file lusd keeps everything next to the executable
+	l, err := resolveLocations(options{}, getenv, execPath)
+	if err != nil || l.configPath != filepath.Join(filepath.Dir(execPath), configFileName) || l.stateDir != filepath.Dir(execPath) {
+		t.Errorf("Expected the executable directory, got %+v %v", l, err)
+	}
+
+	// A config in the user config directory is found, state goes to the user state directory
+	for _, variable := range []string{"XDG_CONFIG_HOME", "AppData"} {
+		env[variable] = userConfig
+	}
+	for _, variable := range []string{"XDG_STATE_HOME", "LocalAppData"} {
+		env[variable] = filepath.Join(home, "state")
+	}
+	if err := os.MkdirAll(userConfigDir(getenv), 0700); err != nil {
+		t.Fatalf("Failed to create config directory: %v", err)
+	}
+	writeTestConfig(t, filepath.Join(userConfigDir(getenv), configFileName), `{}`)
+	l, err = resolveLocations(options{}, getenv, execPath)
+	if err != nil || l.configPath != filepath.Join(userConfig, appName, configFileName) || l.stateDir != filepath.Join(home, "state", appName) {
+		t.Errorf("Expected the user directories, got %+v %v", l, err)
+	}
+
+	// LUSD_CONFIG wins over the search, the flag over LUSD_CONFIG
+	env["LUSD_CONFIG"] = filepath.Join(home, "env.json")
+	if l, _ = resolveLocations(options{}, getenv, execPath); l.configPath != env["LUSD_CONFIG"] {
+		t.Errorf("Expected LUSD_CONFIG, got %s", l.configPath)
+	}
+	flagPath := filepath.Join(home, "flag.json")
+	if l, _ = resolveLocations(options{configPath: flagPath}, getenv, execPath); l.configPath != flagPath {
+		t.Errorf("Expected the --config flag, got %s", l.configPath)
+	}
+
+	// Without a user state directory, state stays next to an explicit config
+	delete(env, "XDG_STATE_HOME")
+	delete(env, "LocalAppData")
+	if l, _ = resolveLocations(options{}, getenv, execPath); l.stateDir != home {
+		t.Errorf("Expected the config file directory, got %s", l.stateDir)
+	}
+
+	// systemd's StateDirectory=, then LUSD_STATE_DIR, then the flag
+	env["STATE_DIRECTORY"] = filepath.Join(home, "systemd") + ":" + filepath.Join(home, "other")
+	if l, _ = resolveLocations(options{}, getenv, execPath); l.stateDir != filepath.Join(home, "systemd") {
+		t.Errorf("Expected STATE_DIRECTORY, got %s", l.stateDir)
+	}
+	env["LUSD_STATE_DIR"] = filepath.Join(home, "env")
+	if l, _ = resolveLocations(options{}, getenv, execPath); l.stateDir != env["LUSD_STATE_DIR"] {
+		t.Errorf("Expected LUSD_STATE_DIR, got %s", l.stateDir)
+	}
+	if l, _ = resolveLocations(options{stateDir: filepath.Join(home, "flag")}, getenv, execPath); l.stateDir != filepath.Join(home, "flag") {
+		t.Errorf("Expected the --state-dir flag, got %s", l.stateDir)
+	}
+
+	// Traversal and system directories are refused
+	env["LUSD_CONFIG"] = "../config.json"
+	if _, err := resolveLocations(options{}, getenv, execPath); err == nil {
+		t.Error("Expected a config path with traversal to be refused")
+	}
+	if runtime.GOOS != "windows" {
+		if _, err := resolveLocations(options{configPath: flagPath, stateDir: "/usr/bin"}, getenv, execPath); err == nil {
+			t.Error("Expected a system state directory to be refused")
+		}
+	}
+	if _, err := validateLogPath("../lusd.log", home); err == nil {
+		t.Error("Expected a log path leaving the state directory to be refused")
+	}
+}
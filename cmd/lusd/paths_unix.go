@@ -0,0 +1,40 @@
+//go:build !windows
+
+package main
+
+import "path/filepath"
+
+// systemConfigDir returns the config directory of the Filesystem Hierarchy
+// Standard
+func systemConfigDir(getenv func(string) string) string {
+	return "/etc/lusd"
+}
+
+// systemStateDir returns the state directory of the Filesystem Hierarchy
+// Standard
+func systemStateDir(getenv func(string) string) string {
+	return "/var/lib/lusd"
+}
+
+// userConfigDir returns $XDG_CONFIG_HOME/lusd, ~/.config/lusd by default
+func userConfigDir(getenv func(string) string) string {
+	return xdgDir(getenv, "XDG_CONFIG_HOME", ".config")
+}
+
+// userStateDir returns $XDG_STATE_HOME/lusd, ~/.local/state/lusd by default
+func userStateDir(getenv func(string) string) string {
+	return xdgDir(getenv, "XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// xdgDir returns the lusd directory in the XDG base directory named by
+// variable, or in fallback under the home directory. Returns "" if neither
+// is known; relative base directories are ignored as the spec requires.
+func xdgDir(getenv func(string) string, variable, fallback string) string {
+	if dir := getenv(variable); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName)
+	}
+	if home := getenv("HOME"); filepath.IsAbs(home) {
+		return filepath.Join(home, fallback, appName)
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package main
+
+import "path/filepath"
+
+// systemConfigDir returns %ProgramData%\lusd, shared by all users
+func systemConfigDir(getenv func(string) string) string {
+	return knownDir(getenv, "ProgramData")
+}
+
+// systemStateDir returns %ProgramData%\lusd, the same as the config
+func systemStateDir(getenv func(string) string) string {
+	return knownDir(getenv, "ProgramData")
+}
+
+// userConfigDir returns %AppData%\lusd, which roams with the user
+func userConfigDir(getenv func(string) string) string {
+	return knownDir(getenv, "AppData")
+}
+
+// userStateDir returns %LocalAppData%\lusd, which stays on this machine
+func userStateDir(getenv func(string) string) string {
+	return knownDir(getenv, "LocalAppData")
+}
+
+// knownDir returns the lusd directory in the known folder named by
+// variable, or "" if it is not set
+func knownDir(getenv func(string) string, variable string) string {
+	if dir := getenv(variable); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName)
+	}
+	return ""
+}
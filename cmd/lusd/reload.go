@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/store"
+)
+
+// configWatchInterval is how often the config file mtime is checked when
+// configWatch is enabled
+const configWatchInterval = 5 * time.Second
+
+// reloadConfig re-reads the config file, the environment, including
+// secrets in *_FILE files, and the admin state, and swaps the result into
+// servers. The new config is rejected, and the current one kept, if a file
+// cannot be read or any value is invalid, whether or not strict mode is
+// enabled.
+func reloadConfig(l locations, servers *store.ServerList, getenv func(string) string) error {
+	cfg, problems, err := config.Read(l.configPath, getenv)
+	if err != nil {
+		return err
+	}
+	if err := config.ApplyState(l.statePath(), &cfg); err != nil {
+		return fmt.Errorf("invalid state file: %w", err)
+	}
+	if len(problems) > 0 {
+		messages := make([]string, len(problems))
+		for i, problem := range problems {
+			messages[i] = problem.Error()
+		}
+		return fmt.Errorf("invalid config: %s", strings.Join(messages, "; "))
+	}
+
+	old := servers.SetConfig(cfg)
+	changes := config.Diff(old, cfg)
+	if len(changes) == 0 {
+		slog.Info("Config reloaded, no changes")
+		return nil
+	}
+	for _, change := range changes {
+		slog.Info("Config changed", "change", change)
+	}
+	return nil
+}
+
+// watchFile calls changed whenever the modification time of path changes,
+// until ctx is done
+func watchFile(ctx context.Context, path string, interval time.Duration, changed func()) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(lastMod) {
+			lastMod = info.ModTime()
+			changed()
+		}
+	}
+}
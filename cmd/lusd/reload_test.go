@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lusd/internal/config"
+	"lusd/internal/store"
+)
+
+func writeTestConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+func noEnv(string) string { return "" }
+
+// loadTestConfig loads the config file at path, failing the test on error
+func loadTestConfig(t *testing.T, path string) config.Config {
+	t.Helper()
+	cfg, err := config.Load(path, noEnv)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return cfg
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	l := locations{configPath: path, stateDir: dir}
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log", "blacklist": ["10.0.0.1"]}`)
+
+	servers := store.New(loadTestConfig(t, path))
+	if !servers.IsBlacklisted("10.0.0.1") {
+		t.Fatal("Expected initial blacklist to be loaded")
+	}
+
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.2", "staleTimeout": "1m", "logFile": "lusd.log", "blacklist": ["10.0.0.2"]}`)
+	if err := reloadConfig(l, servers, noEnv); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+
+	cfg := servers.GetConfig()
+	if cfg.AllowedUserAgent != "LU-Server/0.2" {
+		t.Errorf("Expected reloaded user agent, got %s", cfg.AllowedUserAgent)
+	}
+	if servers.IsBlacklisted("10.0.0.1") || !servers.IsBlacklisted("10.0.0.2") {
+		t.Error("Expected blacklist to be swapped")
+	}
+
+	// Admin changes saved to the state directory are ignored without
+	// adminPersist, and replace the file lists with it
+	writeTestConfig(t, l.statePath(), `{"blacklist": ["10.0.0.3"], "officialServers": []}`)
+	if err := reloadConfig(l, servers, noEnv); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	if !servers.IsBlacklisted("10.0.0.2") || servers.IsBlacklisted("10.0.0.3") {
+		t.Error("Expected the state file to be ignored without adminPersist")
+	}
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.2", "staleTimeout": "1m", "logFile": "lusd.log", "adminPersist": true, "blacklist": ["10.0.0.2"]}`)
+	if err := reloadConfig(l, servers, noEnv); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	if servers.IsBlacklisted("10.0.0.2") || !servers.IsBlacklisted("10.0.0.3") {
+		t.Error("Expected the blacklist of the state file")
+	}
+}
+
+func TestReloadConfigRejectsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log"}`)
+	servers := store.New(loadTestConfig(t, path))
+
+	for _, data := range []string{
+		`{"port": 8080,`,
+		`{"port": 70000, "allowedUserAgent": "LU-Server/0.3", "staleTimeout": "1m", "logFile": "lusd.log"}`,
+		`{"port": 8080, "allowedUserAgent": "LU-Server/0.3", "staleTimeout": "soon"}`,
+		`{"strict": true, "port": 8080, "allowedUserAgent": "LU-Server/0.3", "staleTimeout": "1m", "logFile": "lusd.log", "prot": 80}`,
+	} {
+		writeTestConfig(t, path, data)
+		if err := reloadConfig(locations{configPath: path, stateDir: dir}, servers, noEnv); err == nil {
+			t.Errorf("Expected reload of %s to fail", data)
+		}
+		if cfg := servers.GetConfig(); cfg.AllowedUserAgent != "LU-Server/0.1" || cfg.Port != 8080 {
+			t.Errorf("Expected old config to be kept, got %+v", cfg)
+		}
+	}
+}
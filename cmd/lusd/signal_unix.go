@@ -0,0 +1,12 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals make lusd reopen its log file, as sent by logrotate's
+// postrotate scripts
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
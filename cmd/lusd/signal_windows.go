@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reopenSignals is empty on Windows, which has no SIGUSR1. The log file is
+// rotated in-process only.
+var reopenSignals []os.Signal
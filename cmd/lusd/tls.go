@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"lusd/internal/securefile"
+)
+
+// TLS constants
+const (
+	maxCertFileSize = 1024 * 1024 // 1MB, generous for a chain and key
+)
+
+// certReloader serves the current certificate and swaps in a new one on
+// Reload. Handshakes in progress keep the certificate they started with, so
+// no connection is dropped.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+// newCertReloader loads the initial key pair
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the key pair from disk. The current certificate is kept if
+// the files cannot be read or do not match.
+func (r *certReloader) Reload() error {
+	certPEM, err := securefile.Read(r.certFile, maxCertFileSize)
+	if err != nil {
+		return fmt.Errorf("certificate: %v", err)
+	}
+	keyPEM, err := securefile.Read(r.keyFile, maxCertFileSize)
+	if err != nil {
+		return fmt.Errorf("key: %v", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid key pair")
+	}
+	r.cert.Store(&cert)
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// loadClientCAs reads the PEM encoded CAs that issue admin client
+// certificates
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := securefile.Read(path, maxCertFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("client CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("client CA: no certificates found")
+	}
+	return pool, nil
+}
+
+// newTLSConfig builds the listener config around the reloader. With
+// clientCAs, clients may present a certificate issued by them, which
+// authorizes the admin API. Clients without one connect as before.
+func newTLSConfig(reloader *certReloader, clientCAs *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if clientCAs != nil {
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and key for name into dir
+func writeTestCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// servedName returns the common name of the certificate r hands out
+func servedName(t *testing.T, r *certReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "old.example.org")
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+	if name := servedName(t, r); name != "old.example.org" {
+		t.Errorf("Expected old certificate, got %s", name)
+	}
+
+	writeTestCert(t, dir, "new.example.org")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if name := servedName(t, r); name != "new.example.org" {
+		t.Errorf("Expected new certificate, got %s", name)
+	}
+
+	// A half-written renewal must not replace a working certificate
+	if err := os.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("Expected reload of a broken key pair to fail")
+	}
+	if name := servedName(t, r); name != "new.example.org" {
+		t.Errorf("Expected the current certificate to be kept, got %s", name)
+	}
+
+	if _, err := newCertReloader(filepath.Join(dir, "missing.pem"), keyFile); err == nil {
+		t.Error("Expected missing certificate to fail")
+	}
+}
+
+func TestTLSHandshake(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "lusd.example.org")
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(nil)
+	ts.TLS = newTLSConfig(r, nil)
+	ts.StartTLS()
+	defer ts.Close()
+
+	conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{ServerName: "lusd.example.org", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	if cn := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != "lusd.example.org" {
+		t.Errorf("Expected the reloader's certificate, got %s", cn)
+	}
+}
+
+// newTestClientCA returns a CA in PEM form and a client certificate it
+// issued
+func newTestClientCA(t *testing.T) ([]byte, tls.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "lusd admin CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	clientTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "admin"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTmpl, ca, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+}
+
+func TestAdminClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "lusd.example.org")
+	caPEM, clientCert := newTestClientCA(t)
+	caFile := filepath.Join(dir, "client-ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// No admin token, client certificates are the only way in
+	a := newTestApp(t, fmt.Sprintf(`, "tls": {"listen": "127.0.0.1:0", "certFile": %q, "keyFile": %q, "clientCAFile": %q}`, certFile, keyFile, caFile))
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+	clientCAs, err := loadClientCAs(caFile)
+	if err != nil {
+		t.Fatalf("loadClientCAs failed: %v", err)
+	}
+	ts := httptest.NewUnstartedServer(a)
+	ts.TLS = newTLSConfig(r, clientCAs)
+	ts.StartTLS()
+	defer ts.Close()
+
+	status := func(certs []tls.Certificate) int {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certs}}}
+		resp, err := client.Get(ts.URL + "/admin/bans")
+		if err != nil {
+			t.Fatalf("GET /admin/bans failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status([]tls.Certificate{clientCert}); code != http.StatusOK {
+		t.Errorf("Expected a client certificate to authorize the admin API, got %d", code)
+	}
+	if code := status(nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a client certificate, got %d", code)
+	}
+
+	if _, err := loadClientCAs(keyFile); err == nil {
+		t.Error("Expected a file without certificates to be rejected")
+	}
+}
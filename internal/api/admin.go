@@ -0,0 +1,377 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/reportsig"
+)
+
+// Admin API constants
+const (
+	maxAdminBodySize = 4096 // 4KB limit
+	maxBanReasonLen  = 256
+)
+
+// adminBan is a ban as shown by the admin API
+type adminBan struct {
+	IP      string     `json:"ip"`
+	Reason  string     `json:"reason,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// adminRegistration is a registration as shown by the admin API. The token
+// is only returned when it is issued.
+type adminRegistration struct {
+	Address string `json:"address"`
+	Policy  string `json:"policy"`
+	Token   string `json:"token,omitempty"`
+}
+
+// adminRequest is the body of admin POST requests
+type adminRequest struct {
+	IP       string `json:"ip"`
+	Address  string `json:"address"`
+	Reason   string `json:"reason"`
+	Expires  string `json:"expires"`  // RFC 3339
+	Duration string `json:"duration"` // alternative to expires, e.g. "24h"
+	Policy   string `json:"policy"`   // registration policy
+}
+
+// adminEnabled reports whether the admin API exists, which takes an admin
+// token or CAs for client certificates
+func adminEnabled(cfg config.Config) bool {
+	return cfg.AdminToken != "" || cfg.TLSClientCAFile != ""
+}
+
+// authorized checks the bearer token, or a client certificate verified by
+// the TLS listener against tls.clientCAFile
+func (a *API) authorized(r *http.Request, adminToken string) bool {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || adminToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// auth rejects requests that are not authorized for the admin API. Without
+// an admin token or client CAs the API does not exist.
+func (a *API) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := a.Servers.GetConfig()
+		if !adminEnabled(cfg) {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		if !a.authorized(r, cfg.AdminToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="lusd-admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// registerAdmin adds the admin routes to mux behind the given middleware.
+// The token and persistence settings are read from the current config on
+// every request so they follow config reloads.
+func (a *API) registerAdmin(mux *http.ServeMux, middleware func(http.HandlerFunc) http.HandlerFunc) {
+	mux.HandleFunc("/admin/bans", middleware(a.auth(a.handleBans)))
+	mux.HandleFunc("/admin/official", middleware(a.auth(a.handleOfficial)))
+	mux.HandleFunc("/admin/entries", middleware(a.auth(a.handleEntries)))
+	mux.HandleFunc("/admin/entries/pin", middleware(a.auth(a.handlePin)))
+	mux.HandleFunc("/admin/registrations", middleware(a.auth(a.handleRegistrations)))
+}
+
+// readAdminRequest decodes a size-limited admin request body
+func readAdminRequest(w http.ResponseWriter, r *http.Request) (*adminRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodySize)
+	var req adminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid request body")
+	}
+	req.IP = strings.TrimSpace(req.IP)
+	req.Address = strings.TrimSpace(req.Address)
+	return &req, nil
+}
+
+// writeAdminJSON writes v as a JSON response
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// persistState writes the current bans, official servers and registrations
+// to the state file if persistence is enabled
+func (a *API) persistState() error {
+	cfg := a.Servers.GetConfig()
+	if !cfg.AdminPersist {
+		return nil
+	}
+	return config.Persist(a.StatePath, cfg)
+}
+
+// validChange checks cfg, the current config with an admin change applied,
+// with the same validation as the config file. Writes every problem as a
+// 400 response and returns false if it is invalid.
+func validChange(w http.ResponseWriter, cfg config.Config) bool {
+	err := cfg.Validate()
+	if err == nil {
+		return true
+	}
+	problems := strings.Split(err.Error(), "\n")
+	writeAdminJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": problems})
+	return false
+}
+
+// finish persists a successful change and writes the response
+func (a *API) finish(w http.ResponseWriter, status int, v interface{}) {
+	if err := a.persistState(); err != nil {
+		slog.Error("Error persisting admin change", "error", err)
+		http.Error(w, "Change applied but could not be saved", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, status, v)
+}
+
+// parseAdminBan builds a ban from a POST body
+func parseAdminBan(req *adminRequest, now time.Time) (banset.Entry, error) {
+	prefix, err := banset.ParsePrefix(req.IP)
+	if err != nil {
+		return banset.Entry{}, fmt.Errorf("invalid address")
+	}
+	if len(req.Reason) > maxBanReasonLen {
+		return banset.Entry{}, fmt.Errorf("reason too long")
+	}
+	ban := banset.Entry{Prefix: prefix, Reason: strings.TrimSpace(req.Reason)}
+
+	switch {
+	case req.Expires != "" && req.Duration != "":
+		return banset.Entry{}, fmt.Errorf("set either expires or duration")
+	case req.Expires != "":
+		expires, err := time.Parse(time.RFC3339, req.Expires)
+		if err != nil || !expires.After(now) {
+			return banset.Entry{}, fmt.Errorf("invalid expires")
+		}
+		ban.Expires = expires
+	case req.Duration != "":
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			return banset.Entry{}, fmt.Errorf("invalid duration")
+		}
+		ban.Expires = now.Add(duration).Truncate(time.Second)
+	}
+	return ban, nil
+}
+
+func (a *API) handleBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		bans := []adminBan{}
+		for _, e := range a.Servers.GetBans() {
+			ban := adminBan{IP: e.Address(), Reason: e.Reason}
+			if !e.Expires.IsZero() {
+				expires := e.Expires.UTC()
+				ban.Expires = &expires
+			}
+			bans = append(bans, ban)
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"bans": bans})
+
+	case http.MethodPost:
+		req, err := readAdminRequest(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		ban, err := parseAdminBan(req, time.Now())
+		if err != nil {
+			http.Error(w, "Invalid ban: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := a.Servers.AddBan(ban); err != nil {
+			http.Error(w, "Invalid IP address", http.StatusBadRequest)
+			return
+		}
+		slog.Info("Admin banned", "ip", ban.Address())
+		a.finish(w, http.StatusCreated, map[string]string{"ip": ban.Address()})
+
+	case http.MethodDelete:
+		prefix, err := banset.ParsePrefix(r.URL.Query().Get("ip"))
+		if err != nil {
+			http.Error(w, "Invalid IP address", http.StatusBadRequest)
+			return
+		}
+		if !a.Servers.RemoveBan(prefix) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		ban := banset.Entry{Prefix: prefix}
+		slog.Info("Admin unbanned", "ip", ban.Address())
+		a.finish(w, http.StatusOK, map[string]string{"ip": ban.Address()})
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleOfficial(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"officialServers": a.Servers.GetOfficial()})
+
+	case http.MethodPost:
+		req, err := readAdminRequest(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		cfg := a.Servers.GetConfig()
+		cfg.OfficialServers = append(append([]string{}, cfg.OfficialServers...), req.Address)
+		if !validChange(w, cfg) {
+			return
+		}
+		if !a.Servers.AddOfficial(req.Address) {
+			http.Error(w, "Already official", http.StatusConflict)
+			return
+		}
+		slog.Info("Admin added official server", "address", req.Address)
+		a.finish(w, http.StatusCreated, map[string]string{"address": req.Address})
+
+	case http.MethodDelete:
+		addr := r.URL.Query().Get("address")
+		if !a.Servers.RemoveOfficial(addr) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		slog.Info("Admin removed official server", "address", addr)
+		a.finish(w, http.StatusOK, map[string]string{"address": addr})
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleEntries(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"entries": a.Servers.GetEntries()})
+
+	case http.MethodDelete:
+		addr, _, ok := config.CanonicalServerAddr(r.URL.Query().Get("address"))
+		if !ok || !a.Servers.Evict(addr) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		slog.Info("Admin evicted", "address", addr)
+		writeAdminJSON(w, http.StatusOK, map[string]string{"address": addr})
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handlePin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		req, err := readAdminRequest(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		addr, _, ok := config.CanonicalServerAddr(req.Address)
+		if !ok {
+			http.Error(w, "Invalid address", http.StatusBadRequest)
+			return
+		}
+		a.Servers.SetPinned(addr, true)
+		slog.Info("Admin pinned", "address", addr)
+		writeAdminJSON(w, http.StatusOK, map[string]string{"address": addr})
+
+	case http.MethodDelete:
+		addr, _, ok := config.CanonicalServerAddr(r.URL.Query().Get("address"))
+		if !ok || !a.Servers.SetPinned(addr, false) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		slog.Info("Admin unpinned", "address", addr)
+		writeAdminJSON(w, http.StatusOK, map[string]string{"address": addr})
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) handleRegistrations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		regs := []adminRegistration{}
+		for _, reg := range a.Servers.GetRegistrations() {
+			regs = append(regs, adminRegistration{Address: reg.Address, Policy: reg.Policy})
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"registrations": regs})
+
+	case http.MethodPost:
+		// Issues a token for the address, replacing any previous one
+		req, err := readAdminRequest(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		addr, _, ok := config.CanonicalServerAddr(req.Address)
+		if !ok {
+			http.Error(w, "Invalid address", http.StatusBadRequest)
+			return
+		}
+		policy := req.Policy
+		if policy == "" {
+			policy = config.PolicyRequired
+		}
+		token, err := reportsig.GenerateToken()
+		if err != nil {
+			slog.Error("Error generating registration token", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		reg := config.Registration{Address: addr, Token: token, Policy: policy}
+		cfg := a.Servers.GetConfig()
+		cfg.Registrations = maps.Clone(cfg.Registrations)
+		if cfg.Registrations == nil {
+			cfg.Registrations = make(map[string]config.Registration)
+		}
+		cfg.Registrations[addr] = reg
+		if !validChange(w, cfg) {
+			return
+		}
+		a.Servers.SetRegistration(reg)
+		slog.Info("Admin issued registration token", "address", addr)
+		a.finish(w, http.StatusCreated, adminRegistration{Address: addr, Policy: policy, Token: token})
+
+	case http.MethodDelete:
+		addr, _, ok := config.CanonicalServerAddr(r.URL.Query().Get("address"))
+		if !ok || !a.Servers.RemoveRegistration(addr) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		slog.Info("Admin revoked registration", "address", addr)
+		a.finish(w, http.StatusOK, map[string]string{"address": addr})
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
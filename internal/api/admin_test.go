@@ -0,0 +1,295 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/reportsig"
+	"lusd/internal/store"
+)
+
+const testAdminToken = "test-admin-token-0123456789"
+
+// persistedState is the state file admin changes are written to
+type persistedState struct {
+	Blacklist []string `json:"blacklist"`
+	Bans      []struct {
+		IP      string `json:"ip"`
+		Expires string `json:"expires"`
+	} `json:"bans"`
+	Registration struct {
+		Servers []struct {
+			Token string `json:"token"`
+		} `json:"servers"`
+	} `json:"registration"`
+}
+
+func newAdminTestMux(t *testing.T, persist bool) (*http.ServeMux, *store.ServerList, string) {
+	t.Helper()
+	statePath := filepath.Join(t.TempDir(), config.StateFile)
+
+	cfg := config.Default()
+	cfg.StaleTimeout = time.Minute
+	cfg.AdminToken = testAdminToken
+	cfg.AdminPersist = persist
+	servers := store.New(cfg)
+	admin := &API{Servers: servers, StatePath: statePath}
+	mux := http.NewServeMux()
+	admin.registerAdmin(mux, func(next http.HandlerFunc) http.HandlerFunc { return next })
+	return mux, servers, statePath
+}
+
+func doAdminRequest(mux *http.ServeMux, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+// signedForm builds the form fields of a signed report
+func signedForm(token string, port int, ts time.Time, nonce string) url.Values {
+	return url.Values{
+		"port":  {strconv.Itoa(port)},
+		"ts":    {strconv.FormatInt(ts.Unix(), 10)},
+		"nonce": {nonce},
+		"sig":   {reportsig.Sign(token, port, ts.Unix(), nonce)},
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	mux, _, _ := newAdminTestMux(t, false)
+
+	req := httptest.NewRequest("GET", "/admin/bans", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, got %d", w.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with wrong token, got %d", w.Code)
+	}
+
+	if w := doAdminRequest(mux, "GET", "/admin/bans", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with token, got %d", w.Code)
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	mux, servers, statePath := newAdminTestMux(t, true)
+	servers.Report("10.0.0.1", 2301)
+
+	if w := doAdminRequest(mux, "POST", "/admin/bans", `{"ip": "10.0.0.1"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if !servers.IsBlacklisted("10.0.0.1") {
+		t.Error("Expected IP to be blacklisted")
+	}
+	if len(servers.GetActive()) != 0 {
+		t.Error("Expected banned server to be evicted")
+	}
+
+	// The ban is written to the state file
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatalf("Failed to read state: %v", err)
+	}
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("Failed to parse state: %v", err)
+	}
+	if len(state.Blacklist) != 1 || state.Blacklist[0] != "10.0.0.1" {
+		t.Errorf("Unexpected persisted state: %+v", state)
+	}
+
+	if w := doAdminRequest(mux, "POST", "/admin/bans", `{"ip": "bogus"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid IP, got %d", w.Code)
+	}
+	if w := doAdminRequest(mux, "DELETE", "/admin/bans?ip=10.0.0.1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if w := doAdminRequest(mux, "DELETE", "/admin/bans?ip=10.0.0.1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown ban, got %d", w.Code)
+	}
+}
+
+func TestAdminCIDRBans(t *testing.T) {
+	mux, servers, statePath := newAdminTestMux(t, true)
+	servers.Report("10.1.2.3", 2301)
+	servers.Report("10.2.0.1", 2301)
+
+	body := `{"ip": "10.1.0.0/16", "reason": "hosting range", "duration": "1h"}`
+	if w := doAdminRequest(mux, "POST", "/admin/bans", body); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if !servers.IsBlacklisted("10.1.200.1") || !servers.IsBlacklisted("::ffff:10.1.0.1") || servers.IsBlacklisted("10.2.0.1") {
+		t.Error("Expected exactly the /16 to be banned")
+	}
+	if active := servers.GetActive(); len(active) != 1 || active[0] != "10.2.0.1:2301" {
+		t.Errorf("Expected servers inside the range to be evicted, got %v", active)
+	}
+
+	w := doAdminRequest(mux, "GET", "/admin/bans", "")
+	var resp struct {
+		Bans []adminBan `json:"bans"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(resp.Bans) != 1 || resp.Bans[0].IP != "10.1.0.0/16" || resp.Bans[0].Reason != "hosting range" || resp.Bans[0].Expires == nil {
+		t.Errorf("Unexpected bans: %+v", resp.Bans)
+	}
+
+	// Bans with a reason or expiry are persisted to the bans list
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatalf("Failed to read state: %v", err)
+	}
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("Failed to parse state: %v", err)
+	}
+	if len(state.Blacklist) != 0 || len(state.Bans) != 1 || state.Bans[0].IP != "10.1.0.0/16" || state.Bans[0].Expires == "" {
+		t.Errorf("Unexpected persisted bans: %+v %+v", state.Blacklist, state.Bans)
+	}
+
+	for _, body := range []string{
+		`{"ip": "10.0.0.0/33"}`,
+		`{"ip": "10.0.0.1", "duration": "-1h"}`,
+		`{"ip": "10.0.0.1", "expires": "2000-01-01T00:00:00Z"}`,
+		`{"ip": "10.0.0.1", "expires": "2099-01-01T00:00:00Z", "duration": "1h"}`,
+	} {
+		if w := doAdminRequest(mux, "POST", "/admin/bans", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	if w := doAdminRequest(mux, "DELETE", "/admin/bans?ip=10.1.9.9/16", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for the masked prefix, got %d", w.Code)
+	}
+}
+
+func TestAdminOfficialAndEntries(t *testing.T) {
+	mux, servers, _ := newAdminTestMux(t, false)
+
+	if w := doAdminRequest(mux, "POST", "/admin/official", `{"address": "10.0.0.5:2301"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", w.Code)
+	}
+	if w := doAdminRequest(mux, "POST", "/admin/official", `{"address": "10.0.0.5:2301"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for duplicate, got %d", w.Code)
+	}
+	// Changes go through the same validation as the config file
+	w := doAdminRequest(mux, "POST", "/admin/official", `{"address": "lusd.example.org"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `officialServers[1]: must be an IP address`) {
+		t.Errorf("Expected status 400 naming the invalid field, got %d %s", w.Code, w.Body.String())
+	}
+	if official := servers.GetOfficial(); len(official) != 1 || official[0] != "10.0.0.5:2301" {
+		t.Errorf("Unexpected official list: %v", official)
+	}
+
+	// Pinned entries survive going stale
+	if w := doAdminRequest(mux, "POST", "/admin/entries/pin", `{"address": "10.0.0.6:2301"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	servers.Lock()
+	servers.Entries["10.0.0.6:2301"].LastSeen = time.Now().Add(-time.Hour).Unix()
+	servers.Unlock()
+	if active := servers.GetActive(); len(active) != 2 {
+		t.Errorf("Expected pinned and official servers, got %v", active)
+	}
+
+	if w := doAdminRequest(mux, "DELETE", "/admin/entries?address=10.0.0.6:2301", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if w := doAdminRequest(mux, "DELETE", "/admin/entries?address=10.0.0.6:2301", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for evicted entry, got %d", w.Code)
+	}
+	if w := doAdminRequest(mux, "DELETE", "/admin/official?address=10.0.0.5:2301", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if active := servers.GetActive(); len(active) != 0 {
+		t.Errorf("Expected empty list, got %v", active)
+	}
+}
+
+func TestAdminPinCanonicalAddress(t *testing.T) {
+	mux, servers, _ := newAdminTestMux(t, false)
+	servers.Report("1.2.3.4", 8000)
+
+	// Other notations of a reported address act on its entry
+	w := doAdminRequest(mux, "POST", "/admin/entries/pin", `{"address": "1.2.3.4:08000"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"1.2.3.4:8000"`) {
+		t.Fatalf("Expected the canonical address to be pinned, got %d %s", w.Code, w.Body.String())
+	}
+	if entries := servers.GetEntries(); len(entries) != 1 {
+		t.Errorf("Expected no stray entry, got %+v", entries)
+	}
+	mapped := url.QueryEscape("[::ffff:1.2.3.4]:8000")
+	if w := doAdminRequest(mux, "DELETE", "/admin/entries/pin?address="+mapped, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 unpinning an IPv4-mapped address, got %d", w.Code)
+	}
+	if w := doAdminRequest(mux, "DELETE", "/admin/entries?address=1.2.3.4:08000", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 evicting a non-canonical address, got %d", w.Code)
+	}
+	if w := doAdminRequest(mux, "POST", "/admin/entries/pin", `{"address": "1.2.3.4:0"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for port 0, got %d", w.Code)
+	}
+}
+
+func TestAdminRegistrations(t *testing.T) {
+	mux, servers, statePath := newAdminTestMux(t, true)
+
+	w := doAdminRequest(mux, "POST", "/admin/registrations", `{"address": "10.0.0.1:2301"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var issued adminRegistration
+	if err := json.Unmarshal(w.Body.Bytes(), &issued); err != nil || len(issued.Token) != 2*reportsig.TokenBytes || issued.Policy != config.PolicyRequired {
+		t.Fatalf("Unexpected registration response: %s", w.Body.String())
+	}
+
+	// The issued token signs reports
+	form := signedForm(issued.Token, 2301, time.Now(), "nonce-0001")
+	if signed, err := servers.VerifyReport(netip.MustParseAddr("10.0.0.1"), 2301, form, time.Now()); !signed || err != nil {
+		t.Errorf("Expected report signed with the issued token to verify, got %v, %v", signed, err)
+	}
+
+	// Tokens are persisted but never listed
+	data, _ := os.ReadFile(statePath)
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil || len(state.Registration.Servers) != 1 || state.Registration.Servers[0].Token != issued.Token {
+		t.Errorf("Expected registration to be persisted, got %s", data)
+	}
+	w = doAdminRequest(mux, "GET", "/admin/registrations", "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), issued.Token) {
+		t.Errorf("Expected listing without tokens, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := doAdminRequest(mux, "POST", "/admin/registrations", `{"address": "10.0.0.1:2301", "policy": "never"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid policy, got %d", w.Code)
+	}
+
+	if w := doAdminRequest(mux, "DELETE", "/admin/registrations?address=10.0.0.1:2301", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if len(servers.GetRegistrations()) != 0 {
+		t.Error("Expected registration to be revoked")
+	}
+	if w := doAdminRequest(mux, "DELETE", "/admin/registrations?address=10.0.0.1:2301", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
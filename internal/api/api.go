@@ -0,0 +1,120 @@
+// Package api serves the public HTTP endpoints of the directory and the
+// admin API.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"lusd/internal/events"
+	"lusd/internal/federation"
+	"lusd/internal/history"
+	"lusd/internal/metrics"
+	"lusd/internal/store"
+	"lusd/internal/webhook"
+)
+
+// API holds what the handlers need. Settings are read from the current
+// config of Servers on every request so they follow config reloads.
+type API struct {
+	Servers    *store.ServerList
+	Metrics    *metrics.Metrics
+	Federation *federation.Federation // optional, serves the feed and receives pushes from peers
+	Events     *events.Bus            // optional, streamed at /api/v1/events
+	Webhooks   *webhook.Dispatcher    // optional, notified of repeated blacklist drops
+	History    *history.Recorder      // optional, served at /api/v1/servers/{addr}/history
+	StatePath  string                 // state file admin changes are persisted to
+	Version    string
+	StartTime  time.Time
+}
+
+// Register adds every route to mux behind the given middleware
+func (a *API) Register(mux *http.ServeMux, middleware func(http.HandlerFunc) http.HandlerFunc) {
+	mux.HandleFunc("/report.php", middleware(a.handleReport))
+	mux.HandleFunc("/servers.txt", middleware(a.handleServersTxt))
+	mux.HandleFunc("/official.txt", middleware(a.handleOfficialTxt))
+	mux.HandleFunc("/servers.json", middleware(a.handleServersJSON))
+	mux.HandleFunc("/api/v1/servers", middleware(a.handleServersAPI))
+	mux.HandleFunc("/api/v1/servers/{addr}/history", middleware(a.handleHistory))
+	mux.HandleFunc("/api/v1/events", middleware(a.handleEvents))
+	mux.HandleFunc("/api/v1/stats", middleware(a.handleStats))
+	mux.HandleFunc("/health", middleware(a.handleHealth))
+	mux.HandleFunc("/version", middleware(a.handleVersion))
+
+	// Federation feed for peer directories, and pushes from them
+	if a.Federation != nil {
+		mux.HandleFunc(federation.FeedPath, middleware(a.Federation.Handler()))
+	}
+
+	// Runtime administration, only answers once an admin token is configured
+	a.registerAdmin(mux, middleware)
+
+	// Server browser, stats page and admin dashboard
+	a.registerUI(mux, middleware)
+}
+
+func (a *API) handleServersTxt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	active := a.Servers.GetActive()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	_, _ = w.Write([]byte(strings.Join(active, "\n")))
+}
+
+func (a *API) handleOfficialTxt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	_, _ = w.Write([]byte(strings.Join(a.Servers.GetOfficial(), "\n")))
+}
+
+func (a *API) handleServersJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"servers": a.Servers.GetRecords(),
+	})
+}
+
+// handleHealth is the health check endpoint
+func (a *API) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	health := map[string]interface{}{
+		"status":        "ok",
+		"version":       a.Version,
+		"timestamp":     time.Now().Unix(),
+		"uptime":        time.Since(a.StartTime).Seconds(),
+		"activeServers": len(a.Servers.GetActive()),
+	}
+	json.NewEncoder(w).Encode(health)
+}
+
+func (a *API) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	version := map[string]string{
+		"version": a.Version,
+	}
+	json.NewEncoder(w).Encode(version)
+}
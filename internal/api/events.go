@@ -0,0 +1,351 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lusd/internal/events"
+)
+
+// Event stream constants
+const (
+	eventsKeepAlive    = 30 * time.Second // comment or ping sent on an idle stream
+	eventsWriteTimeout = 10 * time.Second // per write, so stuck clients are dropped
+	eventsRetryAfter   = 5 * time.Second  // suggested wait when the subscriber limit is reached
+	eventReset         = "reset"          // sent when a client cannot be resumed
+
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxFrameSize = 4096 // largest frame accepted from clients, which only send control frames
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+
+	wsCloseGoingAway = 1001
+	wsCloseTooBig    = 1009
+)
+
+// handleEvents streams changes of the server list as server-sent events,
+// or over a WebSocket if the client asks for an upgrade. Clients resume
+// with the Last-Event-ID header or the lastEventId parameter.
+func (a *API) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if a.Events == nil || !a.Servers.GetConfig().EventsEnabled {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lastID, err := lastEventID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	upgrade := isWebSocket(r)
+	var accept string
+	if upgrade {
+		if accept, err = wsAccept(r); err != nil {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub, missed, resumed, err := a.Events.Subscribe(lastID)
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(eventsRetryAfter/time.Second)))
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+
+	// A client whose events are gone has to fetch the list again
+	if lastID > 0 && !resumed {
+		missed = []events.Event{{Type: eventReset, Time: time.Now().Unix(), Data: json.RawMessage("{}")}}
+	}
+
+	if upgrade {
+		streamWebSocket(w, accept, sub, missed)
+	} else {
+		streamSSE(w, r, sub, missed)
+	}
+}
+
+// lastEventID returns the ID of the last event the client received, zero
+// for a new client
+func lastEventID(r *http.Request) (uint64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("lastEventId")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lastEventId parameter")
+	}
+	return id, nil
+}
+
+// streamSSE writes the missed events and then every new event as
+// text/event-stream until the client goes away or the subscription ends
+func streamSSE(w http.ResponseWriter, r *http.Request, sub *events.Subscription, missed []events.Event) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // no buffering in nginx
+	w.WriteHeader(http.StatusOK)
+
+	write := func(format string, args ...any) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	send := func(e events.Event) bool {
+		body, _ := json.Marshal(e)
+		if e.ID == 0 {
+			// An empty id makes browsers forget the last one
+			return write("id\nevent: %s\ndata: %s\n\n", e.Type, body)
+		}
+		return write("id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, body)
+	}
+
+	if !write("retry: %d\n\n", eventsRetryAfter.Milliseconds()) {
+		return
+	}
+	for _, e := range missed {
+		if !send(e) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return // the client reconnects and resumes
+			}
+			if !send(e) {
+				return
+			}
+		case <-keepAlive.C:
+			if !write(": keepalive\n\n") {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// isWebSocket reports whether r asks for a WebSocket upgrade
+func isWebSocket(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsAccept checks the handshake of r and returns its Sec-WebSocket-Accept
+// value
+func wsAccept(r *http.Request) (string, error) {
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return "", fmt.Errorf("unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return "", fmt.Errorf("invalid Sec-WebSocket-Key")
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// wsConn is an upgraded connection. Writes come from the event loop and
+// from the reader answering pings, so they are serialized.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	mu   sync.Mutex
+}
+
+// streamWebSocket upgrades the connection and writes the missed events
+// and then every new event as a text message until either side closes
+func streamWebSocket(w http.ResponseWriter, accept string, sub *events.Subscription, missed []events.Event) {
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	// The server's timeouts no longer apply, the loops set their own
+	_ = conn.SetDeadline(time.Time{})
+
+	_, err = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err != nil || rw.Flush() != nil {
+		return
+	}
+	ws := &wsConn{conn: conn, rw: rw}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.readLoop()
+	}()
+
+	send := func(e events.Event) bool {
+		body, _ := json.Marshal(e)
+		return ws.write(wsOpText, body) == nil
+	}
+	for _, e := range missed {
+		if !send(e) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				_ = ws.write(wsOpClose, wsClosePayload(wsCloseGoingAway))
+				return
+			}
+			if !send(e) {
+				return
+			}
+		case <-keepAlive.C:
+			if ws.write(wsOpPing, nil) != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// readLoop answers pings and closes until the client closes the connection
+// or sends something invalid. Messages from the client are ignored.
+func (ws *wsConn) readLoop() {
+	for {
+		op, payload, err := readFrame(ws.rw.Reader)
+		if err != nil {
+			if errors.Is(err, errFrameTooBig) {
+				_ = ws.write(wsOpClose, wsClosePayload(wsCloseTooBig))
+			}
+			return
+		}
+		switch op {
+		case wsOpClose:
+			_ = ws.write(wsOpClose, payload[:min(len(payload), 2)])
+			return
+		case wsOpPing:
+			if ws.write(wsOpPong, payload) != nil {
+				return
+			}
+		}
+	}
+}
+
+// write sends one unfragmented, unmasked frame
+func (ws *wsConn) write(op byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+
+	header := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if _, err := ws.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := ws.rw.Write(payload); err != nil {
+		return err
+	}
+	return ws.rw.Flush()
+}
+
+var errFrameTooBig = errors.New("frame too big")
+
+// readFrame reads one frame from a client, which must be masked
+func readFrame(r *bufio.Reader) (op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	op = header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("unmasked client frame")
+	}
+
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxFrameSize {
+		return 0, nil, errFrameTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
+
+// wsClosePayload is the body of a close frame with code
+func wsClosePayload(code uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, code)
+}
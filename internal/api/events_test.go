@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/events"
+	"lusd/internal/store"
+)
+
+func newEventsTestServer(t *testing.T, maxSubscribers int) (*httptest.Server, *store.ServerList, *events.Bus) {
+	t.Helper()
+	servers := store.New(config.Config{StaleTimeout: time.Minute, Blacklist: banset.New(), EventsEnabled: true})
+	bus := events.New(events.Options{History: 16, MaxSubscribers: maxSubscribers, Buffer: 16})
+	servers.PublishEvents(bus)
+	mux := http.NewServeMux()
+	(&API{Servers: servers, Events: bus}).Register(mux, func(h http.HandlerFunc) http.HandlerFunc { return h })
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		bus.Close()
+		srv.Close()
+	})
+	return srv, servers, bus
+}
+
+// readSSE returns the fields of the next event of stream, skipping
+// comments and the retry hint
+func readSSE(t *testing.T, stream *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if fields["event"] != "" {
+				return fields
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		fields[name] = strings.TrimPrefix(value, " ")
+	}
+}
+
+func TestEventsSSE(t *testing.T) {
+	srv, servers, bus := newEventsTestServer(t, 1)
+
+	resp, err := http.Get(srv.URL + "/api/v1/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// The subscriber limit applies while the stream is open
+	if full, err := http.Get(srv.URL + "/api/v1/events"); err != nil || full.StatusCode != http.StatusServiceUnavailable || full.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %v %v", full, err)
+	}
+
+	servers.ReportInfo("192.0.2.1", 2301, &store.ServerInfo{Name: "DM"})
+	stream := bufio.NewReader(resp.Body)
+	fields := readSSE(t, stream)
+	var e events.Event
+	if err := json.Unmarshal([]byte(fields["data"]), &e); err != nil || fields["event"] != store.EventServerAdded || fields["id"] != "1" || e.ID != 1 {
+		t.Fatalf("Expected server_added with id 1, got %v: %v", fields, err)
+	}
+	resp.Body.Close()
+
+	// A client that missed events gets them on reconnect
+	servers.Evict("192.0.2.1:2301")
+	waitSubscribers(t, bus, 0)
+	req, _ := http.NewRequest("GET", srv.URL+"/api/v1/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if fields := readSSE(t, bufio.NewReader(resp.Body)); fields["event"] != store.EventServerRemoved || fields["id"] != "2" {
+		t.Errorf("Expected the missed server_removed, got %v", fields)
+	}
+	resp.Body.Close()
+
+	// An unknown ID asks the client to start over
+	waitSubscribers(t, bus, 0)
+	resp, err = http.Get(srv.URL + "/api/v1/events?lastEventId=99")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if fields := readSSE(t, bufio.NewReader(resp.Body)); fields["event"] != eventReset || fields["id"] != "" {
+		t.Errorf("Expected a reset, got %v", fields)
+	}
+}
+
+// waitSubscribers waits until bus has noticed that closed streams are gone
+func waitSubscribers(t *testing.T, bus *events.Bus, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); bus.Subscribers() > n; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d subscribers, got %d", n, bus.Subscribers())
+		}
+	}
+}
+
+func TestEventsWebSocket(t *testing.T) {
+	srv, servers, _ := newEventsTestServer(t, 1)
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Example key and accept value from RFC 6455
+	fmt.Fprintf(conn, "GET /api/v1/events HTTP/1.1\r\nHost: lusd\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected the upgrade, got %v %v", resp, err)
+	}
+
+	servers.ReportInfo("192.0.2.1", 2301, &store.ServerInfo{Name: "DM"})
+	op, payload, err := readServerFrame(r)
+	if err != nil || op != wsOpText {
+		t.Fatalf("Expected a text frame, got %x %v", op, err)
+	}
+	var e events.Event
+	if err := json.Unmarshal(payload, &e); err != nil || e.Type != store.EventServerAdded || e.ID != 1 {
+		t.Errorf("Expected server_added, got %s: %v", payload, err)
+	}
+
+	// A masked close frame is answered with a close frame
+	mask := []byte{1, 2, 3, 4}
+	body := binary.BigEndian.AppendUint16(nil, 1000)
+	for i := range body {
+		body[i] ^= mask[i%4]
+	}
+	conn.Write(append(append([]byte{0x80 | wsOpClose, 0x80 | byte(len(body))}, mask...), body...))
+	if op, payload, err := readServerFrame(r); err != nil || op != wsOpClose || binary.BigEndian.Uint16(payload) != 1000 {
+		t.Errorf("Expected a close frame, got %x %v", op, err)
+	}
+}
+
+// readServerFrame reads one frame sent by the server, which must not be
+// masked
+func readServerFrame(r io.Reader) (op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		return 0, nil, fmt.Errorf("unexpected frame header %x", header)
+	}
+	n := uint64(header[1])
+	switch n {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(r, ext[:])
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(r, ext[:])
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, n)
+	_, err = io.ReadFull(r, payload)
+	return header[0] & 0x0F, payload, err
+}
+
+func TestEventsDisabled(t *testing.T) {
+	srv, servers, _ := newEventsTestServer(t, 1)
+	cfg := servers.GetConfig()
+	cfg.EventsEnabled = false
+	servers.SetConfig(cfg)
+	if resp, err := http.Get(srv.URL + "/api/v1/events"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 while disabled, got %v %v", resp, err)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"lusd/internal/history"
+)
+
+// resolutions maps the resolution parameter of the history endpoint
+var resolutions = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+}
+
+// apiHistory is the response body of /api/v1/servers/{addr}/history
+type apiHistory struct {
+	Address    string `json:"address"`
+	Resolution string `json:"resolution"`
+	history.Report
+}
+
+// handleHistory serves the uptime and player counts of one server, per
+// minute for the last day or per hour for the last month
+func (a *API) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if a.History == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resolution := r.URL.Query().Get("resolution")
+	if resolution == "" {
+		resolution = "hour"
+	}
+	step, ok := resolutions[resolution]
+	if !ok {
+		http.Error(w, "invalid resolution parameter", http.StatusBadRequest)
+		return
+	}
+
+	addr := r.PathValue("addr")
+	report, ok := a.History.Get(addr, time.Now(), step)
+	if !ok {
+		http.Error(w, "No history for this server", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	json.NewEncoder(w).Encode(apiHistory{Address: addr, Resolution: resolution, Report: report})
+}
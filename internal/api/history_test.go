@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lusd/internal/history"
+)
+
+func TestHistoryEndpoint(t *testing.T) {
+	h := history.New(filepath.Join(t.TempDir(), history.File), 10)
+	h.Listed("10.0.0.1:2301", time.Now(), 10)
+	h.Heartbeat("10.0.0.1:2301", time.Now())
+	mux := http.NewServeMux()
+	(&API{Servers: newAPITestServers(t), History: h}).Register(mux, func(next http.HandlerFunc) http.HandlerFunc { return next })
+
+	get := func(path string) (int, apiHistory) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var body apiHistory
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+		}
+		return w.Code, body
+	}
+
+	code, body := get("/api/v1/servers/10.0.0.1:2301/history?resolution=minute")
+	if code != http.StatusOK || body.Address != "10.0.0.1:2301" || body.Resolution != "minute" || len(body.Points) != 1 {
+		t.Fatalf("Unexpected response %d %+v", code, body)
+	}
+	if p := body.Points[0]; p.Up != 1 || p.Reports != 1 || p.PeakPlayers != 10 {
+		t.Errorf("Unexpected point %+v", p)
+	}
+	if code, body := get("/api/v1/servers/10.0.0.1:2301/history"); code != http.StatusOK || body.Resolution != "hour" || len(body.Points) != 1 {
+		t.Errorf("Expected hourly history by default, got %d %+v", code, body)
+	}
+
+	if code, _ := get("/api/v1/servers/10.0.0.1:2301/history?resolution=day"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid resolution, got %d", code)
+	}
+	if code, _ := get("/api/v1/servers/10.0.0.9:2301/history"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown server, got %d", code)
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"lusd/internal/metrics"
+	"lusd/internal/middleware"
+	"lusd/internal/store"
+)
+
+// maxReportBodySize limits /report.php form bodies
+const maxReportBodySize = 1024 // 1KB limit
+
+// rejectReport counts a rejected report and logs the reason as its outcome
+func (a *API) rejectReport(r *http.Request, reason string) {
+	a.Metrics.ReportRejected(reason)
+	middleware.SetOutcome(r, reason)
+}
+
+// handleReport receives the heartbeats of game servers
+func (a *API) handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		a.rejectReport(r, metrics.RejectBadRequest)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.UserAgent() != a.Servers.GetConfig().AllowedUserAgent {
+		a.rejectReport(r, metrics.RejectBadUserAgent)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Parse form with size limit
+	r.Body = http.MaxBytesReader(w, r.Body, maxReportBodySize)
+	if err := r.ParseForm(); err != nil {
+		a.rejectReport(r, metrics.RejectBadRequest)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	portStr := r.FormValue("port")
+	if portStr == "" {
+		a.rejectReport(r, metrics.RejectBadPort)
+		http.Error(w, "Missing port parameter", http.StatusBadRequest)
+		return
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err == nil {
+		middleware.SetPort(r, port)
+	}
+	if err != nil || port < 1024 || port > 65535 {
+		a.rejectReport(r, metrics.RejectBadPort)
+		http.Error(w, "Invalid port", http.StatusBadRequest)
+		return
+	}
+
+	// Optional metadata sent by newer servers
+	info, err := parseReportInfo(r.Form)
+	if err != nil {
+		a.rejectReport(r, metrics.RejectBadRequest)
+		http.Error(w, "Invalid server info", http.StatusBadRequest)
+		return
+	}
+
+	// Validate IP address
+	addr, ok := middleware.ClientIP(r)
+	if !ok {
+		a.rejectReport(r, metrics.RejectBadRequest)
+		http.Error(w, "Invalid IP address", http.StatusBadRequest)
+		return
+	}
+	ip := addr.String()
+	if a.Servers.IsBlacklisted(ip) {
+		// Silent drop for blacklisted IPs
+		a.rejectReport(r, metrics.RejectBlacklisted)
+		a.Webhooks.Abuse(addr, metrics.RejectBlacklisted)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Check the signature policy of this server
+	signed, err := a.Servers.VerifyReport(addr, port, r.Form, time.Now())
+	if err != nil {
+		a.rejectReport(r, metrics.RejectBadSignature)
+		middleware.SetError(r, err)
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+
+	a.Servers.ReportSigned(ip, port, info, signed)
+	a.Metrics.ReportAccepted()
+	middleware.SetOutcome(r, middleware.OutcomeAccepted)
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseReportInfo reads the optional metadata fields of a /report.php form.
+// Returns nil without error when the legacy client sent none of them.
+func parseReportInfo(form url.Values) (*store.ServerInfo, error) {
+	fields := []string{"name", "gamemode", "players", "maxplayers", "password"}
+	present := false
+	for _, field := range fields {
+		if _, ok := form[field]; ok {
+			present = true
+			break
+		}
+	}
+	if !present {
+		return nil, nil
+	}
+
+	info := &store.ServerInfo{
+		Name:     form.Get("name"),
+		Gamemode: form.Get("gamemode"),
+	}
+
+	var err error
+	if v := form.Get("players"); v != "" {
+		if info.Players, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid players")
+		}
+	}
+	if v := form.Get("maxplayers"); v != "" {
+		if info.MaxPlayers, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid max players")
+		}
+	}
+	if v := form.Get("password"); v != "" {
+		if info.Password, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid password flag")
+		}
+	}
+
+	if err := info.Validate(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
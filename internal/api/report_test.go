@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/metrics"
+	"lusd/internal/middleware"
+	"lusd/internal/ratelimit"
+	"lusd/internal/store"
+)
+
+// newReportTestAPI returns an API whose routes are served without the
+// security middleware, with the client address taken from RemoteAddr
+func newReportTestAPI(t *testing.T, cfg config.Config) (*API, http.Handler) {
+	t.Helper()
+	a := &API{Servers: store.New(cfg), Metrics: metrics.New()}
+	limiter := ratelimit.New(ratelimit.Options{MaxKeys: 100, IdleTimeout: time.Minute})
+	mux := http.NewServeMux()
+	a.Register(mux, middleware.Security(a.Servers.GetConfig, limiter, a.Metrics, nil))
+	return a, mux
+}
+
+// postReport sends a report from 192.0.2.1, the httptest client address
+func postReport(handler http.Handler, userAgent string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/report.php", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestReportEndpoint(t *testing.T) {
+	a, handler := newReportTestAPI(t, config.Config{
+		AllowedUserAgent: "LU-Server/0.1",
+		StaleTimeout:     time.Minute,
+		Blacklist:        banset.New(),
+	})
+
+	if w := postReport(handler, "LU-Server/0.1", url.Values{"port": {"2301"}, "name": {"Test"}}); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if active := a.Servers.GetActive(); len(active) != 1 || active[0] != "192.0.2.1:2301" {
+		t.Errorf("Expected the reported server to be listed, got %v", active)
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		form      url.Values
+		expected  int
+	}{
+		{"invalid user agent", "Invalid", url.Values{"port": {"2301"}}, http.StatusForbidden},
+		{"missing port", "LU-Server/0.1", url.Values{}, http.StatusBadRequest},
+		{"privileged port", "LU-Server/0.1", url.Values{"port": {"80"}}, http.StatusBadRequest},
+		{"invalid info", "LU-Server/0.1", url.Values{"port": {"2301"}, "players": {"abc"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := postReport(handler, tt.userAgent, tt.form); w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/report.php", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for invalid method, got %d", w.Code)
+	}
+}
+
+func TestReportBlacklisted(t *testing.T) {
+	set := banset.New()
+	prefix, _ := banset.ParsePrefix("192.0.2.1")
+	set.Add(banset.Entry{Prefix: prefix})
+	a, handler := newReportTestAPI(t, config.Config{
+		AllowedUserAgent: "LU-Server/0.1",
+		StaleTimeout:     time.Minute,
+		Blacklist:        set,
+	})
+
+	// Blacklisted servers are dropped silently
+	if w := postReport(handler, "LU-Server/0.1", url.Values{"port": {"2301"}}); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if active := a.Servers.GetActive(); len(active) != 0 {
+		t.Errorf("Expected blacklisted server not to be listed, got %v", active)
+	}
+}
+
+func TestParseReportInfo(t *testing.T) {
+	// Legacy reports carry no metadata
+	info, err := parseReportInfo(url.Values{"port": {"2301"}})
+	if err != nil || info != nil {
+		t.Errorf("Expected no info for legacy report, got %+v, %v", info, err)
+	}
+
+	form := url.Values{
+		"port":       {"2301"},
+		"name":       {"  My\x00 Server\n"},
+		"gamemode":   {strings.Repeat("x", 100)},
+		"players":    {"5"},
+		"maxplayers": {"32"},
+		"password":   {"1"},
+	}
+	info, err = parseReportInfo(form)
+	if err != nil {
+		t.Fatalf("parseReportInfo failed: %v", err)
+	}
+	if info.Name != "My Server" {
+		t.Errorf("Expected sanitized name 'My Server', got %q", info.Name)
+	}
+	if len(info.Gamemode) != 32 {
+		t.Errorf("Expected gamemode capped at 32, got %d", len(info.Gamemode))
+	}
+	if info.Players != 5 || info.MaxPlayers != 32 || !info.Password {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+
+	invalid := []url.Values{
+		{"players": {"abc"}},
+		{"players": {"-1"}},
+		{"maxplayers": {"100000"}},
+		{"players": {"10"}, "maxplayers": {"5"}},
+		{"password": {"maybe"}},
+	}
+	for _, form := range invalid {
+		if _, err := parseReportInfo(form); err == nil {
+			t.Errorf("Expected error for %v", form)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lusd/internal/store"
+)
+
+// Server list API constants
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+	maxQueryLen     = 64
+)
+
+// apiServer is a server entry as returned by /api/v1/servers
+type apiServer struct {
+	Address   string            `json:"address"`
+	Official  bool              `json:"official"`
+	FirstSeen *time.Time        `json:"firstSeen,omitempty"`
+	LastSeen  *time.Time        `json:"lastSeen,omitempty"`
+	Info      *store.ServerInfo `json:"info,omitempty"`
+}
+
+// apiServerList is the response body of /api/v1/servers
+type apiServerList struct {
+	Servers    []apiServer `json:"servers"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// serverQuery holds the parsed query parameters of /api/v1/servers
+type serverQuery struct {
+	OfficialOnly bool
+	HasPlayers   bool
+	NoPassword   bool
+	Name         string
+	Sort         string
+	Desc         bool
+	Limit        int
+	After        *store.ServerRecord
+}
+
+// apiCursor marks the last entry of a page. It stores the sort key of that
+// entry rather than an offset so pages stay consistent while the list changes.
+type apiCursor struct {
+	Sort    string `json:"s"`
+	Desc    bool   `json:"d"`
+	Address string `json:"a"`
+	Name    string `json:"n,omitempty"`
+	Players int    `json:"p,omitempty"`
+	Time    int64  `json:"t,omitempty"`
+}
+
+// sortKeys lists the supported sort parameters
+var sortKeys = map[string]bool{
+	"address":   true,
+	"name":      true,
+	"players":   true,
+	"firstSeen": true,
+	"lastSeen":  true,
+}
+
+// parseBoolParam parses an optional boolean query parameter
+func parseBoolParam(values url.Values, key string) (bool, error) {
+	v := values.Get(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s parameter", key)
+	}
+	return b, nil
+}
+
+// parseServerQuery validates the query parameters of /api/v1/servers
+func parseServerQuery(values url.Values) (*serverQuery, error) {
+	q := &serverQuery{Sort: "address", Limit: defaultPageSize}
+
+	var err error
+	if q.OfficialOnly, err = parseBoolParam(values, "official"); err != nil {
+		return nil, err
+	}
+	if q.HasPlayers, err = parseBoolParam(values, "hasPlayers"); err != nil {
+		return nil, err
+	}
+	if q.NoPassword, err = parseBoolParam(values, "noPassword"); err != nil {
+		return nil, err
+	}
+
+	q.Name = strings.ToLower(strings.TrimSpace(values.Get("q")))
+	if len(q.Name) > maxQueryLen {
+		return nil, fmt.Errorf("search query too long")
+	}
+
+	if v := values.Get("sort"); v != "" {
+		if !sortKeys[v] {
+			return nil, fmt.Errorf("invalid sort parameter")
+		}
+		q.Sort = v
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return nil, fmt.Errorf("invalid order parameter")
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return nil, fmt.Errorf("invalid limit parameter")
+		}
+		q.Limit = limit
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		after, err := decodeCursor(v, q.Sort, q.Desc)
+		if err != nil {
+			return nil, err
+		}
+		q.After = after
+	}
+
+	return q, nil
+}
+
+// encodeCursor builds the cursor pointing after rec
+func encodeCursor(rec store.ServerRecord, sortKey string, desc bool) string {
+	c := apiCursor{Sort: sortKey, Desc: desc, Address: rec.Address}
+	switch sortKey {
+	case "name":
+		if rec.Info != nil {
+			c.Name = rec.Info.Name
+		}
+	case "players":
+		if rec.Info != nil {
+			c.Players = rec.Info.Players
+		}
+	case "firstSeen":
+		c.Time = rec.FirstSeen
+	case "lastSeen":
+		c.Time = rec.LastSeen
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor turns a cursor back into the sort position it marks. The
+// cursor must have been issued for the same sort order.
+func decodeCursor(s, sortKey string, desc bool) (*store.ServerRecord, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c apiCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.Sort != sortKey || c.Desc != desc {
+		return nil, fmt.Errorf("cursor does not match sort order")
+	}
+
+	return &store.ServerRecord{
+		Address:   c.Address,
+		FirstSeen: c.Time,
+		LastSeen:  c.Time,
+		Info:      &store.ServerInfo{Name: c.Name, Players: c.Players},
+	}, nil
+}
+
+// compareRecords orders two records by sortKey, breaking ties by address
+func compareRecords(a, b store.ServerRecord, sortKey string) int {
+	var ai, bi store.ServerInfo
+	if a.Info != nil {
+		ai = *a.Info
+	}
+	if b.Info != nil {
+		bi = *b.Info
+	}
+
+	cmp := 0
+	switch sortKey {
+	case "name":
+		cmp = strings.Compare(strings.ToLower(ai.Name), strings.ToLower(bi.Name))
+	case "players":
+		cmp = ai.Players - bi.Players
+	case "firstSeen":
+		cmp = compareInt64(a.FirstSeen, b.FirstSeen)
+	case "lastSeen":
+		cmp = compareInt64(a.LastSeen, b.LastSeen)
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(a.Address, b.Address)
+	}
+	return cmp
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// matches reports whether rec passes the filters of q
+func (q *serverQuery) matches(rec store.ServerRecord) bool {
+	if q.OfficialOnly && !rec.Official {
+		return false
+	}
+	if q.HasPlayers && (rec.Info == nil || rec.Info.Players == 0) {
+		return false
+	}
+	if q.NoPassword && rec.Info != nil && rec.Info.Password {
+		return false
+	}
+	if q.Name != "" && (rec.Info == nil || !strings.Contains(strings.ToLower(rec.Info.Name), q.Name)) {
+		return false
+	}
+	return true
+}
+
+// queryServers filters, sorts and paginates records according to q
+func queryServers(records []store.ServerRecord, q *serverQuery) apiServerList {
+	var matched []store.ServerRecord
+	for _, rec := range records {
+		if q.matches(rec) {
+			matched = append(matched, rec)
+		}
+	}
+
+	less := func(a, b store.ServerRecord) bool {
+		cmp := compareRecords(a, b, q.Sort)
+		if q.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	result := apiServerList{Servers: []apiServer{}, Total: len(matched)}
+
+	start := 0
+	if q.After != nil {
+		start = sort.Search(len(matched), func(i int) bool { return less(*q.After, matched[i]) })
+	}
+	end := start + q.Limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	for _, rec := range matched[start:end] {
+		result.Servers = append(result.Servers, toAPIServer(rec))
+	}
+	if end < len(matched) {
+		result.NextCursor = encodeCursor(matched[end-1], q.Sort, q.Desc)
+	}
+	return result
+}
+
+// toAPIServer converts a record into its API representation
+func toAPIServer(rec store.ServerRecord) apiServer {
+	s := apiServer{
+		Address:  rec.Address,
+		Official: rec.Official,
+		Info:     rec.Info,
+	}
+	if rec.FirstSeen > 0 {
+		t := time.Unix(rec.FirstSeen, 0).UTC()
+		s.FirstSeen = &t
+	}
+	if rec.LastSeen > 0 {
+		t := time.Unix(rec.LastSeen, 0).UTC()
+		s.LastSeen = &t
+	}
+	return s
+}
+
+// handleServersAPI serves the filtered and paginated server list as JSON
+func (a *API) handleServersAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := parseServerQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	json.NewEncoder(w).Encode(queryServers(a.Servers.GetRecords(), q))
+}
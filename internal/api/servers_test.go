@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/store"
+)
+
+func newAPITestServers(t *testing.T) *store.ServerList {
+	t.Helper()
+	cfg := config.Config{
+		StaleTimeout:    time.Minute,
+		Blacklist:       banset.New(),
+		OfficialServers: []string{"10.0.0.1:2301"},
+	}
+	servers := store.New(cfg)
+	servers.ReportInfo("10.0.0.1", 2301, &store.ServerInfo{Name: "Official DM", Players: 10, MaxPlayers: 32})
+	servers.ReportInfo("10.0.0.2", 2301, &store.ServerInfo{Name: "Empty Freeroam", Players: 0, MaxPlayers: 16})
+	servers.ReportInfo("10.0.0.3", 2301, &store.ServerInfo{Name: "Locked DM", Players: 4, MaxPlayers: 16, Password: true})
+	servers.Report("10.0.0.4", 2301)
+	return servers
+}
+
+func getServersAPI(t *testing.T, servers *store.ServerList, query string) (int, apiServerList) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/v1/servers?"+query, nil)
+	w := httptest.NewRecorder()
+	(&API{Servers: servers}).handleServersAPI(w, req)
+
+	var list apiServerList
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+	}
+	return w.Code, list
+}
+
+func addresses(list apiServerList) []string {
+	var addrs []string
+	for _, s := range list.Servers {
+		addrs = append(addrs, s.Address)
+	}
+	return addrs
+}
+
+func TestServersAPIFilters(t *testing.T) {
+	servers := newAPITestServers(t)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"10.0.0.1:2301", "10.0.0.2:2301", "10.0.0.3:2301", "10.0.0.4:2301"}},
+		{"official=true", []string{"10.0.0.1:2301"}},
+		{"hasPlayers=true", []string{"10.0.0.1:2301", "10.0.0.3:2301"}},
+		{"noPassword=true", []string{"10.0.0.1:2301", "10.0.0.2:2301", "10.0.0.4:2301"}},
+		{"q=dm", []string{"10.0.0.1:2301", "10.0.0.3:2301"}},
+		{"sort=players&order=desc", []string{"10.0.0.1:2301", "10.0.0.3:2301", "10.0.0.4:2301", "10.0.0.2:2301"}},
+		{"sort=name", []string{"10.0.0.4:2301", "10.0.0.2:2301", "10.0.0.3:2301", "10.0.0.1:2301"}},
+	}
+
+	for _, tt := range tests {
+		code, list := getServersAPI(t, servers, tt.query)
+		if code != http.StatusOK {
+			t.Errorf("%q: expected status 200, got %d", tt.query, code)
+			continue
+		}
+		got := addresses(list)
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.query, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%q: expected %v, got %v", tt.query, tt.expected, got)
+				break
+			}
+		}
+	}
+
+	_, list := getServersAPI(t, servers, "official=true")
+	if !list.Servers[0].Official || list.Servers[0].LastSeen == nil || list.Servers[0].Info == nil {
+		t.Errorf("Expected official entry with metadata, got %+v", list.Servers[0])
+	}
+}
+
+func TestServersAPIPagination(t *testing.T) {
+	servers := newAPITestServers(t)
+
+	var seen []string
+	query := "sort=players&order=desc&limit=3"
+	for page := 0; page < 3; page++ {
+		code, list := getServersAPI(t, servers, query)
+		if code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+		if list.Total != 4 {
+			t.Errorf("Expected total 4, got %d", list.Total)
+		}
+		seen = append(seen, addresses(list)...)
+		if list.NextCursor == "" {
+			break
+		}
+		query = "sort=players&order=desc&limit=3&cursor=" + list.NextCursor
+	}
+
+	if len(seen) != 4 {
+		t.Fatalf("Expected 4 servers across pages, got %v", seen)
+	}
+	if seen[3] != "10.0.0.2:2301" {
+		t.Errorf("Expected second page to hold the last entry, got %v", seen)
+	}
+
+	// A cursor is only valid for the sort order it was issued for
+	_, list := getServersAPI(t, servers, "sort=players&order=desc&limit=1")
+	if code, _ := getServersAPI(t, servers, "sort=name&cursor="+list.NextCursor); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for mismatched cursor, got %d", code)
+	}
+}
+
+func TestServersAPIInvalidParams(t *testing.T) {
+	servers := newAPITestServers(t)
+	for _, query := range []string{"sort=bogus", "order=up", "limit=0", "limit=1000", "official=maybe", "cursor=!!!"} {
+		if code, _ := getServersAPI(t, servers, query); code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, code)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"lusd/internal/config"
+)
+
+// maxStatsGamemodes limits the gamemodes listed by /api/v1/stats
+const maxStatsGamemodes = 10
+
+// apiGamemode is the share of one gamemode in /api/v1/stats
+type apiGamemode struct {
+	Name    string `json:"name"`
+	Servers int    `json:"servers"`
+	Players int    `json:"players"`
+}
+
+// apiStats is the response body of /api/v1/stats
+type apiStats struct {
+	Version    string        `json:"version"`
+	Uptime     float64       `json:"uptime"`     // seconds since start
+	Servers    int           `json:"servers"`    // listed servers
+	Official   int           `json:"official"`   // listed official servers
+	Mirrored   int           `json:"mirrored"`   // listed only through federation peers
+	Populated  int           `json:"populated"`  // servers with players online
+	Passworded int           `json:"passworded"` // servers that need a password
+	Players    int           `json:"players"`
+	Slots      int           `json:"slots"` // sum of max players
+	Gamemodes  []apiGamemode `json:"gamemodes"`
+}
+
+// handleStats serves totals over the listed servers, for the stats page
+func (a *API) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := apiStats{
+		Version:   a.Version,
+		Uptime:    time.Since(a.StartTime).Seconds(),
+		Gamemodes: []apiGamemode{},
+	}
+	gamemodes := make(map[string]*apiGamemode)
+	for _, rec := range a.Servers.GetRecords() {
+		stats.Servers++
+		if rec.Official {
+			stats.Official++
+		}
+		if !slices.Contains(rec.Sources, config.LocalSource) && len(rec.Sources) > 0 {
+			stats.Mirrored++
+		}
+		if rec.Info == nil {
+			continue
+		}
+		stats.Players += rec.Info.Players
+		stats.Slots += rec.Info.MaxPlayers
+		if rec.Info.Players > 0 {
+			stats.Populated++
+		}
+		if rec.Info.Password {
+			stats.Passworded++
+		}
+		if rec.Info.Gamemode == "" {
+			continue
+		}
+		// Gamemodes differing only in case are counted together
+		key := strings.ToLower(rec.Info.Gamemode)
+		g, ok := gamemodes[key]
+		if !ok {
+			g = &apiGamemode{Name: rec.Info.Gamemode}
+			gamemodes[key] = g
+		}
+		g.Servers++
+		g.Players += rec.Info.Players
+	}
+
+	for _, g := range gamemodes {
+		stats.Gamemodes = append(stats.Gamemodes, *g)
+	}
+	slices.SortFunc(stats.Gamemodes, func(a, b apiGamemode) int {
+		if a.Players != b.Players {
+			return b.Players - a.Players
+		}
+		if a.Servers != b.Servers {
+			return b.Servers - a.Servers
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	stats.Gamemodes = stats.Gamemodes[:min(len(stats.Gamemodes), maxStatsGamemodes)]
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"lusd/internal/web"
+)
+
+// registerUI adds the web pages and their assets to mux behind the given
+// middleware. They are served while uiEnabled is set, the admin dashboard
+// only once an admin token is configured.
+func (a *API) registerUI(mux *http.ServeMux, middleware func(http.HandlerFunc) http.HandlerFunc) {
+	mux.HandleFunc("/{$}", middleware(a.page("index.html", false)))
+	mux.HandleFunc("/stats", middleware(a.page("stats.html", false)))
+	mux.HandleFunc("/admin/{$}", middleware(a.page("admin.html", true)))
+	mux.HandleFunc(web.AssetPath, middleware(a.ui(web.ServeAsset)))
+}
+
+// page serves the embedded page name. The admin dashboard signs in with
+// the admin token in the browser, so it needs no credentials itself.
+func (a *API) page(name string, admin bool) http.HandlerFunc {
+	return a.ui(func(w http.ResponseWriter, r *http.Request) {
+		if admin && !adminEnabled(a.Servers.GetConfig()) {
+			http.NotFound(w, r)
+			return
+		}
+		web.Serve(w, r, name)
+	})
+}
+
+// ui answers 404 while the web pages are disabled
+func (a *API) ui(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.Servers.GetConfig().UIEnabled {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
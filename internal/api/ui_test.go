@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/store"
+	"lusd/internal/web"
+)
+
+func TestUIPages(t *testing.T) {
+	servers := store.New(config.Config{StaleTimeout: time.Minute, Blacklist: banset.New(), UIEnabled: true})
+	mux := http.NewServeMux()
+	(&API{Servers: servers}).Register(mux, func(next http.HandlerFunc) http.HandlerFunc { return next })
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	for _, path := range []string{"/", "/stats", "/ui/style.css"} {
+		if w := get(path); w.Code != http.StatusOK || w.Header().Get("Content-Security-Policy") != web.ContentSecurityPolicy {
+			t.Errorf("%s: expected the page with its policy, got %d", path, w.Code)
+		}
+	}
+	if w := get("/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for other paths, got %d", w.Code)
+	}
+
+	// The dashboard exists once there is an admin token
+	if w := get("/admin/"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without an admin token, got %d", w.Code)
+	}
+	cfg := servers.GetConfig()
+	cfg.AdminToken = "admin-token-0123456789"
+	servers.SetConfig(cfg)
+	if w := get("/admin/"); w.Code != http.StatusOK {
+		t.Errorf("Expected the dashboard, got %d", w.Code)
+	}
+
+	cfg.UIEnabled = false
+	servers.SetConfig(cfg)
+	for _, path := range []string{"/", "/stats", "/admin/", "/ui/style.css"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 while disabled, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	servers := newAPITestServers(t)
+	servers.ReportInfo("10.0.0.5", 2301, &store.ServerInfo{Name: "More DM", Gamemode: "dm", Players: 2, MaxPlayers: 8})
+	servers.ReportInfo("10.0.0.6", 2301, &store.ServerInfo{Name: "Race", Gamemode: "Race", Players: 1, MaxPlayers: 8})
+	servers.ReportInfo("10.0.0.3", 2301, &store.ServerInfo{Name: "Locked DM", Gamemode: "DM", Players: 4, MaxPlayers: 16, Password: true})
+
+	w := httptest.NewRecorder()
+	(&API{Servers: servers, Version: "test", StartTime: time.Now()}).handleStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	var stats apiStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if stats.Servers != 6 || stats.Official != 1 || stats.Players != 17 || stats.Slots != 80 || stats.Populated != 4 || stats.Passworded != 1 || stats.Version != "test" {
+		t.Errorf("Unexpected totals %+v", stats)
+	}
+	// Gamemodes are counted regardless of case, most players first
+	if len(stats.Gamemodes) != 2 || stats.Gamemodes[0].Name != "DM" || stats.Gamemodes[0].Servers != 2 || stats.Gamemodes[0].Players != 6 || stats.Gamemodes[1].Name != "Race" {
+		t.Errorf("Unexpected gamemodes %+v", stats.Gamemodes)
+	}
+}
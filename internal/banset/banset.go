@@ -0,0 +1,249 @@
+// Package banset implements a set of banned IP prefixes with optional
+// reasons and expiry, indexed by a binary prefix trie.
+package banset
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is a single ban
+type Entry struct {
+	Prefix  netip.Prefix
+	Reason  string
+	Expires time.Time // zero never expires
+}
+
+// Expired reports whether the ban no longer applies at now
+func (e Entry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// Address returns the banned prefix, or the bare address for single hosts
+func (e Entry) Address() string {
+	if e.Prefix.IsSingleIP() {
+		return e.Prefix.Addr().String()
+	}
+	return e.Prefix.String()
+}
+
+// node is a trie node, one level per address bit
+type node struct {
+	child [2]*node
+	entry *Entry
+}
+
+// Set is a set of banned prefixes. The zero value and a nil *Set are empty.
+// A Set is not safe for concurrent modification; copy it with Clone.
+type Set struct {
+	root4   *node
+	root6   *node
+	entries map[netip.Prefix]*Entry
+}
+
+// New returns an empty set
+func New() *Set {
+	return &Set{entries: make(map[netip.Prefix]*Entry)}
+}
+
+// ParsePrefix parses an address or CIDR into its canonical prefix. IPv4
+// written as IPv4-mapped IPv6 is converted to IPv4, zones are dropped and
+// host bits are masked.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid address %q", s)
+		}
+		addr = addr.Unmap().WithZone("")
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q", s)
+	}
+	return canonical(prefix)
+}
+
+// canonical masks p and converts IPv4-mapped prefixes to IPv4
+func canonical(p netip.Prefix) (netip.Prefix, error) {
+	addr, bits := p.Addr(), p.Bits()
+	if addr.Is4In6() {
+		if bits < 96 {
+			return netip.Prefix{}, fmt.Errorf("prefix %s spans more than IPv4-mapped space", p)
+		}
+		addr, bits = addr.Unmap(), bits-96
+	}
+	return netip.PrefixFrom(addr.WithZone(""), bits).Masked(), nil
+}
+
+// root returns the trie for the address family of addr
+func (s *Set) root(addr netip.Addr, create bool) *node {
+	r := &s.root6
+	if addr.Is4() {
+		r = &s.root4
+	}
+	if *r == nil && create {
+		*r = &node{}
+	}
+	return *r
+}
+
+// bit returns bit i of addr, counting from the most significant
+func bit(addr netip.Addr, i int) int {
+	b := addr.AsSlice()
+	return int(b[i/8]>>(7-i%8)) & 1
+}
+
+// Add bans a prefix, replacing any ban on the same prefix
+func (s *Set) Add(e Entry) error {
+	prefix, err := canonical(e.Prefix)
+	if err != nil {
+		return err
+	}
+	e.Prefix = prefix
+	if s.entries == nil {
+		s.entries = make(map[netip.Prefix]*Entry)
+	}
+
+	n := s.root(prefix.Addr(), true)
+	for i := 0; i < prefix.Bits(); i++ {
+		b := bit(prefix.Addr(), i)
+		if n.child[b] == nil {
+			n.child[b] = &node{}
+		}
+		n = n.child[b]
+	}
+	n.entry = &e
+	s.entries[prefix] = n.entry
+	return nil
+}
+
+// Remove lifts the ban on exactly prefix. Returns false if it was not banned.
+func (s *Set) Remove(prefix netip.Prefix) bool {
+	if s == nil {
+		return false
+	}
+	prefix, err := canonical(prefix)
+	if err != nil || s.entries[prefix] == nil {
+		return false
+	}
+
+	n := s.root(prefix.Addr(), false)
+	for i := 0; i < prefix.Bits() && n != nil; i++ {
+		n = n.child[bit(prefix.Addr(), i)]
+	}
+	if n != nil {
+		n.entry = nil
+	}
+	delete(s.entries, prefix)
+	return true
+}
+
+// Lookup returns the most specific ban covering addr that has not expired
+func (s *Set) Lookup(addr netip.Addr, now time.Time) (Entry, bool) {
+	if s == nil {
+		return Entry{}, false
+	}
+	addr = addr.Unmap()
+	var match *Entry
+	n := s.root(addr, false)
+	for i := 0; n != nil; i++ {
+		if n.entry != nil && !n.entry.Expired(now) {
+			match = n.entry
+		}
+		if i == addr.BitLen() {
+			break
+		}
+		n = n.child[bit(addr, i)]
+	}
+	if match == nil {
+		return Entry{}, false
+	}
+	return *match, true
+}
+
+// Contains reports whether addr is banned at now
+func (s *Set) Contains(addr netip.Addr, now time.Time) bool {
+	_, ok := s.Lookup(addr, now)
+	return ok
+}
+
+// Get returns the ban on exactly prefix
+func (s *Set) Get(prefix netip.Prefix) (Entry, bool) {
+	if s == nil {
+		return Entry{}, false
+	}
+	prefix, err := canonical(prefix)
+	if err != nil || s.entries[prefix] == nil {
+		return Entry{}, false
+	}
+	return *s.entries[prefix], true
+}
+
+// Len returns the number of bans, including expired ones not yet pruned
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.entries)
+}
+
+// Entries returns every ban sorted by prefix
+func (s *Set) Entries() []Entry {
+	if s == nil {
+		return nil
+	}
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Prefix, entries[j].Prefix
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+	return entries
+}
+
+// Clone returns an independent copy of the set
+func (s *Set) Clone() *Set {
+	c := New()
+	for _, e := range s.Entries() {
+		c.Add(e)
+	}
+	return c
+}
+
+// HasExpired reports whether any ban expired by now, without copying the
+// set
+func (s *Set) HasExpired(now time.Time) bool {
+	if s == nil {
+		return false
+	}
+	for _, e := range s.entries {
+		if e.Expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prune removes expired bans and returns them
+func (s *Set) Prune(now time.Time) []Entry {
+	var expired []Entry
+	for _, e := range s.Entries() {
+		if e.Expired(now) {
+			s.Remove(e.Prefix)
+			expired = append(expired, e)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,134 @@
+package banset
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func mustAdd(t *testing.T, s *Set, prefix, reason string, expires time.Time) {
+	t.Helper()
+	p, err := ParsePrefix(prefix)
+	if err != nil {
+		t.Fatalf("ParsePrefix(%s) failed: %v", prefix, err)
+	}
+	if err := s.Add(Entry{Prefix: p, Reason: reason, Expires: expires}); err != nil {
+		t.Fatalf("Add(%s) failed: %v", prefix, err)
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"10.0.0.1", "10.0.0.1/32"},
+		{" 10.1.2.3/8 ", "10.0.0.0/8"},
+		{"::ffff:10.0.0.1", "10.0.0.1/32"},
+		{"::ffff:10.0.0.0/104", "10.0.0.0/8"},
+		{"2001:DB8:0:0::1", "2001:db8::1/128"},
+		{"2001:db8::1/32", "2001:db8::/32"},
+		{"fe80::1%eth0", "fe80::1/128"},
+	}
+	for _, tt := range tests {
+		p, err := ParsePrefix(tt.input)
+		if err != nil {
+			t.Errorf("ParsePrefix(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if p.String() != tt.expected {
+			t.Errorf("ParsePrefix(%q) = %s, expected %s", tt.input, p, tt.expected)
+		}
+	}
+
+	for _, input := range []string{"", "bogus", "10.0.0.0/33", "::ffff:0:0/64"} {
+		if _, err := ParsePrefix(input); err == nil {
+			t.Errorf("Expected ParsePrefix(%q) to fail", input)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := New()
+	mustAdd(t, s, "10.0.0.0/8", "hosting range", time.Time{})
+	mustAdd(t, s, "10.1.0.0/16", "abuse", now.Add(time.Hour))
+	mustAdd(t, s, "192.0.2.7", "", time.Time{})
+	mustAdd(t, s, "2001:db8::/32", "v6 range", time.Time{})
+
+	tests := []struct {
+		addr     string
+		reason   string
+		expected bool
+	}{
+		{"10.2.3.4", "hosting range", true},
+		{"10.1.2.3", "abuse", true},
+		{"::ffff:10.2.3.4", "hosting range", true},
+		{"192.0.2.7", "", true},
+		{"192.0.2.8", "", false},
+		{"2001:db8:0:0:0:0:0:5", "v6 range", true},
+		{"2001:db9::5", "", false},
+		{"11.0.0.1", "", false},
+	}
+	for _, tt := range tests {
+		e, ok := s.Lookup(netip.MustParseAddr(tt.addr), now)
+		if ok != tt.expected || e.Reason != tt.reason {
+			t.Errorf("Lookup(%s) = %q, %v, expected %q, %v", tt.addr, e.Reason, ok, tt.reason, tt.expected)
+		}
+	}
+
+	// Once the specific ban expires the broader one applies again
+	e, ok := s.Lookup(netip.MustParseAddr("10.1.2.3"), now.Add(2*time.Hour))
+	if !ok || e.Reason != "hosting range" {
+		t.Errorf("Expected fallback to the broader ban, got %q, %v", e.Reason, ok)
+	}
+}
+
+func TestRemoveAndClone(t *testing.T) {
+	s := New()
+	mustAdd(t, s, "10.0.0.0/8", "", time.Time{})
+	mustAdd(t, s, "10.0.0.1", "", time.Time{})
+
+	c := s.Clone()
+	if !s.Remove(netip.MustParsePrefix("10.0.0.1/32")) {
+		t.Fatal("Expected Remove to find the ban")
+	}
+	if s.Remove(netip.MustParsePrefix("10.0.0.1/32")) {
+		t.Error("Expected second Remove to fail")
+	}
+	if s.Len() != 1 || c.Len() != 2 {
+		t.Errorf("Expected clone to be independent, got %d and %d", s.Len(), c.Len())
+	}
+	if !s.Contains(netip.MustParseAddr("10.0.0.1"), time.Now()) {
+		t.Error("Expected address to still be covered by the /8")
+	}
+	if entries := c.Entries(); entries[0].Address() != "10.0.0.0/8" || entries[1].Address() != "10.0.0.1" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := New()
+	mustAdd(t, s, "10.0.0.1", "", now.Add(-time.Minute))
+	mustAdd(t, s, "10.0.0.2", "", now.Add(time.Minute))
+	mustAdd(t, s, "10.0.0.3", "", time.Time{})
+
+	if !s.HasExpired(now) || s.HasExpired(now.Add(-2*time.Minute)) {
+		t.Error("Expected only 10.0.0.1 to be expired by now")
+	}
+	expired := s.Prune(now)
+	if len(expired) != 1 || expired[0].Address() != "10.0.0.1" {
+		t.Errorf("Expected 10.0.0.1 to be pruned, got %+v", expired)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Expected 2 bans left, got %d", s.Len())
+	}
+}
+
+func TestNilSet(t *testing.T) {
+	var s *Set
+	if s.Contains(netip.MustParseAddr("10.0.0.1"), time.Now()) || s.Len() != 0 || s.Remove(netip.MustParsePrefix("10.0.0.1/32")) {
+		t.Error("Expected nil set to be empty")
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ServerAddr formats the key a server is stored under, with IPv6 addresses
+// in brackets so the key splits back into host and port
+func ServerAddr(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// CanonicalServerAddr normalizes an ip:port so the same server reported in
+// different notations is stored once
+func CanonicalServerAddr(addr string) (string, netip.Addr, bool) {
+	ap, err := netip.ParseAddrPort(strings.TrimSpace(addr))
+	if err != nil || ap.Port() == 0 {
+		return "", netip.Addr{}, false
+	}
+	ip := ap.Addr().Unmap().WithZone("")
+	return ServerAddr(ip.String(), int(ap.Port())), ip, true
+}
+
+// ValidOfficialAddr checks addr is an IP, optionally with a port
+func ValidOfficialAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr // If not in host:port format, use the whole string
+	}
+	return net.ParseIP(host) != nil
+}
+
+// parseTrustedProxies parses the trustedProxies list. Plain addresses are
+// treated as single-host prefixes.
+func parseTrustedProxies(entries []string) ([]netip.Prefix, []error) {
+	var prefixes []netip.Prefix
+	var problems []error
+	for i, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			problems = append(problems, &FieldError{Field: fmt.Sprintf("trustedProxies[%d]", i), Value: entry, Reason: "must be an IP address or CIDR"})
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, problems
+}
@@ -0,0 +1,40 @@
+package config
+
+import "testing"
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, problems := parseTrustedProxies([]string{"10.1.2.3/8", " 192.0.2.1 ", "::ffff:192.0.2.2", "fd00::/8", "", "nope"})
+	if len(problems) != 1 {
+		t.Errorf("Expected 1 problem, got %v", problems)
+	}
+
+	expected := []string{"10.0.0.0/8", "192.0.2.1/32", "192.0.2.2/32", "fd00::/8"}
+	if len(prefixes) != len(expected) {
+		t.Fatalf("Expected %d prefixes, got %v", len(expected), prefixes)
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], prefix)
+		}
+	}
+}
+
+func TestCanonicalServerAddr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"10.0.0.1:2301", "10.0.0.1:2301", true},
+		{" [::ffff:10.0.0.1]:2301 ", "10.0.0.1:2301", true},
+		{"[2001:DB8::1]:2301", "[2001:db8::1]:2301", true},
+		{"10.0.0.1", "", false},
+		{"10.0.0.1:0", "", false},
+	}
+	for _, tt := range tests {
+		got, _, ok := CanonicalServerAddr(tt.input)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("CanonicalServerAddr(%q) = %q, %v, expected %q, %v", tt.input, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
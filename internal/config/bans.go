@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"lusd/internal/banset"
+)
+
+// jsonBan is a ban with a reason or expiry as written in config.json. Plain
+// permanent bans stay in the blacklist array.
+type jsonBan struct {
+	IP      string `json:"ip"` // address or CIDR
+	Reason  string `json:"reason,omitempty"`
+	Expires string `json:"expires,omitempty"` // RFC 3339
+}
+
+// parseBans builds the ban set from the blacklist array and the bans list.
+// Bans that have already expired are dropped, invalid ones are skipped and
+// returned as a *FieldError.
+func parseBans(blacklist []string, bans []jsonBan, now time.Time) (*banset.Set, []error) {
+	set := banset.New()
+	var problems []error
+
+	for i, ip := range blacklist {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			continue
+		}
+		prefix, err := banset.ParsePrefix(ip)
+		if err != nil {
+			problems = append(problems, &FieldError{Field: fmt.Sprintf("blacklist[%d]", i), Value: ip, Reason: "must be an IP address or CIDR"})
+			continue
+		}
+		set.Add(banset.Entry{Prefix: prefix})
+	}
+
+	for i, ban := range bans {
+		field := fmt.Sprintf("bans[%d]", i)
+		prefix, err := banset.ParsePrefix(ban.IP)
+		if err != nil {
+			problems = append(problems, &FieldError{Field: field + ".ip", Value: ban.IP, Reason: "must be an IP address or CIDR"})
+			continue
+		}
+		entry := banset.Entry{Prefix: prefix, Reason: ban.Reason}
+		if ban.Expires != "" {
+			expires, err := time.Parse(time.RFC3339, ban.Expires)
+			if err != nil {
+				problems = append(problems, &FieldError{Field: field + ".expires", Value: ban.Expires, Reason: "must be an RFC 3339 time"})
+				continue
+			}
+			entry.Expires = expires
+		}
+		if entry.Expired(now) {
+			continue
+		}
+		set.Add(entry)
+	}
+
+	return set, problems
+}
+
+// encodeBans splits a ban set into the blacklist array and the bans list
+func encodeBans(set *banset.Set) ([]string, []jsonBan) {
+	var blacklist []string
+	var bans []jsonBan
+	for _, e := range set.Entries() {
+		if e.Reason == "" && e.Expires.IsZero() {
+			blacklist = append(blacklist, e.Address())
+			continue
+		}
+		ban := jsonBan{IP: e.Address(), Reason: e.Reason}
+		if !e.Expires.IsZero() {
+			ban.Expires = e.Expires.UTC().Format(time.RFC3339)
+		}
+		bans = append(bans, ban)
+	}
+	return blacklist, bans
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAndEncodeBans(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	blacklist := []string{"10.0.0.1", "::FFFF:10.0.0.2", "2001:db8::/32", " ", "bogus"}
+	bans := []jsonBan{
+		{IP: "192.0.2.0/24", Reason: "spam", Expires: "2099-01-01T00:00:00Z"},
+		{IP: "192.0.2.99", Expires: "2000-01-01T00:00:00Z"},
+		{IP: "198.51.100.1", Expires: "tomorrow"},
+	}
+
+	set, problems := parseBans(blacklist, bans, now)
+	if len(problems) != 2 {
+		t.Errorf("Expected 2 problems, got %v", problems)
+	}
+	if set.Len() != 4 {
+		t.Errorf("Expected 4 bans, expired ones dropped, got %d", set.Len())
+	}
+
+	encodedBlacklist, encodedBans := encodeBans(set)
+	expected := []string{"10.0.0.1", "10.0.0.2", "2001:db8::/32"}
+	if len(encodedBlacklist) != len(expected) {
+		t.Fatalf("Expected blacklist %v, got %v", expected, encodedBlacklist)
+	}
+	for i := range expected {
+		if encodedBlacklist[i] != expected[i] {
+			t.Errorf("Expected blacklist %v, got %v", expected, encodedBlacklist)
+		}
+	}
+	if len(encodedBans) != 1 || encodedBans[0] != bans[0] {
+		t.Errorf("Expected bans %+v, got %+v", bans[:1], encodedBans)
+	}
+}
@@ -0,0 +1,590 @@
+// Package config loads and validates the directory configuration file,
+// applies environment variable overrides to it, and persists admin changes
+// to a separate state file.
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/logging"
+	"lusd/internal/ratelimit"
+	"lusd/internal/securefile"
+)
+
+// Security constants
+const (
+	maxConfigFileSize = 1024 * 1024 * 32 // 32MB max config file size
+	configFileMode    = 0600             // Owner read/write only
+	minTokenLen       = 16               // admin, peer and registration tokens
+)
+
+// Log rotation defaults
+const (
+	defaultLogMaxSizeMB  = 100
+	defaultLogMaxBackups = 7
+	maxLogMaxSizeMB      = 1024 * 1024
+	maxLogMaxBackups     = 1000
+)
+
+// DefaultChallengeTimeout is how long a server has to echo a challenge
+const DefaultChallengeTimeout = 3 * time.Second
+
+type Config struct {
+	Sources          map[string]string // source of every setting by JSON path, see SourceDefault
+	Strict           bool              // reject unknown fields and refuse to start on invalid values
+	Port             int               `json:"port"`
+	AllowedUserAgent string            `json:"allowedUserAgent"`
+	StaleTimeout     time.Duration     `json:"staleTimeout"`
+	Blacklist        *banset.Set
+	OfficialServers  []string
+	LogFile          string
+	LogEnabled       bool
+	LogLevel         slog.Level
+	LogFormat        string
+	LogMaxSize       int64 // bytes
+	LogRotateDaily   bool
+	LogMaxBackups    int
+	LogCompress      bool
+	SnapshotFile     string
+	SnapshotInterval time.Duration
+	SnapshotEnabled  bool
+	ProbeEnabled     bool
+	ProbeInterval    time.Duration
+	ProbeTimeout     time.Duration
+	ProbeConcurrency int
+	ProbeRate        int
+	ProbeMaxFailures int
+	ChallengeEnabled bool
+	ChallengeTimeout time.Duration
+	AdminToken       string
+	AdminPersist     bool
+	ConfigWatch      bool
+	MetricsEnabled   bool
+	MetricsListen    string
+	UIEnabled        bool // server browser, stats page and admin dashboard
+	TrustedProxies   []netip.Prefix
+	ProxyProtocol    bool
+	TLSListen        string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSOnlyPaths     []string
+	TLSDisableHTTP   bool
+	TLSClientCAFile  string // CAs of client certificates for the admin API
+
+	RateLimit            ratelimit.Policy
+	RateLimitMaxKeys     int
+	RateLimitIdleTimeout time.Duration
+
+	FederationNodeID       string
+	FederationPeers        []FederationPeer
+	FederationPullInterval time.Duration
+	FederationStaleTimeout time.Duration
+
+	Registrations               map[string]Registration // by canonical ip:port
+	RegistrationRequireOfficial bool
+	RegistrationMaxSkew         time.Duration
+
+	EventsEnabled        bool
+	EventsMaxSubscribers int
+	EventsBufferSize     int // events queued per subscriber
+	EventsHistory        int // events kept for resuming subscribers
+
+	WebhookTargets        []WebhookTarget
+	WebhookMaxAttempts    int
+	WebhookTimeout        time.Duration
+	WebhookQueueSize      int // deliveries waiting, across all targets
+	WebhookAbuseThreshold int // rejections of one IP within WebhookAbuseWindow that send an abuse event
+	WebhookAbuseWindow    time.Duration
+
+	HistoryEnabled    bool
+	HistoryMaxServers int // addresses with history kept, the least recently seen are dropped
+}
+
+// jsonConfig represents the structure of the config.json file
+type jsonConfig struct {
+	Strict           bool      `json:"strict"`
+	Port             int       `json:"port"`
+	AllowedUserAgent string    `json:"allowedUserAgent"`
+	StaleTimeout     string    `json:"staleTimeout"`
+	Blacklist        []string  `json:"blacklist"`
+	Bans             []jsonBan `json:"bans,omitempty"`
+	OfficialServers  []string  `json:"officialServers"`
+	LogFile          string    `json:"logFile"`
+	LogEnabled       bool      `json:"logEnabled"`
+	LogLevel         string    `json:"logLevel"`
+	LogFormat        string    `json:"logFormat"`
+	LogMaxSizeMB     int       `json:"logMaxSizeMB"`
+	LogRotateDaily   bool      `json:"logRotateDaily"`
+	LogMaxBackups    int       `json:"logMaxBackups"`
+	LogCompress      bool      `json:"logCompress"`
+	SnapshotFile     string    `json:"snapshotFile"`
+	SnapshotInterval string    `json:"snapshotInterval"`
+	SnapshotEnabled  bool      `json:"snapshotEnabled"`
+	ProbeEnabled     bool      `json:"probeEnabled"`
+	ProbeInterval    string    `json:"probeInterval"`
+	ProbeTimeout     string    `json:"probeTimeout"`
+	ProbeConcurrency int       `json:"probeConcurrency"`
+	ProbeRate        int       `json:"probeRate"`
+	ProbeMaxFailures int       `json:"probeMaxFailures"`
+	ChallengeEnabled bool      `json:"challengeEnabled"`
+	ChallengeTimeout string    `json:"challengeTimeout"`
+	AdminToken       string    `json:"adminToken,omitempty"`
+	AdminPersist     bool      `json:"adminPersist"`
+	ConfigWatch      bool      `json:"configWatch"`
+	MetricsEnabled   bool      `json:"metricsEnabled"`
+	MetricsListen    string    `json:"metricsListen,omitempty"`
+	UIEnabled        bool      `json:"uiEnabled"`
+	TrustedProxies   []string  `json:"trustedProxies"`
+	ProxyProtocol    bool      `json:"proxyProtocol"`
+
+	RateLimit    jsonRateLimit          `json:"rateLimit"`
+	Federation   jsonFederation         `json:"federation"`
+	TLS          jsonTLS                `json:"tls"`
+	Registration jsonRegistrationConfig `json:"registration"`
+	Events       jsonEvents             `json:"events"`
+	Webhooks     jsonWebhooks           `json:"webhooks"`
+	History      jsonHistory            `json:"history"`
+}
+
+// Default returns the built-in configuration
+func Default() Config {
+	return Config{
+		Strict:           true,
+		Port:             80,
+		AllowedUserAgent: "LU-Server/0.1",
+		StaleTimeout:     10 * time.Minute,
+		Blacklist:        banset.New(),
+		OfficialServers:  []string{},
+		LogFile:          "lusd_server.log",
+		LogEnabled:       true,
+		LogLevel:         slog.LevelInfo,
+		LogFormat:        logging.DefaultFormat,
+		LogMaxSize:       defaultLogMaxSizeMB * 1024 * 1024,
+		LogRotateDaily:   false,
+		LogMaxBackups:    defaultLogMaxBackups,
+		LogCompress:      true,
+		SnapshotFile:     "lusd_snapshot.json",
+		SnapshotInterval: time.Minute,
+		SnapshotEnabled:  true,
+		ProbeEnabled:     false,
+		ProbeInterval:    30 * time.Second,
+		ProbeTimeout:     2 * time.Second,
+		ProbeConcurrency: 16,
+		ProbeRate:        50,
+		ProbeMaxFailures: 3,
+		ChallengeEnabled: false,
+		ChallengeTimeout: DefaultChallengeTimeout,
+		MetricsEnabled:   false,
+		UIEnabled:        true,
+
+		RateLimit:            defaultRateLimitPolicy(),
+		RateLimitMaxKeys:     defaultRateLimitMaxKeys,
+		RateLimitIdleTimeout: defaultRateLimitIdle,
+
+		FederationNodeID:       defaultFederationNodeID(),
+		FederationPullInterval: defaultFederationPullInterval,
+		FederationStaleTimeout: defaultFederationStaleTimeout,
+
+		Registrations:       map[string]Registration{},
+		RegistrationMaxSkew: DefaultSignatureMaxSkew,
+
+		EventsEnabled:        true,
+		EventsMaxSubscribers: defaultEventsMaxSubscribers,
+		EventsBufferSize:     defaultEventsBufferSize,
+		EventsHistory:        defaultEventsHistory,
+
+		WebhookMaxAttempts:    defaultWebhookMaxAttempts,
+		WebhookTimeout:        defaultWebhookTimeout,
+		WebhookQueueSize:      defaultWebhookQueueSize,
+		WebhookAbuseThreshold: defaultWebhookAbuseThreshold,
+		WebhookAbuseWindow:    defaultWebhookAbuseWindow,
+
+		HistoryEnabled:    true,
+		HistoryMaxServers: defaultHistoryMaxServers,
+	}
+}
+
+// DefaultJSON returns the default configuration as written to a new
+// config.json
+func DefaultJSON() ([]byte, error) {
+	defaultCfg := Default()
+
+	// Create default JSON config
+	defaultJsonCfg := jsonConfig{
+		Strict:           defaultCfg.Strict,
+		Port:             defaultCfg.Port,
+		AllowedUserAgent: defaultCfg.AllowedUserAgent,
+		StaleTimeout:     "10m",
+		LogFile:          defaultCfg.LogFile,
+		LogEnabled:       defaultCfg.LogEnabled,
+		LogLevel:         logging.DefaultLevel,
+		LogFormat:        logging.DefaultFormat,
+		LogMaxSizeMB:     defaultLogMaxSizeMB,
+		LogRotateDaily:   defaultCfg.LogRotateDaily,
+		LogMaxBackups:    defaultCfg.LogMaxBackups,
+		LogCompress:      defaultCfg.LogCompress,
+		SnapshotFile:     defaultCfg.SnapshotFile,
+		SnapshotInterval: "1m",
+		SnapshotEnabled:  defaultCfg.SnapshotEnabled,
+		ProbeEnabled:     defaultCfg.ProbeEnabled,
+		ProbeInterval:    "30s",
+		ProbeTimeout:     "2s",
+		ProbeConcurrency: defaultCfg.ProbeConcurrency,
+		ProbeRate:        defaultCfg.ProbeRate,
+		ProbeMaxFailures: defaultCfg.ProbeMaxFailures,
+		ChallengeEnabled: defaultCfg.ChallengeEnabled,
+		ChallengeTimeout: "3s",
+		MetricsEnabled:   defaultCfg.MetricsEnabled,
+		UIEnabled:        defaultCfg.UIEnabled,
+		RateLimit: jsonRateLimit{
+			Default:     jsonLimit{RequestsPerMinute: defaultRequestsPerMinute},
+			MaxKeys:     defaultCfg.RateLimitMaxKeys,
+			IdleTimeout: "10m",
+		},
+		Federation: jsonFederation{
+			Peers:        []jsonFederationPeer{},
+			PullInterval: "1m",
+			StaleTimeout: "5m",
+		},
+		Registration: jsonRegistrationConfig{
+			MaxSkew: "5m",
+			Servers: []jsonRegistration{},
+		},
+		Events: jsonEvents{
+			Enabled:        defaultCfg.EventsEnabled,
+			MaxSubscribers: defaultCfg.EventsMaxSubscribers,
+			BufferSize:     defaultCfg.EventsBufferSize,
+			History:        defaultCfg.EventsHistory,
+		},
+		Webhooks: jsonWebhooks{
+			Targets:        []jsonWebhookTarget{},
+			MaxAttempts:    defaultCfg.WebhookMaxAttempts,
+			Timeout:        "10s",
+			QueueSize:      defaultCfg.WebhookQueueSize,
+			AbuseThreshold: defaultCfg.WebhookAbuseThreshold,
+			AbuseWindow:    "1m",
+		},
+		History: jsonHistory{
+			Enabled:    defaultCfg.HistoryEnabled,
+			MaxServers: defaultCfg.HistoryMaxServers,
+		},
+	}
+
+	// Convert the ban set to the blacklist and bans lists
+	defaultJsonCfg.Blacklist, defaultJsonCfg.Bans = encodeBans(defaultCfg.Blacklist)
+
+	// Convert to JSON with indentation
+	return json.MarshalIndent(defaultJsonCfg, "", "  ")
+}
+
+// switchDefaults returns a config file with the switches that default to on
+// set. Files are decoded over it, as a missing boolean cannot be told from
+// false afterwards. strict stays off for files written before it existed.
+func switchDefaults() jsonConfig {
+	defaultCfg := Default()
+	return jsonConfig{
+		LogEnabled:      defaultCfg.LogEnabled,
+		LogCompress:     defaultCfg.LogCompress,
+		SnapshotEnabled: defaultCfg.SnapshotEnabled,
+		UIEnabled:       defaultCfg.UIEnabled,
+		Events:          jsonEvents{Enabled: defaultCfg.EventsEnabled},
+		History:         jsonHistory{Enabled: defaultCfg.HistoryEnabled},
+	}
+}
+
+// Load loads the configuration from a JSON file with the environment
+// overrides found through getenv. A missing file is created with the
+// defaults. A file that cannot be read or parsed, or a strict config with
+// any invalid value, is an error; otherwise invalid values fall back to
+// their defaults with a warning.
+func Load(configPath string, getenv func(string) string) (Config, error) {
+	// Validate config path
+	configPath = filepath.Clean(configPath)
+	if strings.Contains(configPath, "..") {
+		return Config{}, fmt.Errorf("invalid config path")
+	}
+
+	var cfg Config
+	var problems []error
+	var err error
+
+	// Check if config file exists
+	if _, statErr := os.Stat(configPath); os.IsNotExist(statErr) {
+		slog.Info("Config file not found, creating default config")
+
+		jsonData, err := DefaultJSON()
+		if err != nil {
+			return Config{}, err
+		}
+
+		// Write to file with secure permissions
+		if err := securefile.Write(configPath, jsonData, configFileMode); err != nil {
+			slog.Error("Error writing default config, using defaults")
+		} else {
+			slog.Info("Created default config")
+		}
+		cfg, problems, err = parse(jsonData, getenv)
+	} else {
+		cfg, problems, err = Read(configPath, getenv)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	if cfg.Strict && len(problems) > 0 {
+		return Config{}, errors.Join(problems...)
+	}
+	for _, problem := range problems {
+		slog.Warn("Ignoring invalid config value", "problem", problem)
+	}
+	for _, path := range slices.Sorted(maps.Keys(cfg.Sources)) {
+		if source := cfg.Sources[path]; source != SourceDefault && source != SourceFile {
+			slog.Info("Config setting overridden by environment", "setting", path, "source", source)
+		}
+	}
+	slog.Info("Successfully loaded config", "strict", cfg.Strict)
+	return cfg, nil
+}
+
+// Read reads and parses the config file at configPath with the environment
+// overrides found through getenv, which may be nil. See parse.
+func Read(configPath string, getenv func(string) string) (Config, []error, error) {
+	// Read the config file with security checks
+	data, err := securefile.Read(configPath, maxConfigFileSize)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("could not read config file")
+	}
+	return parse(data, getenv)
+}
+
+// parse parses a config file with the environment overrides found through
+// getenv, returning a *FieldError for every invalid value in problems.
+// Invalid values are replaced by their defaults, or by the file value for
+// an invalid override, so the caller decides whether a partially valid
+// config is acceptable. Unknown fields are problems in strict mode.
+func parse(data []byte, getenv func(string) string) (Config, []error, error) {
+	jsonCfg := switchDefaults()
+	if err := json.Unmarshal(data, &jsonCfg); err != nil {
+		return Config{}, nil, parseError(err)
+	}
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Config{}, nil, parseError(err)
+	}
+	fileCfg := jsonCfg
+
+	var problems []error
+	var env map[string]string
+	if getenv != nil {
+		env, problems = applyEnv(&jsonCfg, getenv)
+	}
+	if jsonCfg.Strict {
+		problems = append(unknownFields("", raw, reflect.TypeOf(jsonCfg)), problems...)
+	}
+
+	cfg, invalid := convert(jsonCfg)
+
+	// Attribute problems to the variables they came from. Without strict
+	// mode an invalid override is ignored and the file value kept.
+	var envInvalid []error
+	for _, err := range invalid {
+		var fe *FieldError
+		if !errors.As(err, &fe) {
+			continue
+		}
+		if path, ok := envSetting(fe.Field, env); ok {
+			fe.Source = env[path]
+			envInvalid = append(envInvalid, err)
+			if !jsonCfg.Strict {
+				revertSetting(&jsonCfg, &fileCfg, path)
+				delete(env, path)
+			}
+		}
+	}
+	if len(envInvalid) > 0 && !jsonCfg.Strict {
+		cfg, invalid = convert(jsonCfg)
+		problems = append(problems, envInvalid...)
+	}
+	problems = append(problems, invalid...)
+
+	cfg.Sources = fileSources(raw)
+	for path, source := range env {
+		cfg.Sources[path] = source
+	}
+	return cfg, problems, nil
+}
+
+// convert converts a parsed config file into the internal config, returning
+// a *FieldError for every invalid value. Invalid values fall back to their
+// defaults.
+func convert(jsonCfg jsonConfig) (Config, []error) {
+	var problems []error
+	var err error
+
+	// Convert JSON config to internal config, zero values mean the default
+	defaultCfg := Default()
+	cfg := Config{
+		Strict:           jsonCfg.Strict,
+		Port:             jsonCfg.Port,
+		AllowedUserAgent: jsonCfg.AllowedUserAgent,
+		OfficialServers:  []string{},
+		LogFile:          jsonCfg.LogFile,
+		LogEnabled:       jsonCfg.LogEnabled,
+		LogLevel:         slog.LevelInfo,
+		LogFormat:        cmp.Or(jsonCfg.LogFormat, defaultCfg.LogFormat),
+		LogMaxSize:       cmp.Or(int64(jsonCfg.LogMaxSizeMB)<<20, defaultCfg.LogMaxSize),
+		LogRotateDaily:   jsonCfg.LogRotateDaily,
+		LogMaxBackups:    cmp.Or(jsonCfg.LogMaxBackups, defaultCfg.LogMaxBackups),
+		LogCompress:      jsonCfg.LogCompress,
+		SnapshotFile:     cmp.Or(jsonCfg.SnapshotFile, defaultCfg.SnapshotFile),
+		SnapshotEnabled:  jsonCfg.SnapshotEnabled,
+		ProbeEnabled:     jsonCfg.ProbeEnabled,
+		ProbeConcurrency: cmp.Or(jsonCfg.ProbeConcurrency, defaultCfg.ProbeConcurrency),
+		ProbeRate:        cmp.Or(jsonCfg.ProbeRate, defaultCfg.ProbeRate),
+		ProbeMaxFailures: cmp.Or(jsonCfg.ProbeMaxFailures, defaultCfg.ProbeMaxFailures),
+		ChallengeEnabled: jsonCfg.ChallengeEnabled,
+		AdminToken:       jsonCfg.AdminToken,
+		AdminPersist:     jsonCfg.AdminPersist,
+		ConfigWatch:      jsonCfg.ConfigWatch,
+		MetricsEnabled:   jsonCfg.MetricsEnabled,
+		MetricsListen:    jsonCfg.MetricsListen,
+		UIEnabled:        jsonCfg.UIEnabled,
+		ProxyProtocol:    jsonCfg.ProxyProtocol,
+	}
+
+	// Parse durations
+	durations := []struct {
+		field string
+		value string
+		dst   *time.Duration
+		def   time.Duration
+	}{
+		{"staleTimeout", jsonCfg.StaleTimeout, &cfg.StaleTimeout, defaultCfg.StaleTimeout},
+		{"snapshotInterval", jsonCfg.SnapshotInterval, &cfg.SnapshotInterval, defaultCfg.SnapshotInterval},
+		{"probeInterval", jsonCfg.ProbeInterval, &cfg.ProbeInterval, defaultCfg.ProbeInterval},
+		{"probeTimeout", jsonCfg.ProbeTimeout, &cfg.ProbeTimeout, defaultCfg.ProbeTimeout},
+		{"challengeTimeout", jsonCfg.ChallengeTimeout, &cfg.ChallengeTimeout, defaultCfg.ChallengeTimeout},
+	}
+	for _, d := range durations {
+		if *d.dst, err = parseDuration(d.field, d.value, 1, d.def); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	// Parse log level
+	if level, err := logging.ParseLevel(jsonCfg.LogLevel); err != nil {
+		problems = append(problems, &FieldError{Field: "logLevel", Value: jsonCfg.LogLevel, Reason: "must be debug, info, warn or error"})
+	} else {
+		cfg.LogLevel = level
+	}
+
+	// Parse blacklist and bans with validation
+	var banProblems []error
+	cfg.Blacklist, banProblems = parseBans(jsonCfg.Blacklist, jsonCfg.Bans, time.Now())
+	problems = append(problems, banProblems...)
+
+	// Clean up official servers list, validate checks the entries
+	for _, addr := range jsonCfg.OfficialServers {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.OfficialServers = append(cfg.OfficialServers, addr)
+		}
+	}
+
+	// Parse trusted proxies
+	var proxyProblems []error
+	cfg.TrustedProxies, proxyProblems = parseTrustedProxies(jsonCfg.TrustedProxies)
+	problems = append(problems, proxyProblems...)
+
+	// Parse TLS listener settings
+	problems = append(problems, parseTLS(jsonCfg.TLS, &cfg)...)
+
+	// Parse signed registrations
+	problems = append(problems, parseRegistration(jsonCfg.Registration, &cfg)...)
+
+	// Parse federation peers
+	problems = append(problems, parseFederation(jsonCfg.Federation, &cfg)...)
+
+	// Parse rate limits
+	problems = append(problems, parseRateLimit(jsonCfg.RateLimit, &cfg)...)
+
+	// Parse event stream limits
+	problems = append(problems, parseEvents(jsonCfg.Events, &cfg)...)
+
+	// Parse webhook targets
+	problems = append(problems, parseWebhooks(jsonCfg.Webhooks, &cfg)...)
+
+	// Parse server history limits
+	problems = append(problems, parseHistory(jsonCfg.History, &cfg)...)
+
+	// Check the remaining settings and fall back for the invalid ones
+	invalid := cfg.validate()
+	cfg.fallBack(invalid)
+	problems = append(problems, invalid...)
+
+	return cfg, problems
+}
+
+// parseError describes a config file that is not valid JSON or has a value
+// of the wrong type
+func parseError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Errorf("could not parse config file: %w", &FieldError{Field: typeErr.Field, Value: typeErr.Value, Reason: "must be " + jsonKind(typeErr.Type)})
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("could not parse config file: invalid JSON at byte %d", syntaxErr.Offset)
+	}
+	return fmt.Errorf("could not parse config file")
+}
+
+// jsonKind names the JSON value expected for a field of type t
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+	return "a number"
+}
+
+// parseDuration parses the duration s of field, returning def if s is empty
+// and a *FieldError with def if s is invalid or below minimum
+func parseDuration(field, s string, minimum, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return def, &FieldError{Field: field, Value: s, Reason: `must be a duration such as "30s"`}
+	}
+	if d < minimum {
+		return def, &FieldError{Field: field, Value: s, Reason: durationReason(minimum)}
+	}
+	return d, nil
+}
+
+// durationReason describes the lowest allowed duration
+func durationReason(minimum time.Duration) string {
+	if minimum <= 1 {
+		return "must be a positive duration"
+	}
+	return fmt.Sprintf("must be at least %s", minimum)
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+)
+
+func writeTestConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+// noEnv is a getenv without any variables set
+func noEnv(string) string { return "" }
+
+func TestLoadCreatesDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg, err := Load(path, noEnv)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Port != 80 {
+		t.Errorf("Expected default port 80, got %d", cfg.Port)
+	}
+	if cfg.AllowedUserAgent != "LU-Server/0.1" {
+		t.Errorf("Expected default user agent 'LU-Server/0.1', got %s", cfg.AllowedUserAgent)
+	}
+	if cfg.StaleTimeout != 10*time.Minute {
+		t.Errorf("Expected default stale timeout 10m, got %v", cfg.StaleTimeout)
+	}
+
+	// The written default reads back without problems, in strict mode
+	saved, problems, err := Read(path, nil)
+	if err != nil || len(problems) > 0 || !saved.Strict {
+		t.Errorf("Expected a valid strict default config, got %v %v", err, problems)
+	}
+}
+
+func TestLoadAppliesEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log"}`)
+
+	env := map[string]string{"LUSD_PORT": "9090", "LUSD_STALE_TIMEOUT": "soon", "LUSD_LOG_ENABLED": "false"}
+	cfg, err := Load(path, func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != 9090 || cfg.LogEnabled {
+		t.Errorf("Expected port and logEnabled overrides, got %d %v", cfg.Port, cfg.LogEnabled)
+	}
+	if cfg.StaleTimeout != time.Minute {
+		t.Errorf("Expected invalid override to be ignored, got %v", cfg.StaleTimeout)
+	}
+}
+
+func TestMissingSwitchesDefaultOn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log"}`)
+	cfg, problems, err := Read(path, nil)
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("Read failed: %v %v", err, problems)
+	}
+	if !cfg.LogEnabled || !cfg.LogCompress || !cfg.SnapshotEnabled || !cfg.UIEnabled || !cfg.EventsEnabled || !cfg.HistoryEnabled {
+		t.Errorf("Expected switches left out of the file to default to on, got %+v", cfg)
+	}
+	if cfg.Strict {
+		t.Error("Expected strict mode to stay off for files without it")
+	}
+
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log",
+		"snapshotEnabled": false, "uiEnabled": false, "events": {"enabled": false}, "history": {"enabled": false}}`)
+	cfg, _, _ = Read(path, nil)
+	if cfg.SnapshotEnabled || cfg.UIEnabled || cfg.EventsEnabled || cfg.HistoryEnabled {
+		t.Errorf("Expected switches turned off in the file to stay off, got %+v", cfg)
+	}
+}
+
+func TestLogRotationConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log",
+		"logMaxSizeMB": 5, "logRotateDaily": true, "logMaxBackups": 3, "logCompress": true}`)
+	cfg, problems, err := Read(path, nil)
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("Read failed: %v %v", err, problems)
+	}
+	if cfg.LogMaxSize != 5*1024*1024 || !cfg.LogRotateDaily || cfg.LogMaxBackups != 3 || !cfg.LogCompress {
+		t.Errorf("Unexpected rotation settings %d %v %d %v", cfg.LogMaxSize, cfg.LogRotateDaily, cfg.LogMaxBackups, cfg.LogCompress)
+	}
+
+	// Missing limits fall back to the defaults
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log"}`)
+	cfg, problems, _ = Read(path, nil)
+	if len(problems) > 0 || cfg.LogMaxSize != defaultLogMaxSizeMB*1024*1024 || cfg.LogMaxBackups != defaultLogMaxBackups {
+		t.Errorf("Expected default rotation limits, got %d %d %v", cfg.LogMaxSize, cfg.LogMaxBackups, problems)
+	}
+
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log", "logMaxSizeMB": -1, "logMaxBackups": -2}`)
+	if _, problems, _ = Read(path, nil); len(problems) != 2 {
+		t.Errorf("Expected two problems, got %v", problems)
+	}
+}
+
+func TestPersistState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log", "adminPersist": true, "officialServers": ["10.0.0.4:2301"]}`)
+	statePath := filepath.Join(dir, StateFile)
+
+	// Without a state file the config is unchanged
+	cfg, _, err := Read(path, nil)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if err := ApplyState(statePath, &cfg); err != nil || cfg.OfficialServers[0] != "10.0.0.4:2301" {
+		t.Fatalf("Expected no state to apply, got %v %v", cfg.OfficialServers, err)
+	}
+
+	cfg.Port = 9999 // not persisted
+	cfg.Blacklist = banset.New()
+	prefix, _ := banset.ParsePrefix("10.0.0.1")
+	cfg.Blacklist.Add(banset.Entry{Prefix: prefix})
+	cfg.OfficialServers = []string{"10.0.0.5:2301"}
+	cfg.Registrations = map[string]Registration{
+		"10.0.0.6:2301": {Address: "10.0.0.6:2301", Token: testRegistrationToken, Policy: PolicyOptional},
+	}
+	if err := Persist(statePath, cfg); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+
+	// The config file is left alone, the state replaces its lists
+	saved, _, err := Read(path, nil)
+	if err != nil || saved.Port != 8080 || saved.OfficialServers[0] != "10.0.0.4:2301" {
+		t.Fatalf("Expected the config file to be unchanged, got %v %v", saved.OfficialServers, err)
+	}
+	if err := ApplyState(statePath, &saved); err != nil {
+		t.Fatalf("ApplyState failed: %v", err)
+	}
+	if saved.Blacklist.Len() != 1 || len(saved.OfficialServers) != 1 || saved.OfficialServers[0] != "10.0.0.5:2301" || saved.Registrations["10.0.0.6:2301"].Policy != PolicyOptional {
+		t.Errorf("Unexpected state: %+v", saved)
+	}
+	if saved.Sources["officialServers"] != SourceState || saved.Sources["port"] != SourceFile {
+		t.Errorf("Unexpected sources: %v", saved.Sources)
+	}
+
+	// Settings from the environment win over the state
+	env := map[string]string{"LUSD_OFFICIAL_SERVERS": "10.0.0.7:2301"}
+	saved, _, _ = Read(path, func(key string) string { return env[key] })
+	if err := ApplyState(statePath, &saved); err != nil || saved.OfficialServers[0] != "10.0.0.7:2301" || saved.Blacklist.Len() != 1 {
+		t.Errorf("Expected the environment to win, got %v %v", saved.OfficialServers, err)
+	}
+
+	// Without adminPersist the state file is ignored
+	saved, _, _ = Read(path, nil)
+	saved.AdminPersist = false
+	if err := ApplyState(statePath, &saved); err != nil || saved.OfficialServers[0] != "10.0.0.4:2301" || saved.Blacklist.Len() != 0 {
+		t.Errorf("Expected the state to be ignored without adminPersist, got %v %v", saved.OfficialServers, err)
+	}
+
+	// An invalid state file is rejected as a whole
+	writeTestConfig(t, statePath, `{"blacklist": ["10.0.0.1"], "officialServers": ["bogus"]}`)
+	saved, _, _ = Read(path, nil)
+	if err := ApplyState(statePath, &saved); err == nil || saved.Blacklist.Len() != 0 {
+		t.Errorf("Expected an invalid state file to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"lusd/internal/banset"
+)
+
+// restartOnlyFields lists config fields that are only read at startup
+var restartOnlyFields = map[string]bool{
+	"Port":             true,
+	"LogFile":          true,
+	"LogEnabled":       true,
+	"LogFormat":        true,
+	"LogMaxSize":       true,
+	"LogRotateDaily":   true,
+	"LogMaxBackups":    true,
+	"LogCompress":      true,
+	"SnapshotFile":     true,
+	"SnapshotInterval": true,
+	"SnapshotEnabled":  true,
+	"ProbeEnabled":     true,
+	"ProbeInterval":    true,
+	"ChallengeEnabled": true,
+	"ConfigWatch":      true,
+	"MetricsEnabled":   true,
+	"MetricsListen":    true,
+	"ProxyProtocol":    true,
+	"TLSListen":        true,
+	"TLSCertFile":      true,
+	"TLSKeyFile":       true,
+	"TLSDisableHTTP":   true,
+	"TLSClientCAFile":  true,
+
+	"RateLimitMaxKeys":     true,
+	"RateLimitIdleTimeout": true,
+
+	"EventsMaxSubscribers": true,
+	"EventsBufferSize":     true,
+	"EventsHistory":        true,
+
+	"HistoryEnabled":    true,
+	"HistoryMaxServers": true,
+}
+
+// secretFields lists config fields whose values must never be logged
+var secretFields = map[string]bool{
+	"AdminToken":      true,
+	"FederationPeers": true, // peer tokens
+	"Registrations":   true, // signing tokens
+	"WebhookTargets":  true, // signing secrets
+}
+
+// Diff describes every field that differs between old and new
+func Diff(old, new Config) []string {
+	var changes []string
+	oldVal := reflect.ValueOf(old)
+	newVal := reflect.ValueOf(new)
+	typ := oldVal.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		name := typ.Field(i).Name
+		if name == "Sources" {
+			continue // describes the other fields
+		}
+		a := oldVal.Field(i).Interface()
+		b := newVal.Field(i).Interface()
+		if name == "Blacklist" {
+			// Compare bans by value, the trie layout may differ
+			a, b = banKeys(a.(*banset.Set)), banKeys(b.(*banset.Set))
+		}
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+
+		var change string
+		switch {
+		case secretFields[name]:
+			change = fmt.Sprintf("%s updated", name)
+		case name == "Blacklist":
+			added, removed := diffSets(a.([]string), b.([]string))
+			change = fmt.Sprintf("%s added %v, removed %v", name, added, removed)
+		case name == "OfficialServers":
+			added, removed := diffSets(a.([]string), b.([]string))
+			change = fmt.Sprintf("%s added %v, removed %v", name, added, removed)
+		default:
+			change = fmt.Sprintf("%s %v -> %v", name, a, b)
+		}
+		if restartOnlyFields[name] {
+			change += " (takes effect after restart)"
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// banKeys describes every ban of a set, including its reason and expiry
+func banKeys(set *banset.Set) []string {
+	keys := []string{}
+	for _, e := range set.Entries() {
+		key := e.Address()
+		if e.Reason != "" {
+			key += fmt.Sprintf(" (%s)", e.Reason)
+		}
+		if !e.Expires.IsZero() {
+			key += " until " + e.Expires.UTC().Format(time.RFC3339)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// diffSets returns the sorted values only in b (added) and only in a (removed)
+func diffSets(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool, len(a))
+	for _, v := range a {
+		inA[v] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+		if !inA[v] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range a {
+		if !inB[v] {
+			removed = append(removed, v)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
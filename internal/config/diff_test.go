@@ -0,0 +1,56 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"lusd/internal/banset"
+)
+
+// testBanSet builds a ban set of permanent bans
+func testBanSet(t *testing.T, ips ...string) *banset.Set {
+	t.Helper()
+	set := banset.New()
+	for _, ip := range ips {
+		prefix, err := banset.ParsePrefix(ip)
+		if err != nil {
+			t.Fatalf("Invalid test ban %s: %v", ip, err)
+		}
+		set.Add(banset.Entry{Prefix: prefix})
+	}
+	return set
+}
+
+func TestDiff(t *testing.T) {
+	old := Config{
+		Port:            80,
+		Blacklist:       testBanSet(t, "10.0.0.1"),
+		OfficialServers: []string{"10.0.0.5:2301"},
+		AdminToken:      "old-secret-token-value",
+	}
+	new := Config{
+		Port:            8080,
+		Blacklist:       testBanSet(t, "10.0.0.2", "10.1.0.0/16"),
+		OfficialServers: []string{"10.0.0.5:2301"},
+		AdminToken:      "new-secret-token-value",
+		MetricsEnabled:  true,
+	}
+
+	changes := strings.Join(Diff(old, new), "\n")
+	for _, expected := range []string{
+		"Port 80 -> 8080 (takes effect after restart)",
+		"Blacklist added [10.0.0.2 10.1.0.0/16], removed [10.0.0.1]",
+		"AdminToken updated",
+		"MetricsEnabled false -> true (takes effect after restart)",
+	} {
+		if !strings.Contains(changes, expected) {
+			t.Errorf("Expected diff to contain %q, got:\n%s", expected, changes)
+		}
+	}
+	if strings.Contains(changes, "secret") {
+		t.Error("Expected admin token to be redacted from diff")
+	}
+	if strings.Contains(changes, "OfficialServers") {
+		t.Error("Expected unchanged fields to be omitted")
+	}
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"lusd/internal/securefile"
+)
+
+// Environment variable constants
+const (
+	envPrefix         = "LUSD_"
+	envFileSuffix     = "_FILE"     // reads the value from the named file
+	maxSecretFileSize = 1024 * 1024 // 1MB max *_FILE size
+)
+
+// Setting sources other than an environment variable, which is reported by
+// its name
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+)
+
+// envAliases lists the variable names earlier releases used by setting
+var envAliases = map[string][]string{
+	"allowedUserAgent": {"LUSD_USER_AGENT"},
+}
+
+// setting is a leaf of the config.json schema that can be overridden from
+// the environment
+type setting struct {
+	path  string // JSON path such as tls.listen
+	env   string // variable such as LUSD_TLS_LISTEN
+	index []int  // field index in jsonConfig
+}
+
+// schema lists every setting of config.json. Sections are walked, any
+// other value, including lists and maps, is one setting.
+var schema = settings(reflect.TypeOf(jsonConfig{}), "", envPrefix, nil)
+
+// settings lists the settings of struct type t at path
+func settings(t reflect.Type, path, env string, index []int) []setting {
+	var list []setting
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		s := setting{
+			path:  name,
+			env:   env + envName(name),
+			index: append(append([]int{}, index...), i),
+		}
+		if path != "" {
+			s.path = path + "." + name
+		}
+		if f.Type.Kind() == reflect.Struct {
+			list = append(list, settings(f.Type, s.path, s.env+"_", s.index)...)
+			continue
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+// envName converts a camelCase JSON name to SCREAMING_SNAKE_CASE, keeping
+// acronyms together: logMaxSizeMB becomes LOG_MAX_SIZE_MB
+func envName(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// lookupEnv returns the value of the variable name, or the contents of the
+// file named by name_FILE with trailing newlines removed, and the variable
+// it came from. Setting both is an error.
+func lookupEnv(getenv func(string) string, name string) (string, string, error) {
+	value, file := getenv(name), getenv(name+envFileSuffix)
+	if file == "" {
+		return value, name, nil
+	}
+	if value != "" {
+		return "", name, fmt.Errorf("must not be set together with %s", name+envFileSuffix)
+	}
+	data, err := securefile.Read(file, maxSecretFileSize)
+	if err != nil {
+		return "", name + envFileSuffix, fmt.Errorf("could not read %s: %v", file, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), name + envFileSuffix, nil
+}
+
+// applyEnv overrides the settings of j with the environment variables
+// found through getenv. Returns the variable each overridden setting came
+// from, and a *FieldError for every value that does not fit its setting.
+// Unknown fields in JSON values are problems in strict mode, which can
+// itself be set from the environment as it comes first.
+func applyEnv(j *jsonConfig, getenv func(string) string) (map[string]string, []error) {
+	sources := make(map[string]string)
+	var problems []error
+	for _, s := range schema {
+		for _, name := range append([]string{s.env}, envAliases[s.path]...) {
+			raw, source, err := lookupEnv(getenv, name)
+			if err != nil {
+				problems = append(problems, &FieldError{Field: s.path, Reason: err.Error(), Source: source})
+				break
+			}
+			if raw == "" {
+				continue
+			}
+			field := reflect.ValueOf(j).Elem().FieldByIndex(s.index)
+			if errs := setEnvValue(field, s.path, raw, j.Strict); len(errs) > 0 {
+				for _, err := range errs {
+					err.(*FieldError).Source = source
+				}
+				problems = append(problems, errs...)
+				break
+			}
+			sources[s.path] = source
+			break
+		}
+	}
+	return sources, problems
+}
+
+// revertSetting copies the setting at path from file back into j
+func revertSetting(j, file *jsonConfig, path string) {
+	for _, s := range schema {
+		if s.path == path {
+			reflect.ValueOf(j).Elem().FieldByIndex(s.index).Set(reflect.ValueOf(file).Elem().FieldByIndex(s.index))
+		}
+	}
+}
+
+// setEnvValue parses raw into the setting field at path. Lists of strings
+// are comma separated, other lists, maps and objects are JSON.
+func setEnvValue(field reflect.Value, path, raw string, strict bool) []error {
+	invalid := func(reason string) []error {
+		return []error{&FieldError{Field: path, Value: raw, Reason: reason}}
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return invalid("must be true or false")
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return invalid("must be a whole number")
+		}
+		field.SetInt(int64(n))
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			list := []string{}
+			for _, entry := range strings.Split(raw, ",") {
+				if entry = strings.TrimSpace(entry); entry != "" {
+					list = append(list, entry)
+				}
+			}
+			field.Set(reflect.ValueOf(list))
+			return nil
+		}
+		fallthrough
+	default:
+		value := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(raw), value.Interface()); err != nil {
+			return invalid("must be " + jsonKind(field.Type()) + " in JSON")
+		}
+		if strict {
+			var decoded any
+			json.Unmarshal([]byte(raw), &decoded)
+			if errs := unknownFields(path, decoded, field.Type()); len(errs) > 0 {
+				return errs
+			}
+		}
+		field.Set(value.Elem())
+	}
+	return nil
+}
+
+// fileSources returns the source of every setting, SourceFile for those
+// present in raw, the decoded config file, and SourceDefault otherwise
+func fileSources(raw any) map[string]string {
+	sources := make(map[string]string, len(schema))
+	for _, s := range schema {
+		sources[s.path] = SourceDefault
+		v := raw
+		for _, key := range strings.Split(s.path, ".") {
+			obj, _ := v.(map[string]any)
+			v = obj[key]
+		}
+		if v != nil {
+			sources[s.path] = SourceFile
+		}
+	}
+	return sources
+}
+
+// envSetting returns the setting overridden from the environment that a
+// problem at field belongs to, such as blacklist for blacklist[2]
+func envSetting(field string, env map[string]string) (string, bool) {
+	for path := range env {
+		if field == path || strings.HasPrefix(field, path+".") || strings.HasPrefix(field, path+"[") {
+			return path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"port":                                "LUSD_PORT",
+		"logMaxSizeMB":                        "LUSD_LOG_MAX_SIZE_MB",
+		"tls.disableHTTP":                     "LUSD_TLS_DISABLE_HTTP",
+		"federation.nodeId":                   "LUSD_FEDERATION_NODE_ID",
+		"rateLimit.default.burst":             "LUSD_RATE_LIMIT_DEFAULT_BURST",
+		"registration.requireOfficial":        "LUSD_REGISTRATION_REQUIRE_OFFICIAL",
+		"officialServers":                     "LUSD_OFFICIAL_SERVERS",
+		"rateLimit.endpoints":                 "LUSD_RATE_LIMIT_ENDPOINTS",
+		"registration.servers":                "LUSD_REGISTRATION_SERVERS",
+		"federation.peers":                    "LUSD_FEDERATION_PEERS",
+		"rateLimit.default.requestsPerMinute": "LUSD_RATE_LIMIT_DEFAULT_REQUESTS_PER_MINUTE",
+	}
+	found := 0
+	for _, s := range schema {
+		if expected, ok := tests[s.path]; ok {
+			found++
+			if s.env != expected {
+				t.Errorf("Expected %s for %s, got %s", expected, s.path, s.env)
+			}
+		}
+	}
+	if found != len(tests) {
+		t.Errorf("Expected %d settings in the schema, found %d", len(tests), found)
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log", "blacklist": ["10.0.0.1"]}`)
+	tokenPath := filepath.Join(dir, "admin-token")
+	if err := os.WriteFile(tokenPath, []byte("admin-token-0123456789\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+
+	env := map[string]string{
+		"LUSD_BLACKLIST":        "10.0.0.2, 10.1.0.0/16",
+		"LUSD_OFFICIAL_SERVERS": "192.0.2.1:2301,192.0.2.2:2301",
+		"LUSD_ADMIN_TOKEN_FILE": tokenPath,
+		"LUSD_USER_AGENT":       "LU-Server/0.2",
+		"LUSD_TLS_LISTEN":       ":8443",
+		"LUSD_TLS_CERT_FILE":    "cert.pem",
+		"LUSD_TLS_KEY_FILE":     "key.pem",
+		"LUSD_FEDERATION_PEERS": `[{"name": "eu", "url": "https://eu.example.org/federation/v1/servers"}]`,
+	}
+	cfg, err := Load(path, func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	now := time.Now()
+	if cfg.Blacklist.Len() != 2 || cfg.Blacklist.Contains(netip.MustParseAddr("10.0.0.1"), now) || !cfg.Blacklist.Contains(netip.MustParseAddr("10.1.2.3"), now) {
+		t.Errorf("Expected the blacklist to be replaced, got %v", cfg.Blacklist.Entries())
+	}
+	if len(cfg.OfficialServers) != 2 || cfg.OfficialServers[1] != "192.0.2.2:2301" {
+		t.Errorf("Unexpected official servers: %v", cfg.OfficialServers)
+	}
+	if cfg.AdminToken != "admin-token-0123456789" {
+		t.Errorf("Expected the admin token from the file without the newline, got %q", cfg.AdminToken)
+	}
+	if cfg.AllowedUserAgent != "LU-Server/0.2" || cfg.TLSListen != ":8443" {
+		t.Errorf("Unexpected overrides: %q %q", cfg.AllowedUserAgent, cfg.TLSListen)
+	}
+	if len(cfg.FederationPeers) != 1 || cfg.FederationPeers[0].Name != "eu" {
+		t.Errorf("Unexpected federation peers: %+v", cfg.FederationPeers)
+	}
+
+	for path, expected := range map[string]string{
+		"port":             SourceFile,
+		"probeEnabled":     SourceDefault,
+		"blacklist":        "LUSD_BLACKLIST",
+		"adminToken":       "LUSD_ADMIN_TOKEN_FILE",
+		"allowedUserAgent": "LUSD_USER_AGENT",
+		"tls.listen":       "LUSD_TLS_LISTEN",
+	} {
+		if cfg.Sources[path] != expected {
+			t.Errorf("Expected source %s for %s, got %q", expected, path, cfg.Sources[path])
+		}
+	}
+}
+
+func TestLoadEnvProblems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log"}`)
+	env := map[string]string{
+		"LUSD_PORT":             "70000",
+		"LUSD_PROBE_ENABLED":    "maybe",
+		"LUSD_ADMIN_TOKEN":      "admin-token-0123456789",
+		"LUSD_ADMIN_TOKEN_FILE": "/run/secrets/admin-token",
+	}
+	getenv := func(key string) string { return env[key] }
+
+	// Without strict mode invalid overrides keep the file value
+	cfg, problems, err := Read(path, getenv)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	expected := []string{
+		`port: must be between 1 and 65535, got 70000 (from LUSD_PORT)`,
+		`probeEnabled: must be true or false, got "maybe" (from LUSD_PROBE_ENABLED)`,
+		`adminToken: must not be set together with LUSD_ADMIN_TOKEN_FILE (from LUSD_ADMIN_TOKEN)`,
+	}
+	for _, want := range expected {
+		found := false
+		for _, problem := range problems {
+			found = found || problem.Error() == want
+		}
+		if !found {
+			t.Errorf("Expected problem %q, got %v", want, problems)
+		}
+	}
+	if cfg.Port != 8080 || cfg.Sources["port"] != SourceFile || cfg.AdminToken != "" {
+		t.Errorf("Expected the file values to be kept, got %d %s %q", cfg.Port, cfg.Sources["port"], cfg.AdminToken)
+	}
+
+	// Strict mode, here from the environment, refuses them
+	env["LUSD_STRICT"] = "true"
+	if _, err := Load(path, getenv); err == nil || !strings.Contains(err.Error(), "(from LUSD_PORT)") {
+		t.Errorf("Expected strict mode to refuse invalid overrides, got %v", err)
+	}
+}
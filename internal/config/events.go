@@ -0,0 +1,54 @@
+package config
+
+import "fmt"
+
+// Event stream limits
+const (
+	defaultEventsMaxSubscribers = 256
+	defaultEventsBufferSize     = 64
+	defaultEventsHistory        = 1024
+
+	maxEventsMaxSubscribers = 65536
+	maxEventsBufferSize     = 4096
+	maxEventsHistory        = 65536
+)
+
+// jsonEvents is the events section of config.json
+type jsonEvents struct {
+	Enabled        bool `json:"enabled"`
+	MaxSubscribers int  `json:"maxSubscribers,omitempty"`
+	BufferSize     int  `json:"bufferSize,omitempty"`
+	History        int  `json:"history,omitempty"`
+}
+
+// parseEvents converts the events section, returning a *FieldError for
+// every invalid value. Zero values and invalid values mean the default.
+func parseEvents(j jsonEvents, cfg *Config) []error {
+	var problems []error
+
+	cfg.EventsEnabled = j.Enabled
+	limits := []struct {
+		field   string
+		value   int
+		maximum int
+		dst     *int
+		def     int
+	}{
+		{"events.maxSubscribers", j.MaxSubscribers, maxEventsMaxSubscribers, &cfg.EventsMaxSubscribers, defaultEventsMaxSubscribers},
+		{"events.bufferSize", j.BufferSize, maxEventsBufferSize, &cfg.EventsBufferSize, defaultEventsBufferSize},
+		{"events.history", j.History, maxEventsHistory, &cfg.EventsHistory, defaultEventsHistory},
+	}
+	for _, l := range limits {
+		*l.dst = l.def
+		if l.value == 0 {
+			continue
+		}
+		if l.value < 1 || l.value > l.maximum {
+			problems = append(problems, &FieldError{Field: l.field, Value: l.value, Reason: fmt.Sprintf("must be between 1 and %d", l.maximum)})
+			continue
+		}
+		*l.dst = l.value
+	}
+
+	return problems
+}
@@ -0,0 +1,22 @@
+package config
+
+import "testing"
+
+func TestParseEvents(t *testing.T) {
+	var cfg Config
+	if problems := parseEvents(jsonEvents{Enabled: true, BufferSize: 16}, &cfg); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+	if !cfg.EventsEnabled || cfg.EventsBufferSize != 16 || cfg.EventsMaxSubscribers != defaultEventsMaxSubscribers || cfg.EventsHistory != defaultEventsHistory {
+		t.Errorf("Unexpected event settings: %+v", cfg)
+	}
+
+	// Out of range limits fall back to their defaults
+	problems := parseEvents(jsonEvents{MaxSubscribers: -1, BufferSize: maxEventsBufferSize + 1, History: 10}, &cfg)
+	if len(problems) != 2 {
+		t.Errorf("Expected 2 problems, got %v", problems)
+	}
+	if cfg.EventsEnabled || cfg.EventsMaxSubscribers != defaultEventsMaxSubscribers || cfg.EventsBufferSize != defaultEventsBufferSize || cfg.EventsHistory != 10 {
+		t.Errorf("Expected defaults for invalid limits, got %+v", cfg)
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Federation defaults
+const (
+	defaultFederationPullInterval = time.Minute
+	defaultFederationStaleTimeout = 5 * time.Minute
+)
+
+// LocalSource attributes a listed server to local reports rather than a
+// federation peer
+const LocalSource = "local"
+
+// federationNodeIDPattern restricts node IDs to something safe to log and
+// compare
+var federationNodeIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// FederationPeer is another directory this one mirrors
+type FederationPeer struct {
+	Name         string        // source attribution, defaults to the URL host
+	URL          string        // feed to pull
+	Format       string        // "json" for a lusd federation feed, "txt" for a servers.txt list
+	Push         bool          // forward local reports to the peer
+	Token        string        // bearer token for pulls and pushes, and accepted for pushes from the peer
+	StaleTimeout time.Duration // how long a server stays listed after the peer last had it
+}
+
+// jsonFederationPeer is a peer as written in config.json
+type jsonFederationPeer struct {
+	Name         string `json:"name,omitempty"`
+	URL          string `json:"url"`
+	Format       string `json:"format,omitempty"`
+	Push         bool   `json:"push,omitempty"`
+	Token        string `json:"token,omitempty"`
+	StaleTimeout string `json:"staleTimeout,omitempty"`
+}
+
+// jsonFederation is the federation section of config.json
+type jsonFederation struct {
+	NodeID       string               `json:"nodeId,omitempty"`
+	Peers        []jsonFederationPeer `json:"peers"`
+	PullInterval string               `json:"pullInterval"`
+	StaleTimeout string               `json:"staleTimeout"`
+}
+
+// defaultFederationNodeID names this directory after its host
+func defaultFederationNodeID() string {
+	host, err := os.Hostname()
+	if err != nil || !federationNodeIDPattern.MatchString(host) {
+		return "lusd"
+	}
+	return host
+}
+
+// parseFederation converts the federation section, returning a *FieldError
+// for every invalid value. Invalid settings fall back to their defaults and
+// invalid peers are skipped.
+func parseFederation(j jsonFederation, cfg *Config) []error {
+	var problems []error
+
+	cfg.FederationNodeID = strings.TrimSpace(j.NodeID)
+	if cfg.FederationNodeID != "" && !federationNodeIDPattern.MatchString(cfg.FederationNodeID) {
+		problems = append(problems, &FieldError{Field: "federation.nodeId", Value: j.NodeID, Reason: "must be 1 to 64 letters, digits, dots, dashes or underscores"})
+		cfg.FederationNodeID = ""
+	}
+	if cfg.FederationNodeID == "" {
+		cfg.FederationNodeID = defaultFederationNodeID()
+	}
+
+	var err error
+	if cfg.FederationPullInterval, err = parseDuration("federation.pullInterval", j.PullInterval, time.Second, defaultFederationPullInterval); err != nil {
+		problems = append(problems, err)
+	}
+	if cfg.FederationStaleTimeout, err = parseDuration("federation.staleTimeout", j.StaleTimeout, 1, defaultFederationStaleTimeout); err != nil {
+		problems = append(problems, err)
+	}
+
+	cfg.FederationPeers = nil
+	names := make(map[string]bool)
+	for i, jp := range j.Peers {
+		field := fmt.Sprintf("federation.peers[%d]", i)
+		u, err := url.Parse(strings.TrimSpace(jp.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, &FieldError{Field: field + ".url", Value: jp.URL, Reason: "must be an http or https URL"})
+			continue
+		}
+		peer := FederationPeer{
+			Name:   strings.TrimSpace(jp.Name),
+			URL:    u.String(),
+			Format: jp.Format,
+			Push:   jp.Push,
+			Token:  jp.Token,
+		}
+		if peer.Name == "" {
+			peer.Name = u.Host
+		}
+		if peer.Name == LocalSource || names[peer.Name] {
+			problems = append(problems, &FieldError{Field: field + ".name", Value: peer.Name, Reason: "must be unique"})
+			continue
+		}
+		if peer.Format == "" {
+			peer.Format = "json"
+		}
+		if peer.StaleTimeout, err = parseDuration(field+".staleTimeout", jp.StaleTimeout, 1, cfg.FederationStaleTimeout); err != nil {
+			problems = append(problems, err)
+		}
+		if errs := peer.validate(field); len(errs) > 0 {
+			problems = append(problems, errs...)
+			continue
+		}
+		names[peer.Name] = true
+		cfg.FederationPeers = append(cfg.FederationPeers, peer)
+	}
+
+	return problems
+}
+
+// validate returns a *FieldError for every invalid setting of the peer at
+// field. The URL and name are checked against the other peers by the caller.
+func (p FederationPeer) validate(field string) []error {
+	var errs []error
+	if p.Format != "json" && p.Format != "txt" {
+		errs = append(errs, &FieldError{Field: field + ".format", Value: p.Format, Reason: `must be "json" or "txt"`})
+	} else if p.Push && p.Format != "json" {
+		errs = append(errs, &FieldError{Field: field + ".push", Value: p.Push, Reason: `needs the "json" format`})
+	}
+	if p.Token != "" && len(p.Token) < minTokenLen {
+		errs = append(errs, &FieldError{Field: field + ".token", Value: secret(p.Token), Reason: fmt.Sprintf("must be at least %d characters", minTokenLen)})
+	}
+	if p.StaleTimeout <= 0 {
+		errs = append(errs, &FieldError{Field: field + ".staleTimeout", Value: p.StaleTimeout.String(), Reason: "must be a positive duration"})
+	}
+	return errs
+}
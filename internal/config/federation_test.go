@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseFederation(t *testing.T) {
+	var j jsonFederation
+	err := json.Unmarshal([]byte(`{
+		"nodeId": "eu-1",
+		"pullInterval": "30s",
+		"staleTimeout": "3m",
+		"peers": [
+			{"url": "https://lusd.example.org/federation/v1/servers", "push": true, "token": "federation-token-0123456789"},
+			{"name": "legacy", "url": "http://old.example.org/servers.txt", "format": "txt", "staleTimeout": "10m"},
+			{"name": "legacy", "url": "http://dup.example.org/servers.txt", "format": "txt"},
+			{"url": "ftp://bad.example.org"},
+			{"url": "http://short.example.org", "token": "short"},
+			{"url": "http://txtpush.example.org", "format": "txt", "push": true}
+		]
+	}`), &j)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	var cfg Config
+	problems := parseFederation(j, &cfg)
+	if len(problems) != 4 {
+		t.Errorf("Expected 4 problems, got %v", problems)
+	}
+	if cfg.FederationNodeID != "eu-1" || cfg.FederationPullInterval != 30*time.Second {
+		t.Errorf("Unexpected federation settings: %s %v", cfg.FederationNodeID, cfg.FederationPullInterval)
+	}
+	if len(cfg.FederationPeers) != 2 {
+		t.Fatalf("Expected 2 valid peers, got %+v", cfg.FederationPeers)
+	}
+	if p := cfg.FederationPeers[0]; p.Name != "lusd.example.org" || p.Format != "json" || p.StaleTimeout != 3*time.Minute {
+		t.Errorf("Unexpected first peer: %+v", p)
+	}
+	if p := cfg.FederationPeers[1]; p.StaleTimeout != 10*time.Minute {
+		t.Errorf("Expected per-peer stale timeout, got %v", p.StaleTimeout)
+	}
+
+	if problems := parseFederation(jsonFederation{NodeID: "bad id!"}, &cfg); len(problems) != 1 || cfg.FederationNodeID == "" {
+		t.Errorf("Expected invalid node id to fall back to the hostname, got %q %v", cfg.FederationNodeID, problems)
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import "fmt"
+
+// Server history limits
+const (
+	defaultHistoryMaxServers = 1000
+	maxHistoryMaxServers     = 10000
+)
+
+// jsonHistory is the history section of config.json
+type jsonHistory struct {
+	Enabled    bool `json:"enabled"`
+	MaxServers int  `json:"maxServers,omitempty"`
+}
+
+// parseHistory converts the history section, returning a *FieldError for
+// an invalid value. Zero and invalid values mean the default.
+func parseHistory(j jsonHistory, cfg *Config) []error {
+	cfg.HistoryEnabled = j.Enabled
+	cfg.HistoryMaxServers = defaultHistoryMaxServers
+	if j.MaxServers == 0 {
+		return nil
+	}
+	if j.MaxServers < 1 || j.MaxServers > maxHistoryMaxServers {
+		return []error{&FieldError{Field: "history.maxServers", Value: j.MaxServers, Reason: fmt.Sprintf("must be between 1 and %d", maxHistoryMaxServers)}}
+	}
+	cfg.HistoryMaxServers = j.MaxServers
+	return nil
+}
@@ -0,0 +1,21 @@
+package config
+
+import "testing"
+
+func TestParseHistory(t *testing.T) {
+	var cfg Config
+	if problems := parseHistory(jsonHistory{Enabled: true, MaxServers: 50}, &cfg); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+	if !cfg.HistoryEnabled || cfg.HistoryMaxServers != 50 {
+		t.Errorf("Unexpected history settings: %+v", cfg)
+	}
+
+	// An out of range limit falls back to the default
+	if problems := parseHistory(jsonHistory{MaxServers: maxHistoryMaxServers + 1}, &cfg); len(problems) != 1 {
+		t.Errorf("Expected 1 problem, got %v", problems)
+	}
+	if cfg.HistoryEnabled || cfg.HistoryMaxServers != defaultHistoryMaxServers {
+		t.Errorf("Expected the default limit, got %+v", cfg)
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"lusd/internal/ratelimit"
+)
+
+// Rate limiter defaults
+const (
+	defaultRequestsPerMinute = 60
+	defaultRateLimitMaxKeys  = 100000
+	defaultRateLimitIdle     = 10 * time.Minute
+)
+
+// jsonLimit is a token bucket as written in config.json
+type jsonLimit struct {
+	RequestsPerMinute int `json:"requestsPerMinute"`
+	Burst             int `json:"burst,omitempty"`
+}
+
+// jsonCIDRLimit is a limit for every client inside a CIDR
+type jsonCIDRLimit struct {
+	CIDR string `json:"cidr"`
+	jsonLimit
+}
+
+// jsonRateLimit is the rateLimit section of config.json
+type jsonRateLimit struct {
+	Default     jsonLimit            `json:"default"`
+	Endpoints   map[string]jsonLimit `json:"endpoints,omitempty"`
+	CIDRs       []jsonCIDRLimit      `json:"cidrs,omitempty"`
+	MaxKeys     int                  `json:"maxKeys"`
+	IdleTimeout string               `json:"idleTimeout"`
+}
+
+// defaultRateLimitPolicy allows each client 60 requests per minute
+func defaultRateLimitPolicy() ratelimit.Policy {
+	return ratelimit.Policy{
+		Default: ratelimit.PerMinute(defaultRequestsPerMinute, defaultRequestsPerMinute),
+	}
+}
+
+// toLimit converts a config limit, a burst of 0 allows a full minute at once
+// and 0 requests per minute means unlimited
+func (l jsonLimit) toLimit() (ratelimit.Limit, bool) {
+	if l.RequestsPerMinute < 0 || l.Burst < 0 {
+		return ratelimit.Limit{}, false
+	}
+	burst := l.Burst
+	if burst == 0 {
+		burst = l.RequestsPerMinute
+	}
+	return ratelimit.PerMinute(l.RequestsPerMinute, burst), true
+}
+
+// fieldError describes why the limit at field is invalid, given the lowest
+// requests per minute allowed
+func (l jsonLimit) fieldError(field string, minRequests int) error {
+	if l.RequestsPerMinute < minRequests {
+		return &FieldError{Field: field + ".requestsPerMinute", Value: l.RequestsPerMinute, Reason: fmt.Sprintf("must be at least %d", minRequests)}
+	}
+	return &FieldError{Field: field + ".burst", Value: l.Burst, Reason: "must not be negative"}
+}
+
+// parseRateLimit converts the rateLimit section into the limiter policy and
+// settings, returning a *FieldError for every invalid value
+func parseRateLimit(j jsonRateLimit, cfg *Config) []error {
+	var problems []error
+	policy := defaultRateLimitPolicy()
+
+	// An omitted default keeps the built-in limit
+	if j.Default != (jsonLimit{}) {
+		if limit, ok := j.Default.toLimit(); ok && !limit.Unlimited() {
+			policy.Default = limit
+		} else {
+			problems = append(problems, j.Default.fieldError("rateLimit.default", 1))
+		}
+	}
+
+	for _, endpoint := range slices.Sorted(maps.Keys(j.Endpoints)) {
+		field := fmt.Sprintf("rateLimit.endpoints[%s]", endpoint)
+		limit, ok := j.Endpoints[endpoint].toLimit()
+		if !strings.HasPrefix(endpoint, "/") {
+			problems = append(problems, &FieldError{Field: field, Value: endpoint, Reason: `must be a path starting with "/"`})
+			continue
+		}
+		if !ok {
+			problems = append(problems, j.Endpoints[endpoint].fieldError(field, 0))
+			continue
+		}
+		if policy.Endpoints == nil {
+			policy.Endpoints = make(map[string]ratelimit.Limit)
+		}
+		policy.Endpoints[endpoint] = limit
+	}
+
+	for i, c := range j.CIDRs {
+		field := fmt.Sprintf("rateLimit.cidrs[%d]", i)
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(c.CIDR))
+		if err != nil {
+			problems = append(problems, &FieldError{Field: field + ".cidr", Value: c.CIDR, Reason: "must be a CIDR such as 10.0.0.0/8"})
+			continue
+		}
+		limit, ok := c.toLimit()
+		if !ok {
+			problems = append(problems, c.fieldError(field, 0))
+			continue
+		}
+		policy.CIDRs = append(policy.CIDRs, ratelimit.CIDRLimit{Prefix: prefix.Masked(), Limit: limit})
+	}
+	cfg.RateLimit = policy
+
+	cfg.RateLimitMaxKeys = j.MaxKeys
+	if cfg.RateLimitMaxKeys < 1 {
+		if j.MaxKeys != 0 {
+			problems = append(problems, &FieldError{Field: "rateLimit.maxKeys", Value: j.MaxKeys, Reason: "must be at least 1"})
+		}
+		cfg.RateLimitMaxKeys = defaultRateLimitMaxKeys
+	}
+
+	var err error
+	if cfg.RateLimitIdleTimeout, err = parseDuration("rateLimit.idleTimeout", j.IdleTimeout, 1, defaultRateLimitIdle); err != nil {
+		problems = append(problems, err)
+	}
+
+	return problems
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+	"time"
+
+	"lusd/internal/ratelimit"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	var j jsonRateLimit
+	err := json.Unmarshal([]byte(`{
+		"default": {"requestsPerMinute": 120, "burst": 20},
+		"endpoints": {"/report.php": {"requestsPerMinute": 10}, "bad": {"requestsPerMinute": 5}},
+		"cidrs": [{"cidr": "10.1.2.3/8", "requestsPerMinute": 0}, {"cidr": "nope", "requestsPerMinute": 1}],
+		"maxKeys": 500,
+		"idleTimeout": "5m"
+	}`), &j)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	var cfg Config
+	problems := parseRateLimit(j, &cfg)
+	if len(problems) != 2 {
+		t.Errorf("Expected 2 problems, got %v", problems)
+	}
+
+	if cfg.RateLimit.Default != ratelimit.PerMinute(120, 20) {
+		t.Errorf("Unexpected default limit: %+v", cfg.RateLimit.Default)
+	}
+	if got := cfg.RateLimit.Endpoints["/report.php"]; got != ratelimit.PerMinute(10, 10) {
+		t.Errorf("Expected burst to default to requestsPerMinute, got %+v", got)
+	}
+	if len(cfg.RateLimit.Endpoints) != 1 {
+		t.Errorf("Expected invalid endpoint to be skipped, got %v", cfg.RateLimit.Endpoints)
+	}
+	if len(cfg.RateLimit.CIDRs) != 1 || cfg.RateLimit.CIDRs[0].Prefix != netip.MustParsePrefix("10.0.0.0/8") {
+		t.Errorf("Expected one masked CIDR, got %+v", cfg.RateLimit.CIDRs)
+	}
+	if !cfg.RateLimit.CIDRs[0].Limit.Unlimited() {
+		t.Error("Expected 0 requests per minute to be unlimited")
+	}
+	if cfg.RateLimitMaxKeys != 500 || cfg.RateLimitIdleTimeout != 5*time.Minute {
+		t.Errorf("Unexpected limiter settings: %d keys, %v idle", cfg.RateLimitMaxKeys, cfg.RateLimitIdleTimeout)
+	}
+}
+
+func TestParseRateLimitDefaults(t *testing.T) {
+	var cfg Config
+	if problems := parseRateLimit(jsonRateLimit{}, &cfg); len(problems) != 0 {
+		t.Errorf("Expected no problems for an omitted section, got %v", problems)
+	}
+	if cfg.RateLimit.Default != ratelimit.PerMinute(60, 60) {
+		t.Errorf("Expected 60 requests per minute by default, got %+v", cfg.RateLimit.Default)
+	}
+	if cfg.RateLimitMaxKeys != defaultRateLimitMaxKeys || cfg.RateLimitIdleTimeout != defaultRateLimitIdle {
+		t.Errorf("Unexpected limiter settings: %d keys, %v idle", cfg.RateLimitMaxKeys, cfg.RateLimitIdleTimeout)
+	}
+}
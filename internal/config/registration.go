@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Registration constants
+const (
+	DefaultSignatureMaxSkew = 5 * time.Minute
+
+	PolicyRequired = "required" // unsigned reports are rejected
+	PolicyOptional = "optional" // unsigned reports are accepted, signed ones must verify
+)
+
+// Registration is a server whose operator holds a signing token
+type Registration struct {
+	Address string // canonical ip:port
+	Token   string
+	Policy  string
+}
+
+// jsonRegistration is a registration as written in config.json
+type jsonRegistration struct {
+	Address string `json:"address"`
+	Token   string `json:"token"`
+	Policy  string `json:"policy,omitempty"`
+}
+
+// jsonRegistrationConfig is the registration section of config.json
+type jsonRegistrationConfig struct {
+	RequireOfficial bool               `json:"requireOfficial"`
+	MaxSkew         string             `json:"maxSkew"`
+	Servers         []jsonRegistration `json:"servers"`
+}
+
+// parseRegistration converts the registration section, returning a
+// *FieldError for every invalid value. Invalid registrations are skipped.
+func parseRegistration(j jsonRegistrationConfig, cfg *Config) []error {
+	var problems []error
+
+	cfg.RegistrationRequireOfficial = j.RequireOfficial
+	var err error
+	if cfg.RegistrationMaxSkew, err = parseDuration("registration.maxSkew", j.MaxSkew, time.Second, DefaultSignatureMaxSkew); err != nil {
+		problems = append(problems, err)
+	}
+
+	cfg.Registrations = make(map[string]Registration)
+	for i, jr := range j.Servers {
+		field := fmt.Sprintf("registration.servers[%d]", i)
+		addr, _, ok := CanonicalServerAddr(jr.Address)
+		if !ok {
+			problems = append(problems, &FieldError{Field: field + ".address", Value: jr.Address, Reason: "must be an ip:port address"})
+			continue
+		}
+		if _, exists := cfg.Registrations[addr]; exists {
+			problems = append(problems, &FieldError{Field: field + ".address", Value: jr.Address, Reason: "is already registered"})
+			continue
+		}
+		reg := Registration{Address: addr, Token: jr.Token, Policy: jr.Policy}
+		if reg.Policy == "" {
+			reg.Policy = PolicyRequired
+		}
+		if errs := reg.validate(field); len(errs) > 0 {
+			problems = append(problems, errs...)
+			continue
+		}
+		cfg.Registrations[addr] = reg
+	}
+
+	return problems
+}
+
+// validate returns a *FieldError for every invalid setting of the
+// registration at field
+func (r Registration) validate(field string) []error {
+	var errs []error
+	if len(r.Token) < minTokenLen {
+		errs = append(errs, &FieldError{Field: field + ".token", Value: secret(r.Token), Reason: fmt.Sprintf("must be at least %d characters", minTokenLen)})
+	}
+	if r.Policy != PolicyRequired && r.Policy != PolicyOptional {
+		errs = append(errs, &FieldError{Field: field + ".policy", Value: r.Policy, Reason: fmt.Sprintf("must be %q or %q", PolicyRequired, PolicyOptional)})
+	}
+	return errs
+}
+
+// encodeRegistrations converts registrations back to their config.json
+// form, sorted by address
+func encodeRegistrations(regs map[string]Registration) []jsonRegistration {
+	list := []jsonRegistration{}
+	for _, reg := range regs {
+		list = append(list, jsonRegistration{Address: reg.Address, Token: reg.Token, Policy: reg.Policy})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+const testRegistrationToken = "registration-token-0123456789"
+
+func TestParseRegistration(t *testing.T) {
+	var cfg Config
+	problems := parseRegistration(jsonRegistrationConfig{
+		RequireOfficial: true,
+		MaxSkew:         "2m",
+		Servers: []jsonRegistration{
+			{Address: "[::ffff:10.0.0.1]:2301", Token: testRegistrationToken},
+			{Address: "10.0.0.1:2301", Token: testRegistrationToken},
+			{Address: "10.0.0.2", Token: testRegistrationToken},
+			{Address: "10.0.0.3:2301", Token: "short"},
+			{Address: "10.0.0.4:2301", Token: testRegistrationToken, Policy: "sometimes"},
+			{Address: "10.0.0.5:2301", Token: testRegistrationToken, Policy: PolicyOptional},
+		},
+	}, &cfg)
+	if len(problems) != 4 {
+		t.Errorf("Expected 4 problems, got %v", problems)
+	}
+	if !cfg.RegistrationRequireOfficial || cfg.RegistrationMaxSkew != 2*time.Minute {
+		t.Errorf("Unexpected registration settings: %v %v", cfg.RegistrationRequireOfficial, cfg.RegistrationMaxSkew)
+	}
+	if reg := cfg.Registrations["10.0.0.1:2301"]; reg.Policy != PolicyRequired {
+		t.Errorf("Expected canonical address with the required policy, got %+v", cfg.Registrations)
+	}
+	if reg := cfg.Registrations["10.0.0.5:2301"]; reg.Policy != PolicyOptional {
+		t.Errorf("Expected optional policy, got %+v", reg)
+	}
+
+	encoded := encodeRegistrations(cfg.Registrations)
+	if len(encoded) != 2 || encoded[0].Address != "10.0.0.1:2301" || encoded[1].Token != testRegistrationToken {
+		t.Errorf("Unexpected encoded registrations: %+v", encoded)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"lusd/internal/securefile"
+)
+
+// StateFile is the file in the state directory that admin changes are
+// saved to, so config.json itself can stay read only
+const StateFile = "admin-state.json"
+
+// SourceState is the source of a setting saved to the state file by the
+// admin API
+const SourceState = "state"
+
+// jsonState is the state file. It holds the settings the admin API
+// changes, in the same form as config.json.
+type jsonState struct {
+	Blacklist       []string  `json:"blacklist"`
+	Bans            []jsonBan `json:"bans,omitempty"`
+	OfficialServers []string  `json:"officialServers"`
+	Registration    struct {
+		Servers []jsonRegistration `json:"servers"`
+	} `json:"registration"`
+}
+
+// ApplyState replaces the bans, official servers and registrations of cfg
+// with those saved to the state file at statePath, if adminPersist is set
+// and the file exists. Settings overridden from the environment are kept.
+// The state file is written by Persist only, so any invalid value rejects
+// the whole file and leaves cfg unchanged.
+func ApplyState(statePath string, cfg *Config) error {
+	// A state file left from before adminPersist was turned off must not
+	// silently override config.json
+	if !cfg.AdminPersist {
+		return nil
+	}
+	if _, err := os.Stat(statePath); os.IsNotExist(err) {
+		return nil
+	}
+	data, err := securefile.Read(statePath, maxConfigFileSize)
+	if err != nil {
+		return fmt.Errorf("could not read state file")
+	}
+	var state jsonState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return parseError(err)
+	}
+
+	blacklist, problems := parseBans(state.Blacklist, state.Bans, time.Now())
+	official := []string{}
+	for i, addr := range state.OfficialServers {
+		if !ValidOfficialAddr(addr) {
+			problems = append(problems, &FieldError{Field: fmt.Sprintf("officialServers[%d]", i), Value: addr, Reason: "must be an IP address, optionally with a port"})
+			continue
+		}
+		official = append(official, addr)
+	}
+	var registrations Config
+	problems = append(problems, parseRegistration(jsonRegistrationConfig{Servers: state.Registration.Servers}, &registrations)...)
+	if len(problems) > 0 {
+		return errors.Join(problems...)
+	}
+
+	if cfg.Sources == nil {
+		cfg.Sources = make(map[string]string)
+	}
+	fromEnv := func(paths ...string) bool {
+		for _, path := range paths {
+			if source := cfg.Sources[path]; source != "" && source != SourceDefault && source != SourceFile {
+				return true
+			}
+		}
+		return false
+	}
+	if !fromEnv("blacklist", "bans") {
+		cfg.Blacklist = blacklist
+		cfg.Sources["blacklist"], cfg.Sources["bans"] = SourceState, SourceState
+	}
+	if !fromEnv("officialServers") {
+		cfg.OfficialServers = official
+		cfg.Sources["officialServers"] = SourceState
+	}
+	if !fromEnv("registration.servers") {
+		cfg.Registrations = registrations.Registrations
+		cfg.Sources["registration.servers"] = SourceState
+	}
+	return nil
+}
+
+// Persist writes the bans, official servers and registrations of cfg to
+// the state file at statePath, where ApplyState finds them on the next
+// start or reload. The config file is never written.
+func Persist(statePath string, cfg Config) error {
+	var state jsonState
+	state.Blacklist, state.Bans = encodeBans(cfg.Blacklist)
+	state.OfficialServers = append([]string{}, cfg.OfficialServers...)
+	state.Registration.Servers = encodeRegistrations(cfg.Registrations)
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("state encode error")
+	}
+	return securefile.WriteAtomic(statePath, data, configFileMode)
+}
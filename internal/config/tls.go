@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// jsonTLS is the tls section of config.json
+type jsonTLS struct {
+	Listen      string   `json:"listen"`
+	CertFile    string   `json:"certFile"`
+	KeyFile     string   `json:"keyFile"`
+	OnlyPaths   []string `json:"onlyPaths,omitempty"`
+	DisableHTTP bool     `json:"disableHTTP,omitempty"`
+	// ClientCAFile holds the CAs that issue admin client certificates
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+// parseTLS converts the tls section, returning a *FieldError for every
+// invalid value. TLS stays off unless a listener, certificate and key are
+// all set.
+func parseTLS(j jsonTLS, cfg *Config) []error {
+	var problems []error
+
+	cfg.TLSListen = strings.TrimSpace(j.Listen)
+	cfg.TLSCertFile = strings.TrimSpace(j.CertFile)
+	cfg.TLSKeyFile = strings.TrimSpace(j.KeyFile)
+	cfg.TLSDisableHTTP = j.DisableHTTP
+	cfg.TLSClientCAFile = strings.TrimSpace(j.ClientCAFile)
+	cfg.TLSOnlyPaths = nil
+
+	if cfg.TLSListen != "" {
+		if _, _, err := net.SplitHostPort(cfg.TLSListen); err != nil {
+			problems = append(problems, &FieldError{Field: "tls.listen", Value: j.Listen, Reason: "must be a host:port address"})
+			cfg.TLSListen = ""
+		} else if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			problems = append(problems, &FieldError{Field: "tls.listen", Value: j.Listen, Reason: "needs certFile and keyFile"})
+			cfg.TLSListen = ""
+		}
+	}
+
+	for i, path := range j.OnlyPaths {
+		path = strings.TrimSpace(path)
+		if !strings.HasPrefix(path, "/") {
+			problems = append(problems, &FieldError{Field: fmt.Sprintf("tls.onlyPaths[%d]", i), Value: path, Reason: `must start with "/"`})
+			continue
+		}
+		cfg.TLSOnlyPaths = append(cfg.TLSOnlyPaths, path)
+	}
+
+	// Without TLS these settings would lock everyone out
+	if cfg.TLSListen == "" {
+		if cfg.TLSDisableHTTP {
+			problems = append(problems, &FieldError{Field: "tls.disableHTTP", Value: j.DisableHTTP, Reason: "needs tls.listen"})
+			cfg.TLSDisableHTTP = false
+		}
+		if len(cfg.TLSOnlyPaths) > 0 {
+			problems = append(problems, &FieldError{Field: "tls.onlyPaths", Value: cfg.TLSOnlyPaths, Reason: "needs tls.listen"})
+			cfg.TLSOnlyPaths = nil
+		}
+		if cfg.TLSClientCAFile != "" {
+			problems = append(problems, &FieldError{Field: "tls.clientCAFile", Value: cfg.TLSClientCAFile, Reason: "needs tls.listen"})
+			cfg.TLSClientCAFile = ""
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestParseTLS(t *testing.T) {
+	var cfg Config
+	problems := parseTLS(jsonTLS{
+		Listen:      ":443",
+		CertFile:    "cert.pem",
+		KeyFile:     "key.pem",
+		OnlyPaths:   []string{"/admin/", "api/", " /servers.json "},
+		DisableHTTP: false,
+	}, &cfg)
+	if len(problems) != 1 {
+		t.Errorf("Expected 1 problem, got %v", problems)
+	}
+	if cfg.TLSListen != ":443" || len(cfg.TLSOnlyPaths) != 2 || cfg.TLSOnlyPaths[1] != "/servers.json" {
+		t.Errorf("Unexpected TLS settings: %+v", cfg)
+	}
+
+	// Settings that need TLS are dropped when it is off
+	problems = parseTLS(jsonTLS{Listen: ":443", OnlyPaths: []string{"/admin/"}, DisableHTTP: true, ClientCAFile: "ca.pem"}, &cfg)
+	if len(problems) != 4 {
+		t.Errorf("Expected 4 problems, got %v", problems)
+	}
+	if cfg.TLSListen != "" || cfg.TLSDisableHTTP || cfg.TLSOnlyPaths != nil || cfg.TLSClientCAFile != "" {
+		t.Errorf("Expected TLS to be off, got %+v", cfg)
+	}
+
+	if problems := parseTLS(jsonTLS{Listen: "443", CertFile: "c", KeyFile: "k"}, &cfg); len(problems) != 1 || cfg.TLSListen != "" {
+		t.Errorf("Expected invalid listen address to disable TLS, got %v", problems)
+	}
+}
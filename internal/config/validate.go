@@ -0,0 +1,286 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FieldError is an invalid config value, named by its path in config.json
+// such as tls.listen or federation.peers[1].token
+type FieldError struct {
+	Field  string
+	Value  any
+	Reason string
+	Source string // environment variable the value came from, if any
+}
+
+func (e *FieldError) Error() string {
+	msg := e.Field + ": " + e.Reason
+	switch value := e.Value.(type) {
+	case nil:
+	case string:
+		msg += fmt.Sprintf(", got %q", value)
+	default:
+		msg += fmt.Sprintf(", got %v", value)
+	}
+	if e.Source != "" {
+		msg += " (from " + e.Source + ")"
+	}
+	return msg
+}
+
+// secret is a token shown by its length only, so errors never leak it
+type secret string
+
+func (s secret) String() string {
+	return fmt.Sprintf("%d characters", len(s))
+}
+
+// Validate checks every setting of c, returning all invalid ones as
+// *FieldError values joined into one error. The same checks apply to a
+// config read at startup, on reload and after admin API changes.
+func (c Config) Validate() error {
+	return errors.Join(c.validate()...)
+}
+
+// validate returns a *FieldError for every invalid setting of c
+func (c Config) validate() []error {
+	var errs []error
+	check := func(ok bool, field string, value any, reason string) {
+		if !ok {
+			errs = append(errs, &FieldError{Field: field, Value: value, Reason: reason})
+		}
+	}
+	positive := func(field string, d time.Duration) {
+		check(d > 0, field, d.String(), durationReason(1))
+	}
+
+	check(c.Port >= 1 && c.Port <= 65535, "port", c.Port, "must be between 1 and 65535")
+	check(c.AllowedUserAgent != "", "allowedUserAgent", c.AllowedUserAgent, "must not be empty")
+	positive("staleTimeout", c.StaleTimeout)
+	for i, addr := range c.OfficialServers {
+		check(ValidOfficialAddr(addr), fmt.Sprintf("officialServers[%d]", i), addr, "must be an IP address, optionally with a port")
+	}
+
+	check(c.LogFile != "", "logFile", c.LogFile, "must not be empty")
+	check(c.LogFormat == "text" || c.LogFormat == "json", "logFormat", c.LogFormat, `must be "text" or "json"`)
+	check(c.LogMaxSize >= 1<<20 && c.LogMaxSize <= maxLogMaxSizeMB<<20, "logMaxSizeMB", c.LogMaxSize>>20, fmt.Sprintf("must be between 1 and %d", maxLogMaxSizeMB))
+	check(c.LogMaxBackups >= 1 && c.LogMaxBackups <= maxLogMaxBackups, "logMaxBackups", c.LogMaxBackups, fmt.Sprintf("must be between 1 and %d", maxLogMaxBackups))
+
+	check(c.SnapshotFile != "", "snapshotFile", c.SnapshotFile, "must not be empty")
+	positive("snapshotInterval", c.SnapshotInterval)
+
+	positive("probeInterval", c.ProbeInterval)
+	positive("probeTimeout", c.ProbeTimeout)
+	check(c.ProbeConcurrency >= 1 && c.ProbeConcurrency <= 1024, "probeConcurrency", c.ProbeConcurrency, "must be between 1 and 1024")
+	check(c.ProbeRate >= 1 && c.ProbeRate <= 10000, "probeRate", c.ProbeRate, "must be between 1 and 10000")
+	check(c.ProbeMaxFailures >= 1, "probeMaxFailures", c.ProbeMaxFailures, "must be at least 1")
+	positive("challengeTimeout", c.ChallengeTimeout)
+
+	// A short token is as good as none
+	check(c.AdminToken == "" || len(c.AdminToken) >= minTokenLen, "adminToken", secret(c.AdminToken), fmt.Sprintf("must be at least %d characters", minTokenLen))
+
+	if c.MetricsListen != "" {
+		_, _, err := net.SplitHostPort(c.MetricsListen)
+		check(err == nil, "metricsListen", c.MetricsListen, "must be a host:port address")
+	}
+	check(!c.ProxyProtocol || len(c.TrustedProxies) > 0, "proxyProtocol", c.ProxyProtocol, "needs trustedProxies, PROXY headers would be ignored")
+
+	if c.TLSListen != "" {
+		_, _, err := net.SplitHostPort(c.TLSListen)
+		check(err == nil, "tls.listen", c.TLSListen, "must be a host:port address")
+		check(c.TLSCertFile != "" && c.TLSKeyFile != "", "tls.listen", c.TLSListen, "needs certFile and keyFile")
+	} else {
+		// Without TLS these settings would lock everyone out
+		check(!c.TLSDisableHTTP, "tls.disableHTTP", c.TLSDisableHTTP, "needs tls.listen")
+		check(len(c.TLSOnlyPaths) == 0, "tls.onlyPaths", c.TLSOnlyPaths, "needs tls.listen")
+	}
+	for i, path := range c.TLSOnlyPaths {
+		check(strings.HasPrefix(path, "/"), fmt.Sprintf("tls.onlyPaths[%d]", i), path, `must start with "/"`)
+	}
+
+	check(!c.RateLimit.Default.Unlimited(), "rateLimit.default.requestsPerMinute", 0, "must be at least 1")
+	check(c.RateLimitMaxKeys >= 1, "rateLimit.maxKeys", c.RateLimitMaxKeys, "must be at least 1")
+	positive("rateLimit.idleTimeout", c.RateLimitIdleTimeout)
+
+	check(federationNodeIDPattern.MatchString(c.FederationNodeID), "federation.nodeId", c.FederationNodeID, "must be 1 to 64 letters, digits, dots, dashes or underscores")
+	check(c.FederationPullInterval >= time.Second, "federation.pullInterval", c.FederationPullInterval.String(), durationReason(time.Second))
+	positive("federation.staleTimeout", c.FederationStaleTimeout)
+	names := make(map[string]bool)
+	for i, peer := range c.FederationPeers {
+		field := fmt.Sprintf("federation.peers[%d]", i)
+		u, err := url.Parse(peer.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", field+".url", peer.URL, "must be an http or https URL")
+		check(peer.Name != LocalSource && !names[peer.Name], field+".name", peer.Name, "must be unique")
+		names[peer.Name] = true
+		errs = append(errs, peer.validate(field)...)
+	}
+
+	check(c.RegistrationMaxSkew >= time.Second, "registration.maxSkew", c.RegistrationMaxSkew.String(), durationReason(time.Second))
+	for _, addr := range slices.Sorted(maps.Keys(c.Registrations)) {
+		errs = append(errs, c.Registrations[addr].validate(fmt.Sprintf("registration.servers[%s]", addr))...)
+	}
+
+	check(c.EventsMaxSubscribers >= 1 && c.EventsMaxSubscribers <= maxEventsMaxSubscribers, "events.maxSubscribers", c.EventsMaxSubscribers, fmt.Sprintf("must be between 1 and %d", maxEventsMaxSubscribers))
+	check(c.EventsBufferSize >= 1 && c.EventsBufferSize <= maxEventsBufferSize, "events.bufferSize", c.EventsBufferSize, fmt.Sprintf("must be between 1 and %d", maxEventsBufferSize))
+	check(c.EventsHistory >= 1 && c.EventsHistory <= maxEventsHistory, "events.history", c.EventsHistory, fmt.Sprintf("must be between 1 and %d", maxEventsHistory))
+
+	check(c.WebhookMaxAttempts >= 1 && c.WebhookMaxAttempts <= maxWebhookMaxAttempts, "webhooks.maxAttempts", c.WebhookMaxAttempts, fmt.Sprintf("must be between 1 and %d", maxWebhookMaxAttempts))
+	check(c.WebhookTimeout >= time.Second, "webhooks.timeout", c.WebhookTimeout.String(), durationReason(time.Second))
+	check(c.WebhookQueueSize >= 1 && c.WebhookQueueSize <= maxWebhookQueueSize, "webhooks.queueSize", c.WebhookQueueSize, fmt.Sprintf("must be between 1 and %d", maxWebhookQueueSize))
+	check(c.WebhookAbuseThreshold >= 1 && c.WebhookAbuseThreshold <= maxWebhookAbuseThreshold, "webhooks.abuseThreshold", c.WebhookAbuseThreshold, fmt.Sprintf("must be between 1 and %d", maxWebhookAbuseThreshold))
+	check(c.WebhookAbuseWindow >= time.Second, "webhooks.abuseWindow", c.WebhookAbuseWindow.String(), durationReason(time.Second))
+	targets := make(map[string]bool)
+	for i, target := range c.WebhookTargets {
+		field := fmt.Sprintf("webhooks.targets[%d]", i)
+		u, err := url.Parse(target.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", field+".url", target.URL, "must be an http or https URL")
+		check(!targets[target.Name], field+".name", target.Name, "must be unique")
+		targets[target.Name] = true
+		errs = append(errs, target.validate(field)...)
+	}
+
+	check(c.HistoryMaxServers >= 1 && c.HistoryMaxServers <= maxHistoryMaxServers, "history.maxServers", c.HistoryMaxServers, fmt.Sprintf("must be between 1 and %d", maxHistoryMaxServers))
+
+	return errs
+}
+
+// fallBack replaces each invalid setting named by errs with its default, or
+// drops the invalid entries of a list. Sections parsed by their own parsers
+// have already fallen back.
+func (c *Config) fallBack(errs []error) {
+	def := Default()
+	for _, err := range errs {
+		var fe *FieldError
+		if !errors.As(err, &fe) {
+			continue
+		}
+		switch fe.Field {
+		case "port":
+			c.Port = def.Port
+		case "allowedUserAgent":
+			c.AllowedUserAgent = def.AllowedUserAgent
+		case "staleTimeout":
+			c.StaleTimeout = def.StaleTimeout
+		case "logFile":
+			c.LogFile = def.LogFile
+		case "logFormat":
+			c.LogFormat = def.LogFormat
+		case "logMaxSizeMB":
+			c.LogMaxSize = def.LogMaxSize
+		case "logMaxBackups":
+			c.LogMaxBackups = def.LogMaxBackups
+		case "snapshotFile":
+			c.SnapshotFile = def.SnapshotFile
+		case "snapshotInterval":
+			c.SnapshotInterval = def.SnapshotInterval
+		case "probeInterval":
+			c.ProbeInterval = def.ProbeInterval
+		case "probeTimeout":
+			c.ProbeTimeout = def.ProbeTimeout
+		case "probeConcurrency":
+			c.ProbeConcurrency = def.ProbeConcurrency
+		case "probeRate":
+			c.ProbeRate = def.ProbeRate
+		case "probeMaxFailures":
+			c.ProbeMaxFailures = def.ProbeMaxFailures
+		case "challengeTimeout":
+			c.ChallengeTimeout = def.ChallengeTimeout
+		case "adminToken":
+			c.AdminToken = "" // admin API disabled
+		case "metricsListen":
+			c.MetricsListen = "" // metrics on the main listener
+		case "proxyProtocol":
+			c.ProxyProtocol = false // no header would be trusted anyway
+		}
+		if strings.HasPrefix(fe.Field, "officialServers[") {
+			var valid []string
+			for _, addr := range c.OfficialServers {
+				if ValidOfficialAddr(addr) {
+					valid = append(valid, addr)
+				}
+			}
+			c.OfficialServers = valid
+		}
+	}
+}
+
+// unknownFields returns a *FieldError for every key of v, the decoded
+// JSON value at path, that has no field in t. Keys must match the field
+// names exactly, unlike encoding/json which ignores case.
+func unknownFields(path string, v any, t reflect.Type) []error {
+	var errs []error
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		fields := jsonFields(t)
+		for _, key := range sortedKeys(obj) {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			ft, ok := fields[key]
+			if !ok {
+				errs = append(errs, &FieldError{Field: field, Value: obj[key], Reason: "unknown field"})
+				continue
+			}
+			errs = append(errs, unknownFields(field, obj[key], ft)...)
+		}
+	case reflect.Slice:
+		list, _ := v.([]any)
+		for i, elem := range list {
+			errs = append(errs, unknownFields(fmt.Sprintf("%s[%d]", path, i), elem, t.Elem())...)
+		}
+	case reflect.Map:
+		obj, _ := v.(map[string]any)
+		for _, key := range sortedKeys(obj) {
+			errs = append(errs, unknownFields(fmt.Sprintf("%s[%s]", path, key), obj[key], t.Elem())...)
+		}
+	}
+	return errs
+}
+
+// sortedKeys returns the keys of obj in order, so errors are reported in
+// the same order on every run
+func sortedKeys(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonFields maps the JSON names of the fields of struct type t, including
+// those of embedded structs, to their types
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && name == "" {
+			for n, ft := range jsonFields(f.Type) {
+				fields[n] = ft
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if name != "-" {
+			fields[name] = f.Type
+		}
+	}
+	return fields
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("Expected the default config to be valid, got %v", err)
+	}
+	if Default().MetricsEnabled {
+		t.Error("Expected metrics to be off by default, they are public without metricsListen")
+	}
+
+	cfg := Default()
+	cfg.Port = 70000
+	cfg.AdminToken = "short-secret"
+	cfg.OfficialServers = []string{"192.0.2.1:2301", "lusd.example.org"}
+	cfg.TLSDisableHTTP = true
+	err := cfg.Validate()
+
+	expected := []string{
+		`port: must be between 1 and 65535, got 70000`,
+		`officialServers[1]: must be an IP address, optionally with a port, got "lusd.example.org"`,
+		`adminToken: must be at least 16 characters, got 12 characters`,
+		`tls.disableHTTP: needs tls.listen, got true`,
+	}
+	if got := strings.Split(err.Error(), "\n"); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected validation errors:\n%s", err)
+	}
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != "port" || fe.Value != 70000 {
+		t.Errorf("Expected a *FieldError for the port, got %#v", fe)
+	}
+}
+
+func TestReadStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"strict": true, "port": 8080, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "soon", "logFile": "lusd.log",
+		"Port": 9090, "tls": {"lisen": ":443"}, "rateLimit": {"endpoints": {"/report.php": {"requestsPerMinute": 10, "brust": 5}}},
+		"federation": {"peers": [{"url": "https://lusd.example.org", "tokn": "x"}]}}`)
+
+	_, problems, err := Read(path, nil)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	expected := []string{
+		`Port: unknown field, got 9090`,
+		`federation.peers[0].tokn: unknown field, got "x"`,
+		`rateLimit.endpoints[/report.php].brust: unknown field, got 5`,
+		`tls.lisen: unknown field, got ":443"`,
+		`staleTimeout: must be a duration such as "30s", got "soon"`,
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %v", len(expected), problems)
+	}
+	for i, problem := range problems {
+		if problem.Error() != expected[i] {
+			t.Errorf("Expected problem %q, got %q", expected[i], problem)
+		}
+	}
+
+	// Load refuses a strict config with problems
+	if _, err := Load(path, noEnv); err == nil || !strings.Contains(err.Error(), "tls.lisen") {
+		t.Errorf("Expected Load to fail with every problem, got %v", err)
+	}
+
+	// Without strict mode unknown fields are ignored and invalid values fall back
+	writeTestConfig(t, path, `{"port": 70000, "allowedUserAgent": "LU-Server/0.1", "staleTimeout": "1m", "logFile": "lusd.log", "prot": 80}`)
+	cfg, err := Load(path, noEnv)
+	if err != nil || cfg.Port != 80 {
+		t.Errorf("Expected the default port, got %d %v", cfg.Port, err)
+	}
+
+	// A value of the wrong type is named even without strict mode
+	writeTestConfig(t, path, `{"port": "8080"}`)
+	if _, _, err := Read(path, nil); err == nil || !strings.Contains(err.Error(), `port: must be a number, got "string"`) {
+		t.Errorf("Expected a type error naming the field, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Webhook events
+const (
+	WebhookServerRegistered    = "server_registered"    // an address reported that was not listed
+	WebhookOfficialUnreachable = "official_unreachable" // an official server went stale or stopped answering probes
+	WebhookAbuse               = "abuse"                // an IP was rate limited or dropped as blacklisted repeatedly
+)
+
+// WebhookEvents lists every webhook event
+var WebhookEvents = []string{WebhookServerRegistered, WebhookOfficialUnreachable, WebhookAbuse}
+
+// Webhook defaults
+const (
+	defaultWebhookMaxAttempts    = 8
+	defaultWebhookTimeout        = 10 * time.Second
+	defaultWebhookQueueSize      = 1000
+	defaultWebhookAbuseThreshold = 20
+	defaultWebhookAbuseWindow    = time.Minute
+
+	maxWebhookMaxAttempts    = 100
+	maxWebhookQueueSize      = 100000
+	maxWebhookAbuseThreshold = 10000
+)
+
+// WebhookTarget is a URL notified of events
+type WebhookTarget struct {
+	Name   string   // in logs and the queue, defaults to the URL host
+	URL    string   // receives a POST per event
+	Secret string   // HMAC-SHA256 key of the body signature
+	Events []string // events sent to this target, empty for all
+}
+
+// Wants reports whether event is sent to t
+func (t WebhookTarget) Wants(event string) bool {
+	return len(t.Events) == 0 || slices.Contains(t.Events, event)
+}
+
+// jsonWebhookTarget is a target as written in config.json
+type jsonWebhookTarget struct {
+	Name   string   `json:"name,omitempty"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events,omitempty"`
+}
+
+// jsonWebhooks is the webhooks section of config.json
+type jsonWebhooks struct {
+	Targets        []jsonWebhookTarget `json:"targets"`
+	MaxAttempts    int                 `json:"maxAttempts,omitempty"`
+	Timeout        string              `json:"timeout,omitempty"`
+	QueueSize      int                 `json:"queueSize,omitempty"`
+	AbuseThreshold int                 `json:"abuseThreshold,omitempty"`
+	AbuseWindow    string              `json:"abuseWindow,omitempty"`
+}
+
+// parseWebhooks converts the webhooks section, returning a *FieldError for
+// every invalid value. Invalid settings fall back to their defaults and
+// invalid targets are skipped.
+func parseWebhooks(j jsonWebhooks, cfg *Config) []error {
+	var problems []error
+
+	limits := []struct {
+		field   string
+		value   int
+		maximum int
+		dst     *int
+		def     int
+	}{
+		{"webhooks.maxAttempts", j.MaxAttempts, maxWebhookMaxAttempts, &cfg.WebhookMaxAttempts, defaultWebhookMaxAttempts},
+		{"webhooks.queueSize", j.QueueSize, maxWebhookQueueSize, &cfg.WebhookQueueSize, defaultWebhookQueueSize},
+		{"webhooks.abuseThreshold", j.AbuseThreshold, maxWebhookAbuseThreshold, &cfg.WebhookAbuseThreshold, defaultWebhookAbuseThreshold},
+	}
+	for _, l := range limits {
+		*l.dst = l.def
+		if l.value == 0 {
+			continue
+		}
+		if l.value < 1 || l.value > l.maximum {
+			problems = append(problems, &FieldError{Field: l.field, Value: l.value, Reason: fmt.Sprintf("must be between 1 and %d", l.maximum)})
+			continue
+		}
+		*l.dst = l.value
+	}
+
+	var err error
+	if cfg.WebhookTimeout, err = parseDuration("webhooks.timeout", j.Timeout, time.Second, defaultWebhookTimeout); err != nil {
+		problems = append(problems, err)
+	}
+	if cfg.WebhookAbuseWindow, err = parseDuration("webhooks.abuseWindow", j.AbuseWindow, time.Second, defaultWebhookAbuseWindow); err != nil {
+		problems = append(problems, err)
+	}
+
+	cfg.WebhookTargets = nil
+	names := make(map[string]bool)
+	for i, jt := range j.Targets {
+		field := fmt.Sprintf("webhooks.targets[%d]", i)
+		u, err := url.Parse(strings.TrimSpace(jt.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, &FieldError{Field: field + ".url", Value: jt.URL, Reason: "must be an http or https URL"})
+			continue
+		}
+		target := WebhookTarget{
+			Name:   strings.TrimSpace(jt.Name),
+			URL:    u.String(),
+			Secret: jt.Secret,
+			Events: jt.Events,
+		}
+		if target.Name == "" {
+			target.Name = u.Host
+		}
+		if names[target.Name] {
+			problems = append(problems, &FieldError{Field: field + ".name", Value: target.Name, Reason: "must be unique"})
+			continue
+		}
+		if errs := target.validate(field); len(errs) > 0 {
+			problems = append(problems, errs...)
+			continue
+		}
+		names[target.Name] = true
+		cfg.WebhookTargets = append(cfg.WebhookTargets, target)
+	}
+
+	return problems
+}
+
+// validate returns a *FieldError for every invalid setting of the target
+// at field. The URL and name are checked against the other targets by the
+// caller.
+func (t WebhookTarget) validate(field string) []error {
+	var errs []error
+	if len(t.Secret) < minTokenLen {
+		errs = append(errs, &FieldError{Field: field + ".secret", Value: secret(t.Secret), Reason: fmt.Sprintf("must be at least %d characters", minTokenLen)})
+	}
+	for i, event := range t.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			errs = append(errs, &FieldError{Field: fmt.Sprintf("%s.events[%d]", field, i), Value: event, Reason: "must be one of " + strings.Join(WebhookEvents, ", ")})
+		}
+	}
+	return errs
+}
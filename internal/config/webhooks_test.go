@@ -0,0 +1,42 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseWebhooks(t *testing.T) {
+	var j jsonWebhooks
+	err := json.Unmarshal([]byte(`{
+		"timeout": "5s",
+		"abuseThreshold": 5,
+		"queueSize": -1,
+		"targets": [
+			{"url": "https://hooks.example.org/lusd", "secret": "webhook-secret-0123456789"},
+			{"name": "mods", "url": "http://mods.example.org", "secret": "webhook-secret-0123456789", "events": ["abuse"]},
+			{"name": "mods", "url": "http://dup.example.org", "secret": "webhook-secret-0123456789"},
+			{"url": "ftp://bad.example.org", "secret": "webhook-secret-0123456789"},
+			{"url": "http://short.example.org", "secret": "short"},
+			{"url": "http://typo.example.org", "secret": "webhook-secret-0123456789", "events": ["server_gone"]}
+		]
+	}`), &j)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	var cfg Config
+	problems := parseWebhooks(j, &cfg)
+	if len(problems) != 5 {
+		t.Errorf("Expected 5 problems, got %v", problems)
+	}
+	if len(cfg.WebhookTargets) != 2 || cfg.WebhookTargets[0].Name != "hooks.example.org" {
+		t.Fatalf("Expected 2 targets, got %+v", cfg.WebhookTargets)
+	}
+	if !cfg.WebhookTargets[0].Wants(WebhookAbuse) || cfg.WebhookTargets[1].Wants(WebhookServerRegistered) {
+		t.Errorf("Unexpected event filters: %+v", cfg.WebhookTargets)
+	}
+	if cfg.WebhookTimeout != 5*time.Second || cfg.WebhookAbuseThreshold != 5 || cfg.WebhookQueueSize != defaultWebhookQueueSize || cfg.WebhookMaxAttempts != defaultWebhookMaxAttempts {
+		t.Errorf("Unexpected webhook settings: %+v", cfg)
+	}
+}
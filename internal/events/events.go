@@ -0,0 +1,186 @@
+// Package events fans changes of the directory out to stream subscribers.
+// A bounded history lets reconnecting clients resume where they left off,
+// and subscribers that fall behind are dropped rather than slowing down
+// the publisher.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Event is one change, numbered in publishing order
+type Event struct {
+	ID   uint64          `json:"id"`
+	Type string          `json:"type"`
+	Time int64           `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Options bound the memory a Bus may use
+type Options struct {
+	History        int // events kept for resuming subscribers
+	MaxSubscribers int // concurrent subscribers
+	Buffer         int // events queued per subscriber before it is dropped
+}
+
+var (
+	ErrTooManySubscribers = errors.New("too many subscribers")
+	ErrClosed             = errors.New("event bus closed")
+)
+
+// Bus publishes events to its subscribers
+type Bus struct {
+	mu      sync.Mutex
+	opts    Options
+	lastID  uint64
+	history []Event // ring buffer of the last opts.History events
+	next    int     // index in history the next event is written to
+	subs    map[*Subscription]struct{}
+	closed  bool
+}
+
+// Subscription receives the events published after it was created on C.
+// C is closed once the subscription ends, because it was closed, the bus
+// was closed or the subscriber fell behind.
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	bus     *Bus
+	dropped bool
+}
+
+// New returns a bus with the given limits
+func New(opts Options) *Bus {
+	opts.History = max(opts.History, 1)
+	opts.MaxSubscribers = max(opts.MaxSubscribers, 1)
+	opts.Buffer = max(opts.Buffer, 1)
+	return &Bus{
+		opts:    opts,
+		history: make([]Event, 0, opts.History),
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends an event of type typ with data encoded as JSON to every
+// subscriber. It never blocks: subscribers whose buffer is full are
+// dropped and can resume from the history.
+func (b *Bus) Publish(typ string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.lastID++
+	e := Event{ID: b.lastID, Type: typ, Time: time.Now().Unix(), Data: raw}
+	if len(b.history) < b.opts.History {
+		b.history = append(b.history, e)
+	} else {
+		b.history[b.next] = e
+	}
+	b.next = (b.next + 1) % b.opts.History
+
+	for sub := range b.subs {
+		select {
+		case sub.c <- e:
+		default:
+			sub.dropped = true
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe starts a subscription. With lastID above zero the events
+// published after lastID are returned to be sent first; resumed is false
+// if some of them are no longer in the history, or lastID is unknown, in
+// which case the subscriber has to start over from the full list.
+func (b *Bus) Subscribe(lastID uint64) (sub *Subscription, missed []Event, resumed bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, nil, false, ErrClosed
+	}
+	if len(b.subs) >= b.opts.MaxSubscribers {
+		return nil, nil, false, ErrTooManySubscribers
+	}
+
+	resumed = true
+	if lastID > 0 {
+		events := b.ordered()
+		switch {
+		case lastID > b.lastID:
+			resumed = false // from before a restart
+		case len(events) > 0 && lastID < events[0].ID-1:
+			resumed = false // fell out of the history
+		}
+		if resumed {
+			for _, e := range events {
+				if e.ID > lastID {
+					missed = append(missed, e)
+				}
+			}
+		}
+	}
+
+	c := make(chan Event, b.opts.Buffer)
+	sub = &Subscription{C: c, c: c, bus: b}
+	b.subs[sub] = struct{}{}
+	return sub, missed, resumed, nil
+}
+
+// Subscribers returns the number of current subscribers
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Close ends every subscription and stops publishing, so streams end
+// before a shutdown waits for them
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		b.remove(sub)
+	}
+}
+
+// ordered returns the history oldest first. Callers must hold the lock.
+func (b *Bus) ordered() []Event {
+	if len(b.history) < b.opts.History {
+		return b.history
+	}
+	return append(append([]Event{}, b.history[b.next:]...), b.history[:b.next]...)
+}
+
+// remove ends sub. Callers must hold the lock.
+func (b *Bus) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// Dropped reports whether the subscription ended because the subscriber
+// fell behind. Only meaningful once C is closed.
+func (s *Subscription) Dropped() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
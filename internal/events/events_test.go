@@ -0,0 +1,69 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBusResume(t *testing.T) {
+	bus := New(Options{History: 3, MaxSubscribers: 2, Buffer: 8})
+	for i := 0; i < 5; i++ {
+		bus.Publish("tick", i)
+	}
+
+	// Events still in the history are replayed
+	sub, missed, resumed, err := bus.Subscribe(3)
+	if err != nil || !resumed || len(missed) != 2 || missed[0].ID != 4 || string(missed[1].Data) != "4" {
+		t.Fatalf("Expected events 4 and 5, got %+v %v %v", missed, resumed, err)
+	}
+	sub.Close()
+
+	// Events that fell out of the history, or come from an earlier run, cannot be resumed
+	for _, lastID := range []uint64{1, 6} {
+		sub, missed, resumed, err = bus.Subscribe(lastID)
+		if err != nil || resumed || missed != nil {
+			t.Errorf("Expected Subscribe(%d) not to resume, got %+v %v %v", lastID, missed, resumed, err)
+		}
+		sub.Close()
+	}
+
+	// New events reach the subscriber
+	sub, _, _, _ = bus.Subscribe(0)
+	bus.Publish("tick", 5)
+	if e := <-sub.C; e.ID != 6 || e.Type != "tick" {
+		t.Errorf("Expected event 6, got %+v", e)
+	}
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected the channel to be closed")
+	}
+}
+
+func TestBusLimits(t *testing.T) {
+	bus := New(Options{History: 8, MaxSubscribers: 2, Buffer: 2})
+	slow, _, _, _ := bus.Subscribe(0)
+	fast, _, _, _ := bus.Subscribe(0)
+	if _, _, _, err := bus.Subscribe(0); !errors.Is(err, ErrTooManySubscribers) {
+		t.Errorf("Expected the subscriber limit, got %v", err)
+	}
+
+	// A subscriber that falls behind is dropped, the others keep receiving
+	for i := 0; i < 3; i++ {
+		bus.Publish("tick", i)
+		<-fast.C
+	}
+	for range slow.C {
+	}
+	if !slow.Dropped() || fast.Dropped() || bus.Subscribers() != 1 {
+		t.Errorf("Expected only the slow subscriber to be dropped, %d left", bus.Subscribers())
+	}
+
+	// Closing the bus ends every subscription
+	bus.Close()
+	if _, ok := <-fast.C; ok || fast.Dropped() {
+		t.Error("Expected the subscription to end without being dropped")
+	}
+	if _, _, _, err := bus.Subscribe(0); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
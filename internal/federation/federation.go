@@ -0,0 +1,314 @@
+// Package federation mirrors peer directories and serves this directory's
+// servers to them.
+package federation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/store"
+)
+
+// FeedPath is where directories serve their feed and accept pushes
+const FeedPath = "/federation/v1/servers"
+
+// Federation limits
+const (
+	maxRecords     = 10000
+	maxFeedSize    = 4 * 1024 * 1024 // 4MB
+	maxPushSize    = 64 * 1024       // 64KB
+	requestTimeout = 10 * time.Second
+	pushQueue      = 1024
+	pushBatch      = 100
+	pushInterval   = time.Second
+)
+
+// Feed is the body of the feed and of pushes
+type Feed struct {
+	Node    string                  `json:"node"`
+	Servers []store.FederatedRecord `json:"servers"`
+}
+
+// buildFeed returns the servers this node lists, with this node appended to
+// each record's via chain. Official servers that were never reported are
+// left out, each directory configures its own.
+func buildFeed(s *store.ServerList) Feed {
+	node := s.GetConfig().FederationNodeID
+	feed := Feed{Node: node, Servers: []store.FederatedRecord{}}
+	for _, rec := range s.GetRecords() {
+		if rec.LastSeen == 0 {
+			continue
+		}
+		via := []string{node}
+		if !slices.Contains(rec.Sources, config.LocalSource) {
+			via = append(slices.Clone(rec.Via), node)
+		}
+		feed.Servers = append(feed.Servers, store.FederatedRecord{
+			Address:  rec.Address,
+			LastSeen: rec.LastSeen,
+			Info:     rec.Info,
+			Via:      via,
+		})
+	}
+	return feed
+}
+
+// Federation pulls peer directories and pushes local reports to them
+type Federation struct {
+	servers   *store.ServerList
+	userAgent string
+	client    *http.Client
+	pushes    chan store.FederatedRecord
+}
+
+// New returns a federation of servers identifying itself as userAgent
+func New(servers *store.ServerList, userAgent string) *Federation {
+	return &Federation{
+		servers:   servers,
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: requestTimeout},
+		pushes:    make(chan store.FederatedRecord, pushQueue),
+	}
+}
+
+// Run pulls every peer on the configured interval and delivers pushes
+// until ctx is done. Peers are read from the current config on every pull,
+// so they follow config reloads.
+func (f *Federation) Run(ctx context.Context) {
+	go f.pushLoop(ctx)
+
+	for {
+		f.pullAll(ctx)
+		f.servers.ExpireFederated(time.Now())
+
+		timer := time.NewTimer(f.servers.GetConfig().FederationPullInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// pullAll pulls every peer once
+func (f *Federation) pullAll(ctx context.Context) {
+	for _, peer := range f.servers.GetConfig().FederationPeers {
+		n, err := f.pull(ctx, peer)
+		if err != nil {
+			slog.Warn("Federation pull failed", "peer", peer.Name, "error", err)
+			continue
+		}
+		slog.Info("Federation pulled servers", "peer", peer.Name, "count", n)
+	}
+}
+
+// pull fetches one peer's feed and merges it
+func (f *Federation) pull(ctx context.Context, peer config.FederationPeer) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	if peer.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+peer.Token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body := io.LimitReader(resp.Body, maxFeedSize)
+
+	var records []store.FederatedRecord
+	if peer.Format == "txt" {
+		records, err = parseServersTxt(body)
+	} else {
+		records, err = parseFederationFeed(body, f.servers.GetConfig().FederationNodeID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return f.servers.MergeFederated(peer.Name, peer.StaleTimeout, records, time.Now()), nil
+}
+
+// parseServersTxt reads a servers.txt list, one ip:port per line
+func parseServersTxt(r io.Reader) ([]store.FederatedRecord, error) {
+	var records []store.FederatedRecord
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(records) == maxRecords {
+			return nil, fmt.Errorf("more than %d servers", maxRecords)
+		}
+		records = append(records, store.FederatedRecord{Address: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// parseFederationFeed reads a JSON feed, rejecting a feed served by this
+// node itself
+func parseFederationFeed(r io.Reader, node string) ([]store.FederatedRecord, error) {
+	var feed Feed
+	if err := json.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("invalid feed")
+	}
+	if feed.Node == node {
+		return nil, fmt.Errorf("peer has our node id %s", node)
+	}
+	if len(feed.Servers) > maxRecords {
+		return nil, fmt.Errorf("more than %d servers", maxRecords)
+	}
+	return feed.Servers, nil
+}
+
+// Push queues a listed local server for the peers with push enabled.
+// Servers are dropped when the queue is full rather than blocking the
+// server list, peers still see them on their next pull.
+func (f *Federation) Push(addr string, info *store.ServerInfo) {
+	rec := store.FederatedRecord{Address: addr, LastSeen: time.Now().Unix(), Info: info.Clone()}
+	select {
+	case f.pushes <- rec:
+	default:
+	}
+}
+
+// pushLoop sends queued reports in batches
+func (f *Federation) pushLoop(ctx context.Context) {
+	ticker := time.NewTicker(pushInterval)
+	defer ticker.Stop()
+
+	var batch []store.FederatedRecord
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rec := <-f.pushes:
+			batch = append(batch, rec)
+			if len(batch) < pushBatch {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		f.pushAll(ctx, batch)
+		batch = nil
+	}
+}
+
+// pushAll sends one batch of local reports to every push peer
+func (f *Federation) pushAll(ctx context.Context, batch []store.FederatedRecord) {
+	cfg := f.servers.GetConfig()
+	if !slices.ContainsFunc(cfg.FederationPeers, func(p config.FederationPeer) bool { return p.Push }) {
+		return
+	}
+	feed := Feed{Node: cfg.FederationNodeID, Servers: batch}
+	for i := range feed.Servers {
+		feed.Servers[i].Via = []string{cfg.FederationNodeID}
+	}
+	data, err := json.Marshal(feed)
+	if err != nil {
+		return
+	}
+
+	for _, peer := range cfg.FederationPeers {
+		if !peer.Push {
+			continue
+		}
+		if err := f.push(ctx, peer, data); err != nil {
+			slog.Warn("Federation push failed", "peer", peer.Name, "error", err)
+		}
+	}
+}
+
+// push posts one batch to a peer
+func (f *Federation) push(ctx context.Context, peer config.FederationPeer, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", f.userAgent)
+	if peer.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+peer.Token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pushingPeer returns the peer whose token authorizes r
+func pushingPeer(r *http.Request, peers []config.FederationPeer) (config.FederationPeer, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return config.FederationPeer{}, false
+	}
+	for _, peer := range peers {
+		if peer.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(peer.Token)) == 1 {
+			return peer, true
+		}
+	}
+	return config.FederationPeer{}, false
+}
+
+// Handler serves the feed to peers and accepts their pushes
+func (f *Federation) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+			json.NewEncoder(w).Encode(buildFeed(f.servers))
+
+		case http.MethodPost:
+			cfg := f.servers.GetConfig()
+			peer, ok := pushingPeer(r, cfg.FederationPeers)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="lusd-federation"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxPushSize)
+			records, err := parseFederationFeed(r.Body, cfg.FederationNodeID)
+			if err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			f.servers.MergeFederated(peer.Name, peer.StaleTimeout, records, time.Now())
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+// Package history keeps uptime and player counts of every reported server
+// beyond the time it is listed. Samples are kept per minute for a day and
+// per hour for a month, and persisted to a compact binary file in the state
+// directory.
+package history
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"lusd/internal/securefile"
+)
+
+// History constants
+const (
+	File = "history.dat" // in the state directory
+
+	MinuteRetention = 24 * time.Hour      // minute buckets kept
+	HourRetention   = 30 * 24 * time.Hour // hour buckets kept
+
+	fileMagic       = "LUSH"
+	fileVersion     = 1
+	fileMode        = 0600              // Owner read/write only
+	maxFileSize     = 512 * 1024 * 1024 // 512MB, far above 10000 servers with full buckets
+	maxAddrLen      = 255
+	persistInterval = 5 * time.Minute // how often changes are written and old buckets pruned
+)
+
+// bucket sums the samples of one minute or one hour
+type bucket struct {
+	start     int64  // unix time the interval starts at
+	up        uint16 // minutes the server was listed
+	reports   uint16 // heartbeats received
+	probes    uint16 // answered probes
+	failed    uint16 // unanswered probes
+	peak      uint16 // most players seen
+	playerSum uint32 // players summed over samples, for the average
+	samples   uint16 // player count samples
+}
+
+// series is the history of one address
+type series struct {
+	since   int64 // first sample, uptime is computed from then on
+	minutes []bucket
+	hours   []bucket
+}
+
+// last returns the start of the newest bucket of s
+func (s *series) last() int64 {
+	if n := len(s.minutes); n > 0 {
+		return s.minutes[n-1].start
+	}
+	if n := len(s.hours); n > 0 {
+		return s.hours[n-1].start
+	}
+	return s.since
+}
+
+// Recorder collects samples per address. The zero value is not usable,
+// create one with New. A nil Recorder records nothing, so history can be
+// disabled without checks at every call site.
+type Recorder struct {
+	path       string
+	maxServers int
+
+	mu     sync.Mutex
+	series map[string]*series
+	dirty  bool
+}
+
+// New returns a recorder that keeps at most maxServers addresses and
+// persists them to path
+func New(path string, maxServers int) *Recorder {
+	return &Recorder{
+		path:       path,
+		maxServers: max(maxServers, 1),
+		series:     make(map[string]*series),
+	}
+}
+
+// Heartbeat records a report from addr at t
+func (r *Recorder) Heartbeat(addr string, t time.Time) {
+	if r == nil {
+		return
+	}
+	r.record(addr, t, func(b *bucket, _ bool) { b.reports = inc(b.reports, 1) })
+}
+
+// Probe records a probe of addr at t and whether it was answered
+func (r *Recorder) Probe(addr string, t time.Time, answered bool) {
+	if r == nil {
+		return
+	}
+	r.record(addr, t, func(b *bucket, _ bool) {
+		if answered {
+			b.probes = inc(b.probes, 1)
+		} else {
+			b.failed = inc(b.failed, 1)
+		}
+	})
+}
+
+// Listed records that addr was in the list at t with players online, or
+// an unknown number of players if players is negative. It is meant to be
+// called once a minute; further calls within a minute only add player
+// samples.
+func (r *Recorder) Listed(addr string, t time.Time, players int) {
+	if r == nil {
+		return
+	}
+	r.record(addr, t, func(b *bucket, newMinute bool) {
+		if newMinute {
+			b.up = inc(b.up, 1)
+		}
+		if players >= 0 {
+			b.peak = max(b.peak, uint16(min(players, 0xFFFF)))
+			b.playerSum += uint32(players)
+			b.samples = inc(b.samples, 1)
+		}
+	})
+}
+
+// record applies update to the minute and hour buckets of addr at t.
+// update is told whether the minute was not up before, so each minute is
+// only counted once.
+func (r *Recorder) record(addr string, t time.Time, update func(b *bucket, newMinute bool)) {
+	if len(addr) > maxAddrLen {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.series[addr]
+	if !ok {
+		if len(r.series) >= r.maxServers {
+			r.evictOldest()
+		}
+		s = &series{since: t.Unix()}
+		r.series[addr] = s
+	}
+	minute := bucketAt(&s.minutes, t.Truncate(time.Minute).Unix())
+	hour := bucketAt(&s.hours, t.Truncate(time.Hour).Unix())
+	if minute == nil || hour == nil {
+		return // from before a clock change
+	}
+	newMinute := minute.up == 0
+	update(minute, newMinute)
+	update(hour, newMinute)
+	r.dirty = true
+}
+
+// evictOldest drops the address heard from longest ago to make room for a
+// new one. Callers must hold the lock.
+func (r *Recorder) evictOldest() {
+	var oldest string
+	var oldestLast int64
+	for addr, s := range r.series {
+		if last := s.last(); oldest == "" || last < oldestLast {
+			oldest, oldestLast = addr, last
+		}
+	}
+	delete(r.series, oldest)
+}
+
+// bucketAt returns the bucket starting at start, appending it if it is
+// newer than the last one. Returns nil for a start before the last bucket
+// that has no bucket of its own.
+func bucketAt(buckets *[]bucket, start int64) *bucket {
+	b := *buckets
+	if n := len(b); n == 0 || b[n-1].start < start {
+		*buckets = append(b, bucket{start: start})
+		return &(*buckets)[len(*buckets)-1]
+	}
+	i := sort.Search(len(b), func(i int) bool { return b[i].start >= start })
+	if i < len(b) && b[i].start == start {
+		return &b[i]
+	}
+	return nil
+}
+
+// inc adds n to v without wrapping
+func inc(v uint16, n int) uint16 {
+	return uint16(min(int(v)+n, 0xFFFF))
+}
+
+// Len returns the number of addresses with history
+func (r *Recorder) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.series)
+}
+
+// prune drops buckets past their retention and addresses left without
+// any
+func (r *Recorder) prune(now time.Time) {
+	minuteCutoff := now.Add(-MinuteRetention).Truncate(time.Minute).Unix()
+	hourCutoff := now.Add(-HourRetention).Truncate(time.Hour).Unix()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for addr, s := range r.series {
+		minutes, hours := len(s.minutes), len(s.hours)
+		s.minutes = dropBefore(s.minutes, minuteCutoff)
+		s.hours = dropBefore(s.hours, hourCutoff)
+		if len(s.minutes) == 0 && len(s.hours) == 0 {
+			delete(r.series, addr)
+		}
+		if len(s.minutes) != minutes || len(s.hours) != hours {
+			r.dirty = true
+		}
+	}
+}
+
+// dropBefore removes the buckets starting before cutoff, reusing the slice
+func dropBefore(buckets []bucket, cutoff int64) []bucket {
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].start >= cutoff })
+	if i == 0 {
+		return buckets
+	}
+	return append(buckets[:0], buckets[i:]...)
+}
+
+// Run prunes old buckets and persists changes until ctx is done
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.prune(time.Now())
+		if err := r.Save(); err != nil {
+			slog.Error("Error writing server history", "error", err)
+		}
+	}
+}
+
+// Save writes the history to the file if it changed since the last write
+func (r *Recorder) Save() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	if !r.dirty {
+		r.mu.Unlock()
+		return nil
+	}
+	data := r.encode()
+	r.dirty = false
+	r.mu.Unlock()
+
+	if err := securefile.WriteAtomic(r.path, data, fileMode); err != nil {
+		r.mu.Lock()
+		r.dirty = true
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Load reads the history written by a previous run, dropping buckets past
+// their retention. A missing file is not an error. Returns the number of
+// addresses restored.
+func (r *Recorder) Load() (int, error) {
+	if _, err := os.Stat(r.path); os.IsNotExist(err) {
+		return 0, nil
+	}
+	data, err := securefile.Read(r.path, maxFileSize)
+	if err != nil {
+		return 0, err
+	}
+	restored, err := decode(data)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	for addr, s := range restored {
+		// Keep the newest addresses if the limit was lowered
+		if len(r.series) >= r.maxServers {
+			r.evictOldest()
+		}
+		r.series[addr] = s
+	}
+	r.mu.Unlock()
+	r.prune(time.Now())
+	return r.Len(), nil
+}
+
+// The file starts with a magic, a version and the number of addresses.
+// Each address follows as its length and bytes, the time of its first
+// sample, then the minute and the hour buckets, each preceded by their
+// number. All integers are little endian.
+
+// encode serializes the history. Callers must hold the lock.
+func (r *Recorder) encode() []byte {
+	out := append([]byte(fileMagic), fileVersion)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(r.series)))
+	for addr, s := range r.series {
+		out = append(out, byte(len(addr)))
+		out = append(out, addr...)
+		out = binary.LittleEndian.AppendUint64(out, uint64(s.since))
+		for _, buckets := range [][]bucket{s.minutes, s.hours} {
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(buckets)))
+			for _, b := range buckets {
+				out = binary.LittleEndian.AppendUint32(out, uint32(b.start/60))
+				for _, v := range []uint16{b.up, b.reports, b.probes, b.failed, b.peak} {
+					out = binary.LittleEndian.AppendUint16(out, v)
+				}
+				out = binary.LittleEndian.AppendUint32(out, b.playerSum)
+				out = binary.LittleEndian.AppendUint16(out, b.samples)
+			}
+		}
+	}
+	return out
+}
+
+var errCorrupt = errors.New("history file corrupt")
+
+// decoder reads little endian integers, remembering the first error
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || len(d.buf) < n {
+		d.err = errCorrupt
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) u8() uint8   { return d.next(1)[0] }
+func (d *decoder) u16() uint16 { return binary.LittleEndian.Uint16(d.next(2)) }
+func (d *decoder) u32() uint32 { return binary.LittleEndian.Uint32(d.next(4)) }
+func (d *decoder) u64() uint64 { return binary.LittleEndian.Uint64(d.next(8)) }
+
+// decode parses a history file
+func decode(data []byte) (map[string]*series, error) {
+	d := &decoder{buf: data}
+	if string(d.next(len(fileMagic))) != fileMagic {
+		return nil, fmt.Errorf("not a history file")
+	}
+	if v := d.u8(); v != fileVersion {
+		return nil, fmt.Errorf("unsupported history version %d", v)
+	}
+
+	count := d.u32()
+	restored := make(map[string]*series)
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		addr := string(d.next(int(d.u8())))
+		s := &series{since: int64(d.u64())}
+		for _, buckets := range []*[]bucket{&s.minutes, &s.hours} {
+			n := d.u32()
+			// Every bucket takes 20 bytes, so a bogus count fails early
+			if uint64(n)*20 > uint64(len(d.buf)) {
+				return nil, errCorrupt
+			}
+			*buckets = make([]bucket, 0, n)
+			for j := uint32(0); j < n; j++ {
+				b := bucket{start: int64(d.u32()) * 60}
+				b.up, b.reports, b.probes, b.failed, b.peak = d.u16(), d.u16(), d.u16(), d.u16(), d.u16()
+				b.playerSum = d.u32()
+				b.samples = d.u16()
+				// Buckets must be in order for the lookups
+				if k := len(*buckets); k > 0 && (*buckets)[k-1].start >= b.start {
+					return nil, errCorrupt
+				}
+				*buckets = append(*buckets, b)
+			}
+		}
+		restored[addr] = s
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return restored, nil
+}
@@ -0,0 +1,119 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testAddr = "192.0.2.1:2301"
+
+func TestRecorder(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), File), 10)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A minute is counted once however often it is sampled
+	r.Listed(testAddr, start, 2)
+	r.Listed(testAddr, start.Add(30*time.Second), 4)
+	r.Heartbeat(testAddr, start.Add(10*time.Second))
+	r.Probe(testAddr, start.Add(20*time.Second), true)
+	r.Listed(testAddr, start.Add(time.Minute), -1)
+	r.Probe(testAddr, start.Add(time.Minute), false)
+
+	now := start.Add(2 * time.Minute)
+	report, ok := r.Get(testAddr, now, time.Minute)
+	if !ok || len(report.Points) != 2 {
+		t.Fatalf("Expected two minutes, got %+v", report)
+	}
+	if p := report.Points[0]; p.Time != start.Unix() || p.Up != 1 || p.Reports != 1 || p.Probes != 1 || p.Players != 3 || p.PeakPlayers != 4 {
+		t.Errorf("Unexpected first minute %+v", p)
+	}
+	if p := report.Points[1]; p.Up != 1 || p.FailedProbes != 1 || p.Players != 0 {
+		t.Errorf("Unexpected second minute %+v", p)
+	}
+
+	// Minutes add up in the hour
+	report, _ = r.Get(testAddr, now, time.Hour)
+	if len(report.Points) != 1 {
+		t.Fatalf("Expected one hour, got %+v", report.Points)
+	}
+	if p := report.Points[0]; p.Up != 2 || p.Reports != 1 || p.Probes != 1 || p.FailedProbes != 1 || p.Players != 3 {
+		t.Errorf("Unexpected hour %+v", p)
+	}
+	if report.Uptime.Day != 1 || report.Uptime.Month != 1 {
+		t.Errorf("Expected full uptime, got %+v", report.Uptime)
+	}
+
+	// Two more minutes without samples halve the uptime
+	if report, _ := r.Get(testAddr, now.Add(2*time.Minute), time.Hour); report.Uptime.Day != 0.5 || report.Uptime.Month != 0.5 {
+		t.Errorf("Expected half uptime, got %+v", report.Uptime)
+	}
+
+	if _, ok := r.Get("192.0.2.2:2301", now, time.Hour); ok {
+		t.Error("Expected no history for an unknown address")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), File), 2)
+	start := time.Now().Add(-2 * 24 * time.Hour)
+	r.Listed(testAddr, start, 1)
+	r.Listed("192.0.2.2:2301", start.Add(time.Hour), 1)
+
+	// Minutes are kept for a day, hours for a month
+	r.prune(time.Now())
+	report, ok := r.Get(testAddr, time.Now(), time.Minute)
+	if !ok || len(report.Points) != 0 {
+		t.Errorf("Expected no minutes, got %+v", report)
+	}
+	if report, _ := r.Get(testAddr, time.Now(), time.Hour); len(report.Points) != 1 {
+		t.Errorf("Expected one hour, got %+v", report.Points)
+	}
+	r.prune(time.Now().Add(HourRetention))
+	if r.Len() != 0 {
+		t.Errorf("Expected old addresses to be dropped, got %d", r.Len())
+	}
+
+	// The address seen longest ago makes room for a new one
+	r.Listed(testAddr, start, 1)
+	r.Listed("192.0.2.2:2301", start.Add(time.Hour), 1)
+	r.Heartbeat("192.0.2.3:2301", start.Add(2*time.Hour))
+	if _, ok := r.Get(testAddr, time.Now(), time.Hour); ok || r.Len() != 2 {
+		t.Errorf("Expected the oldest address to be evicted, %d left", r.Len())
+	}
+}
+
+func TestPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+	r := New(path, 10)
+	now := time.Now()
+	r.Listed(testAddr, now.Add(-time.Minute), 5)
+	r.Probe(testAddr, now.Add(-time.Minute), true)
+	r.Listed("[2001:db8::1]:2301", now, -1)
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	restored := New(path, 10)
+	if n, err := restored.Load(); err != nil || n != 2 {
+		t.Fatalf("Expected 2 addresses, got %d: %v", n, err)
+	}
+	want, _ := r.Get(testAddr, now, time.Minute)
+	got, _ := restored.Get(testAddr, now, time.Minute)
+	if len(got.Points) != 1 || got.Points[0] != want.Points[0] || got.Since != want.Since {
+		t.Errorf("Expected %+v after a restart, got %+v", want, got)
+	}
+
+	// A missing file is an empty history, a damaged one an error
+	if n, err := New(filepath.Join(t.TempDir(), File), 10).Load(); n != 0 || err != nil {
+		t.Errorf("Expected an empty history, got %d: %v", n, err)
+	}
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, data[:len(data)-3], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(path, 10).Load(); err == nil {
+		t.Error("Expected an error for a truncated file")
+	}
+}
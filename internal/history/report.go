@@ -0,0 +1,103 @@
+package history
+
+import (
+	"math"
+	"time"
+)
+
+// Point is one minute or hour of the history of a server. Intervals
+// without any sample are left out.
+type Point struct {
+	Time         int64   `json:"time"` // start of the interval
+	Up           int     `json:"up"`   // minutes the server was listed
+	Reports      int     `json:"reports"`
+	Probes       int     `json:"probes"`
+	FailedProbes int     `json:"failedProbes"`
+	Players      float64 `json:"players"` // average while listed
+	PeakPlayers  int     `json:"peakPlayers"`
+}
+
+// Uptime is the share of minutes a server was listed, from its first
+// sample or the start of the period on
+type Uptime struct {
+	Day   float64 `json:"day"`
+	Month float64 `json:"month"`
+}
+
+// Report is the history of one server
+type Report struct {
+	Since  int64   `json:"since"` // first sample
+	Uptime Uptime  `json:"uptime"`
+	Points []Point `json:"points"`
+}
+
+// Get returns the history of addr at resolution, time.Minute for the last
+// day or time.Hour for the last month. Returns false if addr has none.
+func (r *Recorder) Get(addr string, now time.Time, resolution time.Duration) (Report, bool) {
+	if r == nil {
+		return Report{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.series[addr]
+	if !ok {
+		return Report{}, false
+	}
+
+	report := Report{
+		Since: s.since,
+		Uptime: Uptime{
+			Day:   uptime(s.minutes, time.Minute, s.since, now, MinuteRetention),
+			Month: uptime(s.hours, time.Hour, s.since, now, HourRetention),
+		},
+		Points: []Point{},
+	}
+	buckets, retention := s.hours, HourRetention
+	if resolution == time.Minute {
+		buckets, retention = s.minutes, MinuteRetention
+	}
+	cutoff := now.Add(-retention).Truncate(resolution).Unix()
+	for _, b := range buckets {
+		if b.start < cutoff {
+			continue
+		}
+		p := Point{
+			Time:         b.start,
+			Up:           int(b.up),
+			Reports:      int(b.reports),
+			Probes:       int(b.probes),
+			FailedProbes: int(b.failed),
+			PeakPlayers:  int(b.peak),
+		}
+		if b.samples > 0 {
+			p.Players = round(float64(b.playerSum) / float64(b.samples))
+		}
+		report.Points = append(report.Points, p)
+	}
+	return report, true
+}
+
+// uptime returns the share of the completed minutes of the period before
+// now, starting no earlier than since, that buckets of resolution count as
+// up
+func uptime(buckets []bucket, resolution time.Duration, since int64, now time.Time, period time.Duration) float64 {
+	end := now.Truncate(time.Minute).Unix()
+	from := max(since, now.Add(-period).Unix())
+	minutes := (end - from + from%60) / 60
+	if minutes <= 0 {
+		return 0
+	}
+	cutoff := now.Add(-period).Truncate(resolution).Unix()
+	up := 0
+	for _, b := range buckets {
+		if b.start >= cutoff {
+			up += int(b.up)
+		}
+	}
+	return round(min(float64(up)/float64(minutes), 1))
+}
+
+// round keeps four decimals, enough for a percentage with two
+func round(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
@@ -0,0 +1,59 @@
+// Package logging sets up the structured logger and its runtime adjustable
+// level.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Logging defaults
+const (
+	DefaultLevel  = "info"
+	DefaultFormat = "text"
+)
+
+// Level is the level of loggers created by New. It is a LevelVar so config
+// reloads can change it.
+var Level = new(slog.LevelVar)
+
+// ParseLevel converts a logLevel config value
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// New returns a logger writing in format, "json" or "text", at Level
+func New(w io.Writer, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: Level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// AddrAttrs splits an ip:port entry key into ip and port fields
+func AddrAttrs(addr string) []any {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []any{"ip", addr}
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return []any{"ip", addr}
+	}
+	return []any{"ip", host, "port", port}
+}
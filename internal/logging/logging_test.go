@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected slog.Level
+	}{
+		{"", slog.LevelInfo},
+		{"debug", slog.LevelDebug},
+		{"INFO", slog.LevelInfo},
+		{"warn", slog.LevelWarn},
+		{"error", slog.LevelError},
+	}
+	for _, tt := range tests {
+		level, err := ParseLevel(tt.input)
+		if err != nil || level != tt.expected {
+			t.Errorf("ParseLevel(%q) = %v, %v, expected %v", tt.input, level, err, tt.expected)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected unknown level to fail")
+	}
+}
+
+func TestAddrAttrs(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected []any
+	}{
+		{"10.0.0.1:2301", []any{"ip", "10.0.0.1", "port", 2301}},
+		{"[2001:db8::1]:2301", []any{"ip", "2001:db8::1", "port", 2301}},
+		{"bogus", []any{"ip", "bogus"}},
+	}
+	for _, tt := range tests {
+		if got := AddrAttrs(tt.addr); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("AddrAttrs(%s) = %v, expected %v", tt.addr, got, tt.expected)
+		}
+	}
+}
+
+func TestLevelFilters(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json")
+	defer Level.Set(Level.Level())
+
+	Level.Set(slog.LevelWarn)
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("Expected only warnings to be logged, got %s", buf.String())
+	}
+}
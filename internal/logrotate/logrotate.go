@@ -0,0 +1,322 @@
+// Package logrotate implements a log file writer that rotates the file by
+// size or at midnight while the process runs, keeps a bounded number of
+// older generations and optionally gzips them.
+package logrotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files after the time they were rotated
+const backupTimeFormat = "20060102-150405"
+
+// backupPattern matches the suffix of a rotated file: the rotation time, a
+// counter for rotations within the same second, and .gz once compressed
+var backupPattern = regexp.MustCompile(`^(\d{8}-\d{6})(?:-(\d+))?(\.gz)?$`)
+
+// Clock abstracts time so tests can control it
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Options configures a Writer
+type Options struct {
+	MaxSize    int64       // rotate before the file grows past this many bytes, 0 disables
+	Daily      bool        // rotate when the local date changes
+	MaxBackups int         // rotated files to keep, 0 keeps all
+	Compress   bool        // gzip rotated files
+	FileMode   os.FileMode // permissions of new files, 0600 if unset
+	Clock      Clock       // time source, the wall clock if nil
+}
+
+// Writer is an io.Writer writing to a log file that rotates itself. It is
+// safe for concurrent use.
+type Writer struct {
+	path string
+	opts Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	day  string // local date the current file was started, YYYY-MM-DD
+
+	millMu  sync.Mutex     // serializes compression and cleanup
+	milling sync.WaitGroup // background compression and cleanup
+}
+
+// New opens path for appending, creating it if needed
+func New(path string, opts Options) (*Writer, error) {
+	if filepath.Clean(path) != path {
+		return nil, errors.New("invalid file path")
+	}
+	if opts.FileMode == 0 {
+		opts.FileMode = 0600
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	w := &Writer{path: path, opts: opts}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open opens the log file. An existing file keeps the date it was last
+// written on, so a file from yesterday is rotated on the first write.
+// Callers must hold the lock.
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.opts.FileMode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.day = w.opts.Clock.Now().Format(time.DateOnly)
+	if w.size > 0 {
+		w.day = info.ModTime().In(time.Local).Format(time.DateOnly)
+	}
+	return nil
+}
+
+// Write appends p to the log file, rotating it first if p would push it
+// past MaxSize or the date changed
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			// Keep logging to the current file rather than losing lines
+			fmt.Fprintf(os.Stderr, "logrotate: %v\n", err)
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// shouldRotate reports whether writing n more bytes needs a new file.
+// Callers must hold the lock.
+func (w *Writer) shouldRotate(n int) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.opts.MaxSize > 0 && w.size+int64(n) > w.opts.MaxSize {
+		return true
+	}
+	return w.opts.Daily && w.opts.Clock.Now().Format(time.DateOnly) != w.day
+}
+
+// Rotate starts a new file now
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// rotate renames the current file to a backup and opens a new one. Callers
+// must hold the lock.
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	if _, err := os.Stat(w.path); err == nil {
+		if err := os.Rename(w.path, w.backupName()); err != nil {
+			if openErr := w.open(); openErr != nil {
+				return openErr
+			}
+			return fmt.Errorf("rotate: %w", err)
+		}
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.milling.Add(1)
+	go func() {
+		defer w.milling.Done()
+		w.mill()
+	}()
+	return nil
+}
+
+// backupName returns an unused name for the current file
+func (w *Writer) backupName() string {
+	stamp := w.opts.Clock.Now().Format(backupTimeFormat)
+	name := w.path + "." + stamp
+	for i := 1; ; i++ {
+		if !exists(name) && !exists(name+".gz") {
+			return name
+		}
+		name = fmt.Sprintf("%s.%s-%d", w.path, stamp, i)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Reopen closes and reopens the log file, for use after an external tool
+// such as logrotate moved it away
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	return w.open()
+}
+
+// Close closes the log file and waits for background compression
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+	w.milling.Wait()
+	return err
+}
+
+// backup is a rotated file
+type backup struct {
+	path    string
+	stamp   string
+	counter int
+	gzipped bool
+}
+
+// backups lists the rotated files, oldest first
+func (w *Writer) backups() ([]backup, error) {
+	dir := filepath.Dir(w.path)
+	prefix := filepath.Base(w.path) + "."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || len(name) <= len(prefix) || name[:len(prefix)] != prefix {
+			continue
+		}
+		m := backupPattern.FindStringSubmatch(name[len(prefix):])
+		if m == nil {
+			continue
+		}
+		counter, _ := strconv.Atoi(m[2])
+		list = append(list, backup{path: filepath.Join(dir, name), stamp: m[1], counter: counter, gzipped: m[3] != ""})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].stamp != list[j].stamp {
+			return list[i].stamp < list[j].stamp
+		}
+		return list[i].counter < list[j].counter
+	})
+	return list, nil
+}
+
+// Backups returns the paths of the rotated files, oldest first
+func (w *Writer) Backups() []string {
+	list, _ := w.backups()
+	paths := make([]string, len(list))
+	for i, b := range list {
+		paths[i] = b.path
+	}
+	return paths
+}
+
+// mill compresses rotated files and removes the oldest beyond MaxBackups
+func (w *Writer) mill() {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	list, err := w.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logrotate: %v\n", err)
+		return
+	}
+
+	if w.opts.MaxBackups > 0 && len(list) > w.opts.MaxBackups {
+		for _, b := range list[:len(list)-w.opts.MaxBackups] {
+			os.Remove(b.path)
+		}
+		list = list[len(list)-w.opts.MaxBackups:]
+	}
+
+	if !w.opts.Compress {
+		return
+	}
+	for _, b := range list {
+		if b.gzipped {
+			continue
+		}
+		if err := compressFile(b.path, w.opts.FileMode); err != nil {
+			fmt.Fprintf(os.Stderr, "logrotate: %v\n", err)
+		}
+	}
+}
+
+// compressFile gzips path to path.gz and removes path
+func compressFile(path string, mode os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("compress %s: %w", filepath.Base(path), err)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,195 @@
+package logrotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestWriter(t *testing.T, opts Options) (*Writer, string, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2026, 10, 15, 12, 0, 0, 0, time.Local)}
+	opts.Clock = clock
+	path := filepath.Join(t.TempDir(), "lusd.log")
+	w, err := New(path, opts)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w, path, clock
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return string(data)
+}
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader failed: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	return string(data)
+}
+
+func TestRotateBySize(t *testing.T) {
+	w, path, clock := newTestWriter(t, Options{MaxSize: 8})
+
+	w.Write([]byte("12345\n"))
+	w.Write([]byte("6789\n")) // 11 bytes would not fit
+	clock.Advance(time.Second)
+	w.Write([]byte("abcd\n"))
+	w.Close()
+
+	backups := w.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %v", backups)
+	}
+	if got := readFile(t, backups[0]); got != "12345\n" {
+		t.Errorf("Unexpected first backup %q", got)
+	}
+	if got := readFile(t, backups[1]); got != "6789\n" {
+		t.Errorf("Unexpected second backup %q", got)
+	}
+	if got := readFile(t, path); got != "abcd\n" {
+		t.Errorf("Unexpected current file %q", got)
+	}
+	if !strings.HasSuffix(backups[0], ".20261015-120000") {
+		t.Errorf("Expected backups named after the rotation time, got %s", backups[0])
+	}
+}
+
+func TestRotateDaily(t *testing.T) {
+	w, path, clock := newTestWriter(t, Options{Daily: true})
+
+	w.Write([]byte("today\n"))
+	clock.Advance(6 * time.Hour)
+	w.Write([]byte("still today\n"))
+	if len(w.Backups()) != 0 {
+		t.Fatal("Expected no rotation on the same day")
+	}
+
+	clock.Advance(12 * time.Hour)
+	w.Write([]byte("tomorrow\n"))
+	w.Close()
+
+	backups := w.Backups()
+	if len(backups) != 1 || readFile(t, backups[0]) != "today\nstill today\n" {
+		t.Errorf("Expected yesterday's lines in one backup, got %v", backups)
+	}
+	if got := readFile(t, path); got != "tomorrow\n" {
+		t.Errorf("Unexpected current file %q", got)
+	}
+}
+
+func TestRetentionAndCompression(t *testing.T) {
+	w, _, clock := newTestWriter(t, Options{MaxBackups: 2, Compress: true})
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		w.Write([]byte(line))
+		if err := w.Rotate(); err != nil {
+			t.Fatalf("Rotate failed: %v", err)
+		}
+		clock.Advance(time.Second)
+	}
+	w.Close()
+
+	backups := w.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups to be kept, got %v", backups)
+	}
+	for i, expected := range []string{"three\n", "four\n"} {
+		if !strings.HasSuffix(backups[i], ".gz") {
+			t.Errorf("Expected %s to be compressed", backups[i])
+			continue
+		}
+		if got := readGzip(t, backups[i]); got != expected {
+			t.Errorf("Expected %q in %s, got %q", expected, backups[i], got)
+		}
+	}
+}
+
+func TestSameSecondRotations(t *testing.T) {
+	w, _, _ := newTestWriter(t, Options{})
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		w.Write([]byte(line))
+		w.Rotate()
+	}
+	w.Close()
+
+	backups := w.Backups()
+	if len(backups) != 3 {
+		t.Fatalf("Expected 3 backups, got %v", backups)
+	}
+	for i, expected := range []string{"a\n", "b\n", "c\n"} {
+		if got := readFile(t, backups[i]); got != expected {
+			t.Errorf("Expected backup %d to hold %q, got %q", i, expected, got)
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	w, path, _ := newTestWriter(t, Options{})
+
+	w.Write([]byte("before\n"))
+	// An external tool moves the file away, then signals us
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("still old\n"))
+	if err := w.Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	w.Write([]byte("after\n"))
+	w.Close()
+
+	if got := readFile(t, path+".1"); got != "before\nstill old\n" {
+		t.Errorf("Unexpected moved file %q", got)
+	}
+	if got := readFile(t, path); got != "after\n" {
+		t.Errorf("Unexpected reopened file %q", got)
+	}
+}
+
+func TestNewRejectsUncleanPath(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "..", "x", "..", "lusd.log")+"/", Options{}); err == nil {
+		t.Error("Expected unclean path to be rejected")
+	}
+}
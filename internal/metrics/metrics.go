@@ -0,0 +1,205 @@
+// Package metrics collects counters and exports them in the Prometheus text
+// format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lusd/internal/store"
+)
+
+// Report rejection reasons
+const (
+	RejectBadUserAgent = "bad_user_agent"
+	RejectBadPort      = "bad_port"
+	RejectBadRequest   = "bad_request"
+	RejectBlacklisted  = "blacklisted"
+	RejectRateLimited  = "rate_limited"
+	RejectBadSignature = "bad_signature"
+)
+
+// latencyBuckets are the upper bounds of the request latency histogram
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a cumulative Prometheus-style histogram
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range latencyBuckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Metrics collects the counters exported at /metrics. Gauges are read from
+// their sources at scrape time.
+type Metrics struct {
+	sync.Mutex
+	reportsAccepted uint64
+	reportsRejected map[string]uint64 // reason -> count
+	configReloads   map[string]uint64 // result -> count
+	latency         map[string]*histogram
+}
+
+// New returns metrics with all known series at zero
+func New() *Metrics {
+	m := &Metrics{
+		reportsRejected: make(map[string]uint64),
+		configReloads:   make(map[string]uint64),
+		latency:         make(map[string]*histogram),
+	}
+	// Export known series from the start so rate() works on first increment
+	for _, reason := range []string{RejectBadUserAgent, RejectBadPort, RejectBadRequest, RejectBlacklisted, RejectRateLimited, RejectBadSignature} {
+		m.reportsRejected[reason] = 0
+	}
+	m.configReloads["success"] = 0
+	m.configReloads["failure"] = 0
+	return m
+}
+
+// ReportAccepted counts an accepted /report.php heartbeat
+func (m *Metrics) ReportAccepted() {
+	m.Lock()
+	m.reportsAccepted++
+	m.Unlock()
+}
+
+// ReportRejected counts a rejected /report.php request
+func (m *Metrics) ReportRejected(reason string) {
+	m.Lock()
+	m.reportsRejected[reason]++
+	m.Unlock()
+}
+
+// ConfigReload counts a config reload attempt
+func (m *Metrics) ConfigReload(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.Lock()
+	m.configReloads[result]++
+	m.Unlock()
+}
+
+// ObserveLatency records how long a request to endpoint took
+func (m *Metrics) ObserveLatency(endpoint string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	h, ok := m.latency[endpoint]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[endpoint] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// escapeLabel escapes a Prometheus label value
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeLabelled writes one sample per label value, sorted by label
+func writeLabelled(w io.Writer, name, label string, values map[string]uint64) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, escapeLabel(k), values[k])
+	}
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format. The
+// page is rendered first so a slow client does not hold the lock.
+func (m *Metrics) WriteTo(w io.Writer, servers *store.ServerList, rateLimitKeys func() int) {
+	var buf bytes.Buffer
+	m.render(&buf, servers, rateLimitKeys)
+	w.Write(buf.Bytes())
+}
+
+// render formats all metrics into buf
+func (m *Metrics) render(w *bytes.Buffer, servers *store.ServerList, rateLimitKeys func() int) {
+	m.Lock()
+	writeHeader(w, "lusd_reports_accepted_total", "counter", "Heartbeats accepted by /report.php.")
+	fmt.Fprintf(w, "lusd_reports_accepted_total %d\n", m.reportsAccepted)
+
+	writeHeader(w, "lusd_reports_rejected_total", "counter", "Requests to /report.php that were rejected, by reason.")
+	writeLabelled(w, "lusd_reports_rejected_total", "reason", m.reportsRejected)
+
+	writeHeader(w, "lusd_config_reloads_total", "counter", "Config reload attempts, by result.")
+	writeLabelled(w, "lusd_config_reloads_total", "result", m.configReloads)
+
+	writeHeader(w, "lusd_http_request_duration_seconds", "histogram", "HTTP request latency, by endpoint.")
+	endpoints := make([]string, 0, len(m.latency))
+	for endpoint := range m.latency {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		h := m.latency[endpoint]
+		label := escapeLabel(endpoint)
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "lusd_http_request_duration_seconds_bucket{endpoint=\"%s\",le=\"%g\"} %d\n", label, bound, cumulative)
+		}
+		fmt.Fprintf(w, "lusd_http_request_duration_seconds_bucket{endpoint=\"%s\",le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(w, "lusd_http_request_duration_seconds_sum{endpoint=\"%s\"} %g\n", label, h.sum)
+		fmt.Fprintf(w, "lusd_http_request_duration_seconds_count{endpoint=\"%s\"} %d\n", label, h.count)
+	}
+	m.Unlock()
+
+	stats := servers.Stats()
+	writeHeader(w, "lusd_servers_active", "gauge", "Servers currently listed in /servers.txt.")
+	fmt.Fprintf(w, "lusd_servers_active %d\n", stats.Active)
+	writeHeader(w, "lusd_servers_official", "gauge", "Configured official servers.")
+	fmt.Fprintf(w, "lusd_servers_official %d\n", stats.Official)
+	writeHeader(w, "lusd_servers_entries", "gauge", "Reported entries held in memory, including unlisted ones.")
+	fmt.Fprintf(w, "lusd_servers_entries %d\n", stats.Entries)
+	writeHeader(w, "lusd_servers_federated", "gauge", "Servers mirrored from peer directories.")
+	fmt.Fprintf(w, "lusd_servers_federated %d\n", stats.Federated)
+	writeHeader(w, "lusd_servers_pending", "gauge", "Reported entries waiting for an ownership challenge answer.")
+	fmt.Fprintf(w, "lusd_servers_pending %d\n", stats.Pending)
+	writeHeader(w, "lusd_servers_stale_evicted_total", "counter", "Entries removed by the stale cleanup.")
+	fmt.Fprintf(w, "lusd_servers_stale_evicted_total %d\n", stats.StaleEvicted)
+
+	if rateLimitKeys != nil {
+		writeHeader(w, "lusd_ratelimit_tracked_keys", "gauge", "Clients tracked by the rate limiter.")
+		fmt.Fprintf(w, "lusd_ratelimit_tracked_keys %d\n", rateLimitKeys())
+	}
+}
+
+// Handler serves the metrics page
+func (m *Metrics) Handler(servers *store.ServerList, rateLimitKeys func() int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		m.WriteTo(w, servers, rateLimitKeys)
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/store"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	servers := store.New(config.Config{
+		StaleTimeout:    time.Minute,
+		Blacklist:       banset.New(),
+		OfficialServers: []string{"10.0.0.1:2301"},
+	})
+	servers.Report("10.0.0.2", 2301)
+
+	metrics := New()
+	metrics.ReportAccepted()
+	metrics.ReportRejected(RejectBlacklisted)
+	metrics.ReportRejected(RejectBlacklisted)
+	metrics.ConfigReload(errors.New("bad config"))
+	metrics.ObserveLatency("/servers.txt", 3*time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	metrics.Handler(servers, func() int { return 7 })(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type %s", w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		"lusd_reports_accepted_total 1\n",
+		`lusd_reports_rejected_total{reason="blacklisted"} 2`,
+		`lusd_reports_rejected_total{reason="rate_limited"} 0`,
+		`lusd_config_reloads_total{result="failure"} 1`,
+		`lusd_config_reloads_total{result="success"} 0`,
+		`lusd_http_request_duration_seconds_bucket{endpoint="/servers.txt",le="0.0025"} 0`,
+		`lusd_http_request_duration_seconds_bucket{endpoint="/servers.txt",le="0.005"} 1`,
+		`lusd_http_request_duration_seconds_bucket{endpoint="/servers.txt",le="+Inf"} 1`,
+		`lusd_http_request_duration_seconds_count{endpoint="/servers.txt"} 1`,
+		"lusd_servers_active 2\n",
+		"lusd_servers_official 1\n",
+		"lusd_servers_entries 1\n",
+		"lusd_ratelimit_tracked_keys 7\n",
+		"# TYPE lusd_http_request_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+)
+
+// clientIPKey is the request context key of the resolved client address
+type clientIPKey struct{}
+
+// withClientIP stores the resolved client address in the request context
+func withClientIP(r *http.Request, ip netip.Addr) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip))
+}
+
+// ClientIP returns the client address resolved by the security middleware
+func ClientIP(r *http.Request) (netip.Addr, bool) {
+	ip, ok := r.Context().Value(clientIPKey{}).(netip.Addr)
+	return ip, ok
+}
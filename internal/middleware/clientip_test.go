@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIPContext(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, ok := ClientIP(r); ok {
+		t.Error("Expected no client IP before the middleware ran")
+	}
+
+	r = withClientIP(r, netip.MustParseAddr("198.51.100.7"))
+	ip, ok := ClientIP(r)
+	if !ok || ip.String() != "198.51.100.7" {
+		t.Errorf("Expected 198.51.100.7, got %v", ip)
+	}
+}
@@ -0,0 +1,122 @@
+// Package middleware wraps the HTTP handlers with security headers, client
+// address resolution, TLS enforcement, rate limiting and request logging.
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/metrics"
+	"lusd/internal/ratelimit"
+	"lusd/internal/realip"
+	"lusd/internal/webhook"
+)
+
+// Security returns the middleware every endpoint is served through. The
+// config is read through getConfig on each request so reloads apply.
+// Rate limited clients are reported to hooks, which may be nil.
+func Security(getConfig func() config.Config, limiter *ratelimit.Limiter, m *metrics.Metrics, hooks *webhook.Dispatcher) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// Record request latency per endpoint and log the request once done
+			start := time.Now()
+			currentCfg := getConfig()
+			peer, _ := realip.ParseAddr(r.RemoteAddr)
+			trustedPeer := realip.Trusted(peer, currentCfg.TrustedProxies)
+			rl := &requestLog{id: requestIDFor(r, trustedPeer)}
+			r = withRequestLog(r, rl)
+			w.Header().Set(RequestIDHeader, rl.id)
+			rec := &statusRecorder{ResponseWriter: w}
+			w = rec
+			var clientAddr netip.Addr
+			defer func() {
+				latency := time.Since(start)
+				m.ObserveLatency(endpoint(r), latency)
+				logRequest(r, rl, clientAddr, rec.status, latency)
+			}()
+
+			// Add security headers
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("X-Frame-Options", "DENY")
+			w.Header().Set("X-XSS-Protection", "1; mode=block")
+			w.Header().Set("Referrer-Policy", "no-referrer")
+			// Nothing but the web pages loads anything, they relax this
+			w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+
+			// Get client IP, honouring forwarding headers from trusted proxies
+			var err error
+			clientAddr, err = realip.FromRequest(r, currentCfg.TrustedProxies)
+			if err != nil {
+				http.Error(w, "Invalid request", http.StatusBadRequest)
+				return
+			}
+			r = withClientIP(r, clientAddr)
+
+			// Keep credentials and API data off plain HTTP where configured
+			if requiresTLS(r.URL.Path, currentCfg.TLSOnlyPaths) {
+				if !isTLS(r, trustedPeer) {
+					http.Error(w, "HTTPS Required", http.StatusForbidden)
+					return
+				}
+			}
+
+			// Check rate limit
+			key, limit := currentCfg.RateLimit.Lookup(r.URL.Path, clientAddr)
+			if ok, wait := limiter.Allow(key, limit); !ok {
+				if r.URL.Path == "/report.php" {
+					m.ReportRejected(metrics.RejectRateLimited)
+				}
+				SetOutcome(r, metrics.RejectRateLimited)
+				hooks.Abuse(clientAddr, metrics.RejectRateLimited)
+				setRetryAfter(w, wait)
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// setRetryAfter tells a rate limited client when to try again, in whole
+// seconds rounded up
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// endpoint names the route r was matched to, so paths with wildcards such
+// as a server address share one latency histogram
+func endpoint(r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	return r.URL.Path
+}
+
+// requiresTLS reports whether path is restricted to TLS
+func requiresTLS(path string, onlyPaths []string) bool {
+	for _, prefix := range onlyPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTLS reports whether the client reached us over TLS, directly or through
+// a trusted proxy that terminated it
+func isTLS(r *http.Request, trustedProxy bool) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return trustedProxy && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
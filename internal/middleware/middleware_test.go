@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/metrics"
+	"lusd/internal/ratelimit"
+)
+
+func TestSecurity(t *testing.T) {
+	policy := ratelimit.Policy{Default: ratelimit.PerMinute(1, 1)}
+	cfg := config.Config{RateLimit: policy, TLSOnlyPaths: []string{"/admin/"}}
+	limiter := ratelimit.New(ratelimit.Options{MaxKeys: 10, IdleTimeout: time.Minute})
+	m := metrics.New()
+	handler := Security(func() config.Config { return cfg }, limiter, m, nil)(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := ClientIP(r); !ok || ip.String() != "192.0.2.1" {
+			t.Errorf("Expected the client IP in the context, got %v", ip)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/servers.txt", nil))
+	if w.Code != http.StatusOK || w.Header().Get(RequestIDHeader) == "" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Expected 200 with security headers, got %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/servers.txt", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/admin/bans", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a TLS only path over HTTP, got %d", w.Code)
+	}
+}
+
+func TestSetRetryAfter(t *testing.T) {
+	tests := []struct {
+		wait     time.Duration
+		expected string
+	}{
+		{0, "1"},
+		{300 * time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		setRetryAfter(w, tt.wait)
+		if got := w.Header().Get("Retry-After"); got != tt.expected {
+			t.Errorf("Retry-After for %v = %s, expected %s", tt.wait, got, tt.expected)
+		}
+	}
+}
+
+func TestRequiresTLS(t *testing.T) {
+	only := []string{"/admin/", "/servers.json"}
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/admin/bans", true},
+		{"/servers.json", true},
+		{"/servers.txt", false},
+		{"/report", false},
+		{"/administrator", false},
+	}
+	for _, tt := range tests {
+		if got := requiresTLS(tt.path, only); got != tt.expected {
+			t.Errorf("requiresTLS(%s) = %v, expected %v", tt.path, got, tt.expected)
+		}
+	}
+	if requiresTLS("/admin/bans", nil) {
+		t.Error("Expected no restriction without onlyPaths")
+	}
+}
+
+func TestIsTLS(t *testing.T) {
+	r := httptest.NewRequest("GET", "/admin/bans", nil)
+	if isTLS(r, false) {
+		t.Error("Expected plain request not to count as TLS")
+	}
+
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if isTLS(r, false) {
+		t.Error("Expected X-Forwarded-Proto from an untrusted peer to be ignored")
+	}
+	if !isTLS(r, true) {
+		t.Error("Expected X-Forwarded-Proto from a trusted proxy to count")
+	}
+
+	r = httptest.NewRequest("GET", "https://lusd.example.org/admin/bans", nil)
+	if !isTLS(r, false) {
+		t.Error("Expected direct TLS request to count")
+	}
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"time"
+)
+
+// RequestIDHeader carries the request ID in requests from trusted proxies
+// and in every response
+const RequestIDHeader = "X-Request-ID"
+
+// Request outcomes that are not report rejection reasons
+const (
+	OutcomeOK       = "ok"
+	OutcomeError    = "error"
+	OutcomeAccepted = "accepted"
+)
+
+// requestIDPattern limits request IDs taken from trusted proxies to
+// something safe to log and echo
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestLog collects what handlers know about a request, logged once it
+// completes
+type requestLog struct {
+	id      string
+	port    int
+	outcome string
+	err     error
+}
+
+type requestLogKey struct{}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDFor returns the ID of r. IDs set by a trusted proxy are kept so
+// a request can be followed through both logs.
+func requestIDFor(r *http.Request, trustedProxy bool) string {
+	if trustedProxy {
+		if id := r.Header.Get(RequestIDHeader); requestIDPattern.MatchString(id) {
+			return id
+		}
+	}
+	return newRequestID()
+}
+
+// withRequestLog attaches rl to the request context
+func withRequestLog(r *http.Request, rl *requestLog) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl))
+}
+
+// getRequestLog returns the request log of r, or nil outside the middleware
+func getRequestLog(r *http.Request) *requestLog {
+	rl, _ := r.Context().Value(requestLogKey{}).(*requestLog)
+	return rl
+}
+
+// SetPort records the game server port a request is about
+func SetPort(r *http.Request, port int) {
+	if rl := getRequestLog(r); rl != nil {
+		rl.port = port
+	}
+}
+
+// SetOutcome records how a request ended, e.g. a report rejection reason
+func SetOutcome(r *http.Request, outcome string) {
+	if rl := getRequestLog(r); rl != nil {
+		rl.outcome = outcome
+	}
+}
+
+// SetError records why a request failed, for the log only
+func SetError(r *http.Request, err error) {
+	if rl := getRequestLog(r); rl != nil {
+		rl.err = err
+	}
+}
+
+// statusRecorder captures the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logRequest writes the log line of a completed request
+func logRequest(r *http.Request, rl *requestLog, ip netip.Addr, status int, latency time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	outcome := rl.outcome
+	if outcome == "" {
+		outcome = OutcomeOK
+		if status >= http.StatusBadRequest {
+			outcome = OutcomeError
+		}
+	}
+
+	attrs := []slog.Attr{
+		slog.String("request_id", rl.id),
+		slog.String("method", r.Method),
+		slog.String("endpoint", r.URL.Path),
+	}
+	if ip.IsValid() {
+		attrs = append(attrs, slog.String("ip", ip.String()))
+	}
+	if rl.port != 0 {
+		attrs = append(attrs, slog.Int("port", rl.port))
+	}
+	attrs = append(attrs,
+		slog.Int("status", status),
+		slog.String("outcome", outcome),
+		slog.Float64("latency", latency.Seconds()),
+	)
+	if rl.err != nil {
+		attrs = append(attrs, slog.String("error", rl.err.Error()))
+	}
+	slog.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+}
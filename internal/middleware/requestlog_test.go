@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"lusd/internal/logging"
+	"lusd/internal/metrics"
+)
+
+// captureLog sends the default logger to a JSON buffer for the rest of the
+// test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(logging.New(&buf, "json"))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+func TestRequestIDFor(t *testing.T) {
+	r := httptest.NewRequest("GET", "/servers.txt", nil)
+	if id := requestIDFor(r, true); len(id) != 16 {
+		t.Errorf("Expected a generated 16 character ID, got %q", id)
+	}
+
+	r.Header.Set(RequestIDHeader, "edge-1234")
+	if id := requestIDFor(r, true); id != "edge-1234" {
+		t.Errorf("Expected the trusted proxy's ID, got %q", id)
+	}
+	if id := requestIDFor(r, false); id == "edge-1234" {
+		t.Error("Expected IDs from untrusted clients to be replaced")
+	}
+
+	r.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	if id := requestIDFor(r, true); strings.Contains(id, " ") {
+		t.Errorf("Expected malformed ID to be replaced, got %q", id)
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	buf := captureLog(t)
+
+	rl := &requestLog{id: "req-1"}
+	r := withRequestLog(httptest.NewRequest("POST", "/report.php", nil), rl)
+	SetPort(r, 2301)
+	SetOutcome(r, metrics.RejectBadSignature)
+	SetError(r, errors.New("nonce already used"))
+
+	w := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	http.Error(w, "Invalid signature", http.StatusForbidden)
+	logRequest(r, rl, netip.MustParseAddr("10.0.0.1"), w.status, 1500*time.Microsecond)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	expected := map[string]any{
+		"msg":        "request",
+		"request_id": "req-1",
+		"endpoint":   "/report.php",
+		"ip":         "10.0.0.1",
+		"port":       float64(2301),
+		"status":     float64(403),
+		"outcome":    "bad_signature",
+		"latency":    0.0015,
+		"error":      "nonce already used",
+	}
+	for k, v := range expected {
+		if line[k] != v {
+			t.Errorf("Expected %s=%v, got %v", k, v, line[k])
+		}
+	}
+
+	// Without an outcome the status decides
+	buf.Reset()
+	rl = &requestLog{id: "req-2"}
+	r = withRequestLog(httptest.NewRequest("GET", "/servers.txt", nil), rl)
+	logRequest(r, rl, netip.Addr{}, 0, time.Millisecond)
+	if !strings.Contains(buf.String(), `"outcome":"ok"`) || strings.Contains(buf.String(), `"port"`) {
+		t.Errorf("Unexpected log line %s", buf.String())
+	}
+
+	// Helpers are no-ops outside the middleware
+	SetOutcome(httptest.NewRequest("GET", "/", nil), "ignored")
+}
@@ -0,0 +1,205 @@
+// Package proxyproto wraps a net.Listener to accept the HAProxy PROXY
+// protocol, versions 1 and 2, from trusted peers.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol limits
+const (
+	v1MaxLen       = 107 // longest v1 header including CRLF
+	v2HeaderLen    = 16  // signature, version/command, family, length
+	v2MaxAddrLen   = 536 // addresses plus TLVs we are willing to skip
+	DefaultTimeout = 5 * time.Second
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// ErrNoHeader is returned when a trusted peer sent no PROXY header
+	ErrNoHeader = errors.New("proxyproto: missing PROXY header")
+)
+
+// Listener reads a PROXY header from every connection whose peer passes
+// Trusted. Connections from other peers are passed through untouched, so
+// their headers are never interpreted.
+type Listener struct {
+	net.Listener
+	Trusted func(netip.Addr) bool
+	Timeout time.Duration // deadline for reading the header, DefaultTimeout if zero
+}
+
+// Accept waits for the next connection. The header itself is read lazily on
+// first use, so a slow peer does not stall the accept loop.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	peer, err := netip.ParseAddrPort(c.RemoteAddr().String())
+	if err != nil || l.Trusted == nil || !l.Trusted(peer.Addr().Unmap()) {
+		return c, nil
+	}
+
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Conn{Conn: c, reader: bufio.NewReader(c), timeout: timeout}, nil
+}
+
+// Conn is a connection from a trusted proxy. RemoteAddr reports the client
+// address from the PROXY header.
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+// init reads the PROXY header once
+func (c *Conn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.remote, c.err = readHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err == nil && c.remote == nil {
+			// LOCAL or UNKNOWN, the proxy speaks for itself
+			c.remote = c.Conn.RemoteAddr()
+		}
+	})
+}
+
+// Read reads data after the PROXY header
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address announced by the proxy
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.err != nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remote
+}
+
+// readHeader parses a v1 or v2 header. A nil address means the header did
+// not carry one.
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	peek, err := r.Peek(len(v1Prefix))
+	if err != nil {
+		return nil, ErrNoHeader
+	}
+	if bytes.Equal(peek, v1Prefix) {
+		return readV1(r)
+	}
+	peek, err = r.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(peek, v2Signature) {
+		return readV2(r)
+	}
+	return nil, ErrNoHeader
+}
+
+// readV1 parses "PROXY TCP4 src dst sport dport\r\n"
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("proxyproto: reading v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxyproto: v1 header too long")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("proxyproto: malformed v1 header")
+	}
+	src, err := netip.ParseAddr(fields[2])
+	if err != nil || src.Is4() != (fields[1] == "TCP4") {
+		return nil, errors.New("proxyproto: invalid v1 source address")
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, errors.New("proxyproto: invalid v1 source port")
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, uint16(port))), nil
+}
+
+// readV2 parses the binary header
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, v2HeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("proxyproto: reading v2 header: %w", err)
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("proxyproto: unsupported v2 version")
+	}
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if length > v2MaxAddrLen {
+		return nil, errors.New("proxyproto: v2 header too long")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("proxyproto: reading v2 addresses: %w", err)
+	}
+
+	switch header[12] & 0x0f {
+	case 0x0: // LOCAL, e.g. health checks from the proxy
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, errors.New("proxyproto: unsupported v2 command")
+	}
+
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if length < 12 {
+			return nil, errors.New("proxyproto: short v2 IPv4 addresses")
+		}
+		src := netip.AddrFrom4([4]byte(payload[0:4]))
+		port := binary.BigEndian.Uint16(payload[8:10])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, port)), nil
+	case 0x21: // TCP over IPv6
+		if length < 36 {
+			return nil, errors.New("proxyproto: short v2 IPv6 addresses")
+		}
+		src := netip.AddrFrom16([16]byte(payload[0:16]))
+		port := binary.BigEndian.Uint16(payload[32:34])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, port)), nil
+	default:
+		// Unix sockets and unspecified families carry no usable address
+		return nil, nil
+	}
+}
@@ -0,0 +1,141 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// acceptOne sends data to a wrapped listener and returns the accepted
+// connection's remote address and the payload that followed the header
+func acceptOne(t *testing.T, trusted bool, data []byte) (string, string, error) {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer inner.Close()
+	l := &Listener{
+		Listener: inner,
+		Trusted:  func(netip.Addr) bool { return trusted },
+		Timeout:  time.Second,
+	}
+
+	go func() {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write(data)
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer c.Close()
+
+	body, err := io.ReadAll(c)
+	return c.RemoteAddr().String(), string(body), err
+}
+
+// v2Header builds a binary header for a TCP source address
+func v2Header(command byte, src netip.AddrPort) []byte {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command)
+	var addrs []byte
+	if src.Addr().Is4() {
+		header = append(header, 0x11)
+		ip := src.Addr().As4()
+		addrs = append(addrs, ip[:]...)
+		addrs = append(addrs, 127, 0, 0, 1)
+	} else {
+		header = append(header, 0x21)
+		ip := src.Addr().As16()
+		addrs = append(addrs, ip[:]...)
+		addrs = append(addrs, make([]byte, 16)...)
+	}
+	addrs = binary.BigEndian.AppendUint16(addrs, src.Port())
+	addrs = binary.BigEndian.AppendUint16(addrs, 80)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func TestListenerV1(t *testing.T) {
+	remote, body, err := acceptOne(t, true, []byte("PROXY TCP4 198.51.100.7 10.0.0.1 5555 80\r\nGET / HTTP/1.0\r\n"))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if remote != "198.51.100.7:5555" {
+		t.Errorf("Expected remote 198.51.100.7:5555, got %s", remote)
+	}
+	if body != "GET / HTTP/1.0\r\n" {
+		t.Errorf("Expected the header to be stripped, got %q", body)
+	}
+}
+
+func TestListenerV1Unknown(t *testing.T) {
+	remote, _, err := acceptOne(t, true, []byte("PROXY UNKNOWN\r\nhello"))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if addr, _ := netip.ParseAddrPort(remote); addr.Addr().String() != "127.0.0.1" {
+		t.Errorf("Expected the proxy address for UNKNOWN, got %s", remote)
+	}
+}
+
+func TestListenerV2(t *testing.T) {
+	tests := []string{"198.51.100.7:5555", "[2001:db8::5]:6666"}
+	for _, src := range tests {
+		data := append(v2Header(0x1, netip.MustParseAddrPort(src)), "hello"...)
+		remote, body, err := acceptOne(t, true, data)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if remote != src {
+			t.Errorf("Expected remote %s, got %s", src, remote)
+		}
+		if body != "hello" {
+			t.Errorf("Expected the header to be stripped, got %q", body)
+		}
+	}
+}
+
+func TestListenerV2Local(t *testing.T) {
+	data := append(v2Header(0x0, netip.MustParseAddrPort("198.51.100.7:5555")), "hello"...)
+	remote, body, err := acceptOne(t, true, data)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if addr, _ := netip.ParseAddrPort(remote); addr.Addr().String() != "127.0.0.1" {
+		t.Errorf("Expected the proxy address for LOCAL, got %s", remote)
+	}
+	if body != "hello" {
+		t.Errorf("Expected the header to be stripped, got %q", body)
+	}
+}
+
+func TestListenerTrustedWithoutHeader(t *testing.T) {
+	_, _, err := acceptOne(t, true, []byte("GET / HTTP/1.0\r\n"))
+	if err != ErrNoHeader {
+		t.Errorf("Expected ErrNoHeader, got %v", err)
+	}
+}
+
+func TestListenerUntrustedPassthrough(t *testing.T) {
+	data := "PROXY TCP4 198.51.100.7 10.0.0.1 5555 80\r\n"
+	remote, body, err := acceptOne(t, false, []byte(data))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if addr, _ := netip.ParseAddrPort(remote); addr.Addr().String() != "127.0.0.1" {
+		t.Errorf("Expected untrusted header to be ignored, got %s", remote)
+	}
+	if body != data {
+		t.Errorf("Expected untrusted data to pass through, got %q", body)
+	}
+}
@@ -0,0 +1,210 @@
+// Package ratelimit implements a bounded token-bucket rate limiter keyed by
+// client, with per-endpoint and per-CIDR limits.
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so tests can control it
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Limit describes a token bucket. A zero Limit means unlimited.
+type Limit struct {
+	Rate  float64 // tokens added per second
+	Burst int     // bucket capacity
+}
+
+// PerMinute returns a limit of n requests per minute with the given burst
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Unlimited reports whether the limit never rejects requests
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// CIDRLimit applies a limit to every client inside a prefix
+type CIDRLimit struct {
+	Prefix netip.Prefix
+	Limit  Limit
+}
+
+// Policy selects the limit for a request. CIDR limits take precedence over
+// endpoint limits, which take precedence over the default.
+type Policy struct {
+	Default   Limit
+	Endpoints map[string]Limit
+	CIDRs     []CIDRLimit
+}
+
+// Lookup returns the limit that applies to ip calling endpoint and the key
+// its bucket is tracked under. The most specific matching CIDR wins. Clients
+// share one bucket across endpoints, except for endpoints with their own limit.
+func (p Policy) Lookup(endpoint string, ip netip.Addr) (string, Limit) {
+	ip = ip.Unmap()
+	best := -1
+	var limit Limit
+	for _, c := range p.CIDRs {
+		if c.Prefix.Contains(ip) && c.Prefix.Bits() > best {
+			best = c.Prefix.Bits()
+			limit = c.Limit
+		}
+	}
+	if best >= 0 {
+		return ip.String(), limit
+	}
+	if l, ok := p.Endpoints[endpoint]; ok {
+		return endpoint + " " + ip.String(), l
+	}
+	return ip.String(), p.Default
+}
+
+// Options configures a Limiter
+type Options struct {
+	MaxKeys     int           // hard cap on tracked keys, the least recently used is evicted
+	IdleTimeout time.Duration // keys unused for this long are dropped by Sweep
+	Clock       Clock         // defaults to the wall clock
+}
+
+// bucket is the token bucket of a single key
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// Limiter tracks token buckets for a bounded number of keys
+type Limiter struct {
+	mu      sync.Mutex
+	clock   Clock
+	maxKeys int
+	idle    time.Duration
+	buckets map[string]*list.Element
+	lru     *list.List // front is the most recently used bucket
+}
+
+// New creates a Limiter
+func New(opts Options) *Limiter {
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	if opts.MaxKeys < 1 {
+		opts.MaxKeys = 1
+	}
+	return &Limiter{
+		clock:   opts.Clock,
+		maxKeys: opts.MaxKeys,
+		idle:    opts.IdleTimeout,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Allow takes a token from the bucket of key. If none is left it returns
+// false and how long until the next token is available.
+func (l *Limiter) Allow(key string, limit Limit) (bool, time.Duration) {
+	if limit.Unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+
+	var b *bucket
+	if elem, ok := l.buckets[key]; ok {
+		b = elem.Value.(*bucket)
+		l.lru.MoveToFront(elem)
+
+		// Refill for the time elapsed since the last request
+		elapsed := now.Sub(b.last).Seconds()
+		if elapsed > 0 {
+			b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		}
+		b.last = now
+	} else {
+		// Make room before tracking a new key
+		for l.lru.Len() >= l.maxKeys {
+			l.removeElement(l.lru.Back())
+		}
+		b = &bucket{key: key, tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = l.lru.PushFront(b)
+	}
+
+	// A lowered burst after a config change applies immediately
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Len returns the number of tracked keys
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
+
+// Sweep drops keys that have been idle for longer than the idle timeout and
+// returns how many were dropped
+func (l *Limiter) Sweep() int {
+	if l.idle <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cutoff := l.clock.Now().Add(-l.idle)
+
+	removed := 0
+	for elem := l.lru.Back(); elem != nil; elem = l.lru.Back() {
+		if !elem.Value.(*bucket).last.Before(cutoff) {
+			break
+		}
+		l.removeElement(elem)
+		removed++
+	}
+	return removed
+}
+
+// Run sweeps idle keys every interval until ctx is done
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Sweep()
+		}
+	}
+}
+
+// removeElement drops a bucket. Callers must hold the lock.
+func (l *Limiter) removeElement(elem *list.Element) {
+	l.lru.Remove(elem)
+	delete(l.buckets, elem.Value.(*bucket).key)
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter(maxKeys int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	return New(Options{MaxKeys: maxKeys, IdleTimeout: time.Minute, Clock: clock}), clock
+}
+
+func TestAllowBurstAndRefill(t *testing.T) {
+	limiter, clock := newTestLimiter(10)
+	limit := PerMinute(60, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("a", limit); !ok {
+			t.Fatalf("Expected request %d within burst to be allowed", i+1)
+		}
+	}
+
+	ok, wait := limiter.Allow("a", limit)
+	if ok {
+		t.Fatal("Expected request beyond burst to be rejected")
+	}
+	if wait != time.Second {
+		t.Errorf("Expected retry after 1s, got %v", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := limiter.Allow("b", limit); !ok {
+		t.Error("Expected a different key to be allowed")
+	}
+
+	clock.Advance(time.Second)
+	if ok, _ := limiter.Allow("a", limit); !ok {
+		t.Error("Expected a token to be refilled after 1s")
+	}
+	if ok, _ := limiter.Allow("a", limit); ok {
+		t.Error("Expected only one token to be refilled")
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	limiter, _ := newTestLimiter(10)
+	for i := 0; i < 100; i++ {
+		if ok, _ := limiter.Allow("a", Limit{}); !ok {
+			t.Fatal("Expected zero limit to be unlimited")
+		}
+	}
+	if limiter.Len() != 0 {
+		t.Errorf("Expected unlimited keys to be untracked, got %d", limiter.Len())
+	}
+}
+
+func TestMaxKeysEvictsLeastRecentlyUsed(t *testing.T) {
+	limiter, clock := newTestLimiter(2)
+	limit := PerMinute(60, 1)
+
+	limiter.Allow("a", limit)
+	clock.Advance(time.Millisecond)
+	limiter.Allow("b", limit)
+	clock.Advance(time.Millisecond)
+	limiter.Allow("a", limit) // a is now the most recently used
+	limiter.Allow("c", limit) // evicts b
+
+	if limiter.Len() != 2 {
+		t.Fatalf("Expected 2 tracked keys, got %d", limiter.Len())
+	}
+	if ok, _ := limiter.Allow("a", limit); ok {
+		t.Error("Expected recently used key to keep its empty bucket")
+	}
+	if ok, _ := limiter.Allow("b", limit); !ok {
+		t.Error("Expected evicted key to start with a fresh bucket")
+	}
+	if limiter.Len() != 2 {
+		t.Errorf("Expected cap of 2 keys to hold, got %d", limiter.Len())
+	}
+}
+
+func TestSweepRemovesIdleKeys(t *testing.T) {
+	limiter, clock := newTestLimiter(10)
+	limit := PerMinute(60, 5)
+
+	limiter.Allow("old", limit)
+	clock.Advance(45 * time.Second)
+	limiter.Allow("new", limit)
+	clock.Advance(30 * time.Second)
+
+	if removed := limiter.Sweep(); removed != 1 {
+		t.Errorf("Expected 1 idle key to be removed, got %d", removed)
+	}
+	if limiter.Len() != 1 {
+		t.Errorf("Expected 1 tracked key, got %d", limiter.Len())
+	}
+}
+
+func TestPolicyLookup(t *testing.T) {
+	policy := Policy{
+		Default:   PerMinute(60, 60),
+		Endpoints: map[string]Limit{"/report.php": PerMinute(10, 5)},
+		CIDRs: []CIDRLimit{
+			{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Limit: PerMinute(600, 100)},
+			{Prefix: netip.MustParsePrefix("10.1.0.0/16"), Limit: Limit{}},
+		},
+	}
+
+	tests := []struct {
+		endpoint    string
+		ip          string
+		expectedKey string
+		expected    Limit
+	}{
+		{"/servers.txt", "192.0.2.1", "192.0.2.1", PerMinute(60, 60)},
+		{"/report.php", "192.0.2.1", "/report.php 192.0.2.1", PerMinute(10, 5)},
+		{"/report.php", "10.2.3.4", "10.2.3.4", PerMinute(600, 100)},
+		{"/report.php", "10.1.2.3", "10.1.2.3", Limit{}},
+		{"/report.php", "::ffff:10.2.3.4", "10.2.3.4", PerMinute(600, 100)},
+	}
+	for _, tt := range tests {
+		key, limit := policy.Lookup(tt.endpoint, netip.MustParseAddr(tt.ip))
+		if key != tt.expectedKey || limit != tt.expected {
+			t.Errorf("Lookup(%s, %s) = %q, %+v, expected %q, %+v", tt.endpoint, tt.ip, key, limit, tt.expectedKey, tt.expected)
+		}
+	}
+}
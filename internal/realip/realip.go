@@ -0,0 +1,75 @@
+// Package realip determines the client address of a request that may have
+// passed through trusted reverse proxies.
+package realip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Trusted reports whether addr is inside any of the prefixes
+func Trusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAddr parses a host or host:port into a bare address, without zone
+// and with IPv4-mapped IPv6 addresses converted to IPv4
+func ParseAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap().WithZone(""), nil
+}
+
+// FromRequest returns the client address of r. Forwarding headers are only
+// honoured when the direct peer is trusted, otherwise the peer is the client.
+//
+// X-Forwarded-For is walked from the right, skipping trusted proxies, so a
+// client cannot spoof its address by prepending entries. X-Real-IP is used
+// when X-Forwarded-For is absent.
+func FromRequest(r *http.Request, trusted []netip.Prefix) (netip.Addr, error) {
+	peer, err := ParseAddr(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if !Trusted(peer, trusted) {
+		return peer, nil
+	}
+
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := ParseAddr(hops[i])
+			if err != nil {
+				// Everything left of a malformed hop is unverifiable
+				break
+			}
+			client = hop
+			if !Trusted(hop, trusted) {
+				break
+			}
+		}
+		return client, nil
+	}
+
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		if addr, err := ParseAddr(realIP); err == nil {
+			return addr, nil
+		}
+	}
+	return peer, nil
+}
@@ -0,0 +1,66 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		expected   string
+	}{
+		{"untrusted peer", "192.0.2.1:1234", nil, "", "192.0.2.1"},
+		{"untrusted peer headers ignored", "192.0.2.1:1234", []string{"198.51.100.7"}, "198.51.100.8", "192.0.2.1"},
+		{"trusted peer without headers", "10.0.0.1:1234", nil, "", "10.0.0.1"},
+		{"forwarded for", "10.0.0.1:1234", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"spoofed leftmost entry", "10.0.0.1:1234", []string{"203.0.113.9, 198.51.100.7"}, "", "198.51.100.7"},
+		{"proxy chain", "10.0.0.1:1234", []string{"198.51.100.7, 10.0.0.2"}, "", "198.51.100.7"},
+		{"multiple headers", "10.0.0.1:1234", []string{"203.0.113.9", "198.51.100.7"}, "", "198.51.100.7"},
+		{"all trusted", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"malformed hop", "10.0.0.1:1234", []string{"198.51.100.7, garbage"}, "", "10.0.0.1"},
+		{"real ip", "10.0.0.1:1234", nil, "198.51.100.8", "198.51.100.8"},
+		{"invalid real ip", "10.0.0.1:1234", nil, "nope", "10.0.0.1"},
+		{"forwarded for wins", "10.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.8", "198.51.100.7"},
+		{"ipv6 proxy", "[fd00::1]:1234", []string{"2001:db8::5"}, "", "2001:db8::5"},
+		{"mapped peer", "[::ffff:10.0.0.1]:1234", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"hop with port", "10.0.0.1:1234", []string{"198.51.100.7:5555"}, "", "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			addr, err := FromRequest(r, trusted)
+			if err != nil {
+				t.Fatalf("FromRequest failed: %v", err)
+			}
+			if addr.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, addr)
+			}
+		})
+	}
+}
+
+func TestFromRequestInvalidRemoteAddr(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "not-an-address"
+	if _, err := FromRequest(r, nil); err == nil {
+		t.Error("Expected error for invalid remote address")
+	}
+}
@@ -0,0 +1,140 @@
+// Package reportsig signs and verifies server reports. A server signs each
+// report with HMAC-SHA256 over its port, a unix timestamp and a random
+// nonce, keyed by a secret token issued by the directory.
+package reportsig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// TokenBytes is the amount of randomness in a generated token
+const TokenBytes = 32
+
+// Verification errors
+var (
+	ErrMalformed    = errors.New("malformed signature")
+	ErrBadSignature = errors.New("signature mismatch")
+	ErrStale        = errors.New("timestamp outside the allowed window")
+	ErrReplay       = errors.New("nonce already used")
+	ErrFull         = errors.New("too many nonces in flight")
+)
+
+// noncePattern keeps nonces short and printable
+var noncePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+// GenerateToken returns a new random hex token
+func GenerateToken() (string, error) {
+	b := make([]byte, TokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Message returns the signed string for a report
+func Message(port int, timestamp int64, nonce string) string {
+	return fmt.Sprintf("%d|%d|%s", port, timestamp, nonce)
+}
+
+// Sign returns the hex HMAC-SHA256 of a report under token
+func Sign(token string, port int, timestamp int64, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(Message(port, timestamp, nonce)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Report is the signed part of a report
+type Report struct {
+	Port      int
+	Timestamp int64 // unix seconds
+	Nonce     string
+	Signature string // hex
+}
+
+// Verifier checks signatures and remembers nonces until their timestamp
+// falls out of the allowed window, so each signature is accepted once.
+// It is safe for concurrent use.
+type Verifier struct {
+	maxNonces int
+
+	mu   sync.Mutex
+	seen map[string]time.Time // key and nonce -> when it can be forgotten
+}
+
+// NewVerifier returns a verifier remembering at most maxNonces nonces
+func NewVerifier(maxNonces int) *Verifier {
+	return &Verifier{maxNonces: maxNonces, seen: make(map[string]time.Time)}
+}
+
+// Verify checks r against token at now. Timestamps more than maxSkew away
+// from now are rejected. key identifies the signer, nonces only need to be
+// unique per key.
+func (v *Verifier) Verify(key, token string, r Report, maxSkew time.Duration, now time.Time) error {
+	if !noncePattern.MatchString(r.Nonce) {
+		return ErrMalformed
+	}
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil || len(sig) != sha256.Size {
+		return ErrMalformed
+	}
+	ts := time.Unix(r.Timestamp, 0)
+	if ts.Before(now.Add(-maxSkew)) || ts.After(now.Add(maxSkew)) {
+		return ErrStale
+	}
+
+	// Check the signature before remembering the nonce, so forged reports
+	// cannot fill the cache
+	expected, _ := hex.DecodeString(Sign(token, r.Port, r.Timestamp, r.Nonce))
+	if !hmac.Equal(sig, expected) {
+		return ErrBadSignature
+	}
+
+	id := key + "|" + r.Nonce
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.seen[id]; ok {
+		return ErrReplay
+	}
+	if len(v.seen) >= v.maxNonces {
+		v.prune(now)
+		if len(v.seen) >= v.maxNonces {
+			return ErrFull
+		}
+	}
+	v.seen[id] = ts.Add(maxSkew)
+	return nil
+}
+
+// Prune forgets nonces whose timestamp is outside the window at now and
+// returns how many were dropped
+func (v *Verifier) Prune(now time.Time) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.prune(now)
+}
+
+func (v *Verifier) prune(now time.Time) int {
+	n := 0
+	for id, expires := range v.seen {
+		if now.After(expires) {
+			delete(v.seen, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of remembered nonces
+func (v *Verifier) Len() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.seen)
+}
@@ -0,0 +1,96 @@
+package reportsig
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testToken = "0123456789abcdef0123456789abcdef"
+
+func TestSign(t *testing.T) {
+	// Known answer so other implementations can check against it
+	sig := Sign(testToken, 2301, 1700000000, "abcdefgh")
+	if sig != "4d45bb4025268e5ba334995d448a0eb0c5b90ec226b91c2f45bdaa8e6c319ef6" {
+		t.Fatalf("Unexpected signature %q", sig)
+	}
+	if Sign(testToken, 2302, 1700000000, "abcdefgh") == sig {
+		t.Error("Expected the port to be covered by the signature")
+	}
+	if Message(2301, 1700000000, "abcdefgh") != "2301|1700000000|abcdefgh" {
+		t.Errorf("Unexpected message %q", Message(2301, 1700000000, "abcdefgh"))
+	}
+
+	token, err := GenerateToken()
+	if err != nil || len(token) != 2*TokenBytes {
+		t.Errorf("Unexpected token %q: %v", token, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := NewVerifier(100)
+	report := func(port int, ts time.Time, nonce string) Report {
+		return Report{Port: port, Timestamp: ts.Unix(), Nonce: nonce, Signature: Sign(testToken, port, ts.Unix(), nonce)}
+	}
+
+	r := report(2301, now, "nonce-0001")
+	if err := v.Verify("10.0.0.1:2301", testToken, r, time.Minute, now); err != nil {
+		t.Fatalf("Expected valid report, got %v", err)
+	}
+	if err := v.Verify("10.0.0.1:2301", testToken, r, time.Minute, now); !errors.Is(err, ErrReplay) {
+		t.Errorf("Expected replay to be rejected, got %v", err)
+	}
+	// Nonces are tracked per signer
+	if err := v.Verify("10.0.0.2:2301", testToken, r, time.Minute, now); err != nil {
+		t.Errorf("Expected same nonce from another server to pass, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		report   Report
+		token    string
+		expected error
+	}{
+		{"stale", report(2301, now.Add(-2*time.Minute), "nonce-0002"), testToken, ErrStale},
+		{"future", report(2301, now.Add(2*time.Minute), "nonce-0003"), testToken, ErrStale},
+		{"wrong token", report(2301, now, "nonce-0004"), "another-token-0123456789", ErrBadSignature},
+		{"short nonce", report(2301, now, "abc"), testToken, ErrMalformed},
+		{"bad hex", Report{Port: 2301, Timestamp: now.Unix(), Nonce: "nonce-0005", Signature: "zz"}, testToken, ErrMalformed},
+	}
+	for _, tt := range tests {
+		if err := v.Verify("10.0.0.1:2301", tt.token, tt.report, time.Minute, now); !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+
+	// Tampering with the port breaks the signature
+	r = report(2301, now, "nonce-0006")
+	r.Port = 2302
+	if err := v.Verify("10.0.0.1:2302", testToken, r, time.Minute, now); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected tampered port to be rejected, got %v", err)
+	}
+}
+
+func TestVerifierBounded(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := NewVerifier(2)
+	sign := func(nonce string, ts time.Time) Report {
+		return Report{Port: 2301, Timestamp: ts.Unix(), Nonce: nonce, Signature: Sign(testToken, 2301, ts.Unix(), nonce)}
+	}
+
+	v.Verify("a", testToken, sign("nonce-0001", now.Add(-50*time.Second)), time.Minute, now)
+	v.Verify("a", testToken, sign("nonce-0002", now), time.Minute, now)
+	if err := v.Verify("a", testToken, sign("nonce-0003", now), time.Minute, now); !errors.Is(err, ErrFull) {
+		t.Errorf("Expected a full cache to reject, got %v", err)
+	}
+
+	// Once the oldest nonce leaves the window there is room again
+	later := now.Add(15 * time.Second)
+	if err := v.Verify("a", testToken, sign("nonce-0003", later), time.Minute, later); err != nil {
+		t.Errorf("Expected pruning to make room, got %v", err)
+	}
+	if n := v.Prune(now.Add(2 * time.Minute)); n != 2 || v.Len() != 0 {
+		t.Errorf("Expected every nonce to be pruned, dropped %d, %d left", n, v.Len())
+	}
+}
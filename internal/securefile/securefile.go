@@ -0,0 +1,99 @@
+// Package securefile reads and writes files with path validation, size
+// limits and atomic replacement.
+package securefile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Read safely reads a file with size limits and path validation
+func Read(path string, maxSize int64) ([]byte, error) {
+	// Validate and clean the path
+	cleanPath := filepath.Clean(path)
+	if cleanPath != path {
+		return nil, fmt.Errorf("invalid file path")
+	}
+
+	// Check if path is absolute and within expected boundaries
+	if filepath.IsAbs(cleanPath) {
+		// For absolute paths, ensure they don't escape to system directories
+		if strings.Contains(cleanPath, "..") {
+			return nil, fmt.Errorf("path traversal detected")
+		}
+	}
+
+	// Check file info first
+	info, err := os.Stat(cleanPath)
+	if err != nil {
+		return nil, fmt.Errorf("file access error")
+	}
+
+	// Check file size
+	if info.Size() > maxSize {
+		return nil, fmt.Errorf("file too large")
+	}
+
+	// Read file
+	data, err := os.ReadFile(cleanPath)
+	if err != nil {
+		return nil, fmt.Errorf("file read error")
+	}
+
+	return data, nil
+}
+
+// Write safely writes a file with proper permissions and path validation
+func Write(path string, data []byte, perm os.FileMode) error {
+	// Validate and clean the path
+	cleanPath := filepath.Clean(path)
+	if cleanPath != path {
+		return fmt.Errorf("invalid file path")
+	}
+
+	// Check for path traversal
+	if strings.Contains(cleanPath, "..") {
+		return fmt.Errorf("path traversal detected")
+	}
+
+	// Ensure parent directory exists
+	dir := filepath.Dir(cleanPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory")
+	}
+
+	// Write file with secure permissions
+	if err := os.WriteFile(cleanPath, data, perm); err != nil {
+		return fmt.Errorf("file write error")
+	}
+
+	return nil
+}
+
+// WriteAtomic writes a file through a temporary sibling that is synced and
+// renamed into place, so a crash never leaves a truncated file behind
+func WriteAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	if err := Write(tmpPath, data, perm); err != nil {
+		return err
+	}
+
+	// Flush file contents to disk before publishing them
+	if file, err := os.Open(tmpPath); err == nil {
+		syncErr := file.Sync()
+		file.Close()
+		if syncErr != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("file sync error")
+		}
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("file rename error")
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package securefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "data.json")
+	if err := Write(path, []byte("hello"), 0600); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data, err := Read(path, 1024)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("Expected to read back hello, got %q, %v", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode())
+	}
+
+	if _, err := Read(path, 4); err == nil {
+		t.Error("Expected file over the size limit to be rejected")
+	}
+	if _, err := Read(path+"/../data.json", 1024); err == nil {
+		t.Error("Expected unclean path to be rejected")
+	}
+	if err := Write(t.TempDir()+"/x/../y", nil, 0600); err == nil {
+		t.Error("Expected unclean write path to be rejected")
+	}
+}
+
+func TestWriteAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := WriteAtomic(path, []byte("one"), 0600); err != nil {
+		t.Fatalf("WriteAtomic failed: %v", err)
+	}
+	if err := WriteAtomic(path, []byte("two"), 0600); err != nil {
+		t.Fatalf("WriteAtomic failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "two" {
+		t.Errorf("Expected the file to be replaced, got %q", data)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Expected the temporary file to be removed")
+	}
+}
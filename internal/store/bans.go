@@ -0,0 +1,84 @@
+package store
+
+import (
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"lusd/internal/banset"
+)
+
+// IsBlacklisted reports whether reports from ip are dropped
+func (s *ServerList) IsBlacklisted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.Config.Blacklist.Contains(addr, time.Now())
+}
+
+// GetBans returns every ban sorted by prefix
+func (s *ServerList) GetBans() []banset.Entry {
+	s.Lock()
+	defer s.Unlock()
+	return s.Config.Blacklist.Entries()
+}
+
+// AddBan bans a prefix and evicts every entry reported from inside it
+func (s *ServerList) AddBan(ban banset.Entry) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// Copy on write, the old set may still be in use by readers
+	blacklist := s.Config.Blacklist.Clone()
+	if err := blacklist.Add(ban); err != nil {
+		return err
+	}
+	s.Config.Blacklist = blacklist
+
+	for addr := range s.Entries {
+		if ap, err := netip.ParseAddrPort(addr); err == nil && ban.Prefix.Contains(ap.Addr().Unmap()) {
+			s.entryRemoved(addr, s.Entries[addr], RemovedBanned)
+			delete(s.Entries, addr)
+		}
+	}
+	for addr := range s.federated {
+		if ap, err := netip.ParseAddrPort(addr); err == nil && ban.Prefix.Contains(ap.Addr().Unmap()) {
+			delete(s.federated, addr)
+		}
+	}
+	return nil
+}
+
+// RemoveBan lifts the ban on exactly prefix. Returns false if it was not
+// banned.
+func (s *ServerList) RemoveBan(prefix netip.Prefix) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.Config.Blacklist.Get(prefix); !ok {
+		return false
+	}
+	blacklist := s.Config.Blacklist.Clone()
+	blacklist.Remove(prefix)
+	s.Config.Blacklist = blacklist
+	return true
+}
+
+// pruneBans drops expired bans, swapping in a pruned copy of the blacklist
+// only if there are any. Callers must hold the lock.
+func (s *ServerList) pruneBans(now time.Time) {
+	if !s.Config.Blacklist.HasExpired(now) {
+		return
+	}
+	blacklist := s.Config.Blacklist.Clone()
+	expired := blacklist.Prune(now)
+	if len(expired) == 0 {
+		return
+	}
+	s.Config.Blacklist = blacklist
+	for _, e := range expired {
+		slog.Info("Ban expired", "ip", e.Address())
+	}
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+)
+
+func TestIsBlacklistedNormalizesIPv6(t *testing.T) {
+	set := banset.New()
+	prefix, _ := banset.ParsePrefix("2001:db8::1")
+	set.Add(banset.Entry{Prefix: prefix})
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: set})
+
+	for _, ip := range []string{"2001:db8::1", "2001:DB8:0:0:0:0:0:1", "2001:0db8::0001"} {
+		if !servers.IsBlacklisted(ip) {
+			t.Errorf("Expected %s to be blacklisted", ip)
+		}
+	}
+	if servers.IsBlacklisted("not-an-ip") {
+		t.Error("Expected invalid IP not to be blacklisted")
+	}
+}
+
+func TestPruneBans(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	set := banset.New()
+	prefix, _ := banset.ParsePrefix("10.0.0.1")
+	set.Add(banset.Entry{Prefix: prefix, Expires: now.Add(time.Minute)})
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: set})
+	old := servers.GetConfig().Blacklist
+
+	// Nothing expired yet, the blacklist is not copied
+	servers.Lock()
+	servers.pruneBans(now)
+	servers.Unlock()
+	if servers.GetConfig().Blacklist != old {
+		t.Error("Expected the blacklist to be kept without expired bans")
+	}
+
+	servers.Lock()
+	servers.pruneBans(now.Add(2 * time.Minute))
+	servers.Unlock()
+
+	if servers.GetConfig().Blacklist.Len() != 0 {
+		t.Error("Expected expired ban to be pruned")
+	}
+	if old.Len() != 1 {
+		t.Error("Expected configs handed out earlier to be left untouched")
+	}
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/logging"
+)
+
+// Challenge constants. A challenge is a ping query whose 4-byte payload is
+// a random nonce; game servers echo ping payloads back unchanged.
+const (
+	challengeNonceSize     = 4
+	challengeRetryInterval = 30 * time.Second
+	maxPendingChallenges   = 256
+)
+
+// Challenger checks that a game server answers at addr by sending it nonce
+// and expecting it back
+type Challenger interface {
+	Challenge(ctx context.Context, addr string, nonce []byte) error
+}
+
+// UDPChallenger sends the nonce as a ping over the game's query protocol
+type UDPChallenger struct{}
+
+func (UDPChallenger) Challenge(ctx context.Context, addr string, nonce []byte) error {
+	packet, err := buildQueryPacket(addr, queryOpcodePing)
+	if err != nil {
+		return err
+	}
+	packet = append(packet, nonce...)
+	_, err = exchangeQuery(ctx, addr, packet)
+	return err
+}
+
+// StartChallenges enables ownership verification. From then on reported
+// servers are only listed after echoing a nonce sent to the reported
+// address.
+func (s *ServerList) StartChallenges(challenger Challenger) {
+	s.Lock()
+	defer s.Unlock()
+	s.challenger = challenger
+}
+
+// pending reports whether entry still waits for a challenge answer. Callers
+// must hold the lock.
+func (s *ServerList) pending(entry *ServerEntry) bool {
+	return s.challenger != nil && !entry.Verified && !entry.Pinned
+}
+
+// maybeChallenge sends a challenge to an unverified entry unless one was
+// sent recently. Callers must hold the lock.
+func (s *ServerList) maybeChallenge(addr string, entry *ServerEntry, now time.Time) {
+	if !s.pending(entry) {
+		return
+	}
+	if entry.challengedAt != 0 && now.Sub(time.Unix(entry.challengedAt, 0)) < challengeRetryInterval {
+		return
+	}
+	if s.challengesInFlight >= maxPendingChallenges {
+		return
+	}
+	entry.challengedAt = now.Unix()
+	s.challengesInFlight++
+	go s.challenge(s.challenger, addr, s.Config.ChallengeTimeout)
+}
+
+// challenge sends one challenge to addr and records the result
+func (s *ServerList) challenge(challenger Challenger, addr string, timeout time.Duration) {
+	nonce := make([]byte, challengeNonceSize)
+	_, err := rand.Read(nonce)
+	if err == nil {
+		if timeout <= 0 {
+			timeout = config.DefaultChallengeTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = challenger.Challenge(ctx, addr, nonce)
+		cancel()
+	}
+	s.recordChallenge(addr, err)
+}
+
+// recordChallenge marks addr verified if it answered its challenge
+func (s *ServerList) recordChallenge(addr string, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.challengesInFlight--
+
+	// The entry may have been removed while the challenge was in flight
+	entry, exists := s.Entries[addr]
+	if !exists {
+		return
+	}
+	if err != nil {
+		slog.Info("Challenge failed", append(logging.AddrAttrs(addr), "outcome", "challenge_failed", "error", err)...)
+		return
+	}
+	wasListed := s.listed(entry)
+	entry.Verified = true
+	s.entryChanged(addr, wasListed, entry, false)
+	slog.Info("Verified server", append(logging.AddrAttrs(addr), "outcome", "verified")...)
+}
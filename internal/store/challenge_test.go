@@ -0,0 +1,176 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+)
+
+// fakeChallenger answers challenges from a fixed set of addresses and
+// signals every challenge it handled
+type fakeChallenger struct {
+	sync.Mutex
+	owned map[string]bool
+	calls int
+	done  chan string
+}
+
+func (c *fakeChallenger) Challenge(ctx context.Context, addr string, nonce []byte) error {
+	c.Lock()
+	c.calls++
+	owned := c.owned[addr]
+	c.Unlock()
+	defer func() { c.done <- addr }()
+	if len(nonce) != challengeNonceSize {
+		return errors.New("bad nonce")
+	}
+	if !owned {
+		return errors.New("no reply")
+	}
+	return nil
+}
+
+// waitChallenge waits until the challenger handled a challenge and its
+// result was recorded
+func waitChallenge(t *testing.T, servers *ServerList, c *fakeChallenger) {
+	t.Helper()
+	select {
+	case <-c.done:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a challenge")
+	}
+	for i := 0; i < 100; i++ {
+		servers.Lock()
+		inFlight := servers.challengesInFlight
+		servers.Unlock()
+		if inFlight == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("Challenge result was never recorded")
+}
+
+func findEntry(entries []EntryDetail, addr string) (EntryDetail, bool) {
+	for _, e := range entries {
+		if e.Address == addr {
+			return e, true
+		}
+	}
+	return EntryDetail{}, false
+}
+
+func TestChallengeVerifiesEntries(t *testing.T) {
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: banset.New(), ChallengeTimeout: time.Second})
+	c := &fakeChallenger{owned: map[string]bool{"10.0.0.1:2301": true}, done: make(chan string, 10)}
+	servers.StartChallenges(c)
+
+	servers.Report("10.0.0.1", 2301)
+	servers.Report("10.0.0.2", 2301)
+	waitChallenge(t, servers, c)
+	waitChallenge(t, servers, c)
+
+	active := servers.GetActive()
+	if len(active) != 1 || active[0] != "10.0.0.1:2301" {
+		t.Errorf("Expected only the verified server to be listed, got %v", active)
+	}
+	if stats := servers.Stats(); stats.Pending != 1 {
+		t.Errorf("Expected 1 pending entry, got %d", stats.Pending)
+	}
+
+	entries := servers.GetEntries()
+	if e, _ := findEntry(entries, "10.0.0.1:2301"); !e.Verified || e.Pending {
+		t.Errorf("Expected verified entry, got %+v", e)
+	}
+	if e, _ := findEntry(entries, "10.0.0.2:2301"); e.Verified || !e.Pending {
+		t.Errorf("Expected pending entry, got %+v", e)
+	}
+
+	// Further reports within the retry interval do not challenge again
+	servers.Report("10.0.0.1", 2301)
+	servers.Report("10.0.0.2", 2301)
+	time.Sleep(10 * time.Millisecond)
+	c.Lock()
+	calls := c.calls
+	c.Unlock()
+	if calls != 2 {
+		t.Errorf("Expected no new challenges, got %d calls", calls)
+	}
+
+	// Once the retry interval passed, the pending entry is challenged again
+	servers.Lock()
+	servers.Entries["10.0.0.2:2301"].challengedAt -= int64(challengeRetryInterval / time.Second)
+	servers.Unlock()
+	servers.Report("10.0.0.2", 2301)
+	waitChallenge(t, servers, c)
+
+	// Pinned entries are listed without a challenge
+	servers.SetPinned("10.0.0.3:2301", true)
+	if e, _ := findEntry(servers.GetEntries(), "10.0.0.3:2301"); e.Pending {
+		t.Error("Expected pinned entry not to be pending")
+	}
+}
+
+func TestNoChallengesByDefault(t *testing.T) {
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: banset.New()})
+	servers.Report("10.0.0.1", 2301)
+	if len(servers.GetActive()) != 1 || servers.Stats().Pending != 0 {
+		t.Error("Expected reports to be listed right away without challenges")
+	}
+}
+
+// startPingStandIn runs a local UDP server that answers ping queries, echoing
+// the packet or, if corrupt is set, a different payload
+func startPingStandIn(t *testing.T, corrupt bool) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n != queryHeaderSize+challengeNonceSize || buf[10] != queryOpcodePing {
+				continue
+			}
+			resp := append([]byte{}, buf[:n]...)
+			if corrupt {
+				resp[n-1]++
+			}
+			conn.WriteTo(resp, from)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestUDPChallenger(t *testing.T) {
+	nonce := []byte{1, 2, 3, 4}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := (UDPChallenger{}).Challenge(ctx, startPingStandIn(t, false), nonce); err != nil {
+		t.Errorf("Expected echoed nonce to pass, got %v", err)
+	}
+	if err := (UDPChallenger{}).Challenge(ctx, startPingStandIn(t, true), nonce); err == nil {
+		t.Error("Expected a wrong nonce to fail")
+	}
+
+	packet, _ := buildQueryPacket("127.0.0.1:2301", queryOpcodePing)
+	if !bytes.Equal(packet[:4], []byte(queryMagic)) || packet[10] != 'p' {
+		t.Errorf("Unexpected ping header %v", packet)
+	}
+}
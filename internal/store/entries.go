@@ -0,0 +1,119 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// EntryDetail is a reported server as shown by the admin API, including
+// entries that are stale or not yet verified
+type EntryDetail struct {
+	Address   string      `json:"address"`
+	FirstSeen int64       `json:"firstSeen"`
+	LastSeen  int64       `json:"lastSeen"`
+	LastProbe int64       `json:"lastProbe,omitempty"`
+	Pinned    bool        `json:"pinned"`
+	Signed    bool        `json:"signed"`
+	Verified  bool        `json:"verified"`
+	Pending   bool        `json:"pending"` // not listed until it answers a challenge
+	Info      *ServerInfo `json:"info,omitempty"`
+}
+
+// GetOfficial returns a copy of the official server list
+func (s *ServerList) GetOfficial() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string{}, s.Config.OfficialServers...)
+}
+
+// AddOfficial adds addr to the official server list. Returns false if it
+// was already official.
+func (s *ServerList) AddOfficial(addr string) bool {
+	s.Lock()
+	defer s.Unlock()
+	for _, official := range s.Config.OfficialServers {
+		if official == addr {
+			return false
+		}
+	}
+	// Copy on write, the old slice may still be in use by readers
+	s.Config.OfficialServers = append(append([]string{}, s.Config.OfficialServers...), addr)
+	s.officialChanged()
+	return true
+}
+
+// RemoveOfficial removes addr from the official server list. Returns false
+// if it was not official.
+func (s *ServerList) RemoveOfficial(addr string) bool {
+	s.Lock()
+	defer s.Unlock()
+	var list []string
+	found := false
+	for _, official := range s.Config.OfficialServers {
+		if official == addr {
+			found = true
+			continue
+		}
+		list = append(list, official)
+	}
+	if found {
+		s.Config.OfficialServers = list
+		s.officialChanged()
+	}
+	return found
+}
+
+// GetEntries returns every reported entry sorted by address
+func (s *ServerList) GetEntries() []EntryDetail {
+	s.Lock()
+	defer s.Unlock()
+	entries := make([]EntryDetail, 0, len(s.Entries))
+	for addr, entry := range s.Entries {
+		entries = append(entries, EntryDetail{
+			Address:   addr,
+			FirstSeen: entry.FirstSeen,
+			LastSeen:  entry.LastSeen,
+			LastProbe: entry.LastProbe,
+			Pinned:    entry.Pinned,
+			Signed:    entry.Signed,
+			Verified:  entry.Verified,
+			Pending:   s.pending(entry),
+			Info:      entry.Info.Clone(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Address < entries[j].Address })
+	return entries
+}
+
+// Evict removes addr from the list. Returns false if it was not listed.
+func (s *ServerList) Evict(addr string) bool {
+	s.Lock()
+	defer s.Unlock()
+	entry, exists := s.Entries[addr]
+	if !exists {
+		return false
+	}
+	s.entryRemoved(addr, entry, RemovedEvicted)
+	delete(s.Entries, addr)
+	return true
+}
+
+// SetPinned pins or unpins addr. Pinned entries are listed regardless of
+// staleness or probe results. Pinning an unknown address creates its entry.
+func (s *ServerList) SetPinned(addr string, pinned bool) bool {
+	s.Lock()
+	defer s.Unlock()
+	entry, exists := s.Entries[addr]
+	if !exists {
+		if !pinned {
+			return false
+		}
+		now := time.Now().Unix()
+		entry = &ServerEntry{FirstSeen: now, LastSeen: now}
+		s.Entries[addr] = entry
+	}
+	wasListed := exists && s.listed(entry)
+	entry.Pinned = pinned
+	s.entryChanged(addr, wasListed, entry, false)
+	return true
+}
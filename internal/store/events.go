@@ -0,0 +1,112 @@
+package store
+
+import (
+	"lusd/internal/events"
+)
+
+// Event types published for changes of the server list
+const (
+	EventServerAdded     = "server_added"
+	EventServerUpdated   = "server_updated"
+	EventServerRemoved   = "server_removed"
+	EventOfficialChanged = "official_changed"
+)
+
+// Reasons a server is removed, as in the server_removed event
+const (
+	RemovedStale        = "stale"
+	RemovedUnresponsive = "unresponsive"
+	RemovedEvicted      = "evicted"
+	RemovedBanned       = "banned"
+	RemovedUnlisted     = "unlisted" // unpinned while still unverified
+)
+
+// ServerEvent is the data of the server_added, server_updated and
+// server_removed events
+type ServerEvent struct {
+	Address   string      `json:"address"`
+	FirstSeen int64       `json:"firstSeen,omitempty"`
+	LastSeen  int64       `json:"lastSeen,omitempty"`
+	Info      *ServerInfo `json:"info,omitempty"`
+	Reason    string      `json:"reason,omitempty"` // why a server was removed
+}
+
+// OfficialEvent is the data of the official_changed event
+type OfficialEvent struct {
+	Servers []string `json:"servers"`
+}
+
+// PublishEvents makes the server list publish changes of its locally
+// reported servers and of the official list to bus
+func (s *ServerList) PublishEvents(bus *events.Bus) {
+	s.Lock()
+	defer s.Unlock()
+	s.events = bus
+}
+
+// listed reports whether entry is listed, apart from staleness which
+// CleanupLoop acts on. Callers must hold the lock.
+func (s *ServerList) listed(entry *ServerEntry) bool {
+	if entry.Pinned {
+		return true
+	}
+	// With probing enabled, only list servers that answered a probe
+	if s.prober != nil && entry.LastProbe == 0 {
+		return false
+	}
+	// With challenges enabled, only list servers that proved the address
+	return !s.pending(entry)
+}
+
+// entryChanged publishes the event for entry at addr after a change, given
+// whether it was listed before and whether its metadata changed, and pushes
+// it to federation peers if it is listed. Callers must hold the lock.
+func (s *ServerList) entryChanged(addr string, wasListed bool, entry *ServerEntry, updated bool) {
+	listed := s.listed(entry)
+	if s.pusher != nil && listed && (!wasListed || updated) {
+		s.pusher.Push(addr, entry.Info)
+	}
+	if s.events == nil {
+		return
+	}
+	switch {
+	case listed && !wasListed:
+		s.events.Publish(EventServerAdded, serverEvent(addr, entry, ""))
+	case listed && updated:
+		s.events.Publish(EventServerUpdated, serverEvent(addr, entry, ""))
+	case !listed && wasListed:
+		s.events.Publish(EventServerRemoved, serverEvent(addr, entry, RemovedUnlisted))
+	}
+}
+
+// entryRemoved publishes server_removed for entry at addr, which is being
+// deleted for reason, if it was listed. Callers must hold the lock.
+func (s *ServerList) entryRemoved(addr string, entry *ServerEntry, reason string) {
+	if s.events != nil && s.listed(entry) {
+		s.events.Publish(EventServerRemoved, serverEvent(addr, entry, reason))
+	}
+}
+
+// officialChanged publishes official_changed with the current list.
+// Callers must hold the lock.
+func (s *ServerList) officialChanged() {
+	if s.events != nil {
+		s.events.Publish(EventOfficialChanged, OfficialEvent{Servers: append([]string{}, s.Config.OfficialServers...)})
+	}
+}
+
+// serverEvent describes entry at addr
+func serverEvent(addr string, entry *ServerEntry, reason string) ServerEvent {
+	return ServerEvent{
+		Address:   addr,
+		FirstSeen: entry.FirstSeen,
+		LastSeen:  entry.LastSeen,
+		Info:      entry.Info.Clone(),
+		Reason:    reason,
+	}
+}
+
+// infoChanged reports whether info differs from the metadata already known
+func infoChanged(known, info *ServerInfo) bool {
+	return info != nil && (known == nil || *known != *info)
+}
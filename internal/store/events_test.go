@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/events"
+)
+
+// nextEvent returns the next event published to sub, failing the test if
+// there is none
+func nextEvent(t *testing.T, sub *events.Subscription) (string, ServerEvent) {
+	t.Helper()
+	select {
+	case e := <-sub.C:
+		var data ServerEvent
+		json.Unmarshal(e.Data, &data)
+		return e.Type, data
+	default:
+		t.Fatal("Expected an event")
+		return "", ServerEvent{}
+	}
+}
+
+func TestServerListEvents(t *testing.T) {
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: banset.New()})
+	bus := events.New(events.Options{History: 16, MaxSubscribers: 1, Buffer: 16})
+	servers.PublishEvents(bus)
+	sub, _, _, _ := bus.Subscribe(0)
+
+	servers.ReportInfo("192.0.2.1", 2301, &ServerInfo{Name: "DM", Players: 1, MaxPlayers: 8})
+	if typ, data := nextEvent(t, sub); typ != EventServerAdded || data.Address != "192.0.2.1:2301" || data.Info.Name != "DM" {
+		t.Errorf("Expected server_added, got %s %+v", typ, data)
+	}
+
+	// Heartbeats without changes are not events, changed metadata is
+	servers.ReportInfo("192.0.2.1", 2301, &ServerInfo{Name: "DM", Players: 1, MaxPlayers: 8})
+	servers.Report("192.0.2.1", 2301)
+	servers.ReportInfo("192.0.2.1", 2301, &ServerInfo{Name: "DM", Players: 2, MaxPlayers: 8})
+	if typ, data := nextEvent(t, sub); typ != EventServerUpdated || data.Info.Players != 2 {
+		t.Errorf("Expected server_updated, got %s %+v", typ, data)
+	}
+
+	servers.Evict("192.0.2.1:2301")
+	if typ, data := nextEvent(t, sub); typ != EventServerRemoved || data.Reason != RemovedEvicted {
+		t.Errorf("Expected server_removed, got %s %+v", typ, data)
+	}
+
+	servers.AddOfficial("192.0.2.9")
+	select {
+	case e := <-sub.C:
+		if e.Type != EventOfficialChanged || string(e.Data) != `{"servers":["192.0.2.9"]}` {
+			t.Errorf("Expected official_changed, got %s %s", e.Type, e.Data)
+		}
+	default:
+		t.Error("Expected official_changed")
+	}
+}
+
+func TestServerListEventsWaitForProbe(t *testing.T) {
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: banset.New(), ProbeInterval: time.Hour, ProbeTimeout: time.Second, ProbeMaxFailures: 1})
+	bus := events.New(events.Options{History: 16, MaxSubscribers: 1, Buffer: 16})
+	servers.PublishEvents(bus)
+	sub, _, _, _ := bus.Subscribe(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	servers.StartProbing(ctx, &fakeProber{})
+
+	// Unprobed servers are not listed yet
+	servers.Report("192.0.2.1", 2301)
+	if len(sub.C) != 0 {
+		t.Fatal("Expected no event before the first probe")
+	}
+	servers.recordProbe("192.0.2.1:2301", nil, nil)
+	if typ, _ := nextEvent(t, sub); typ != EventServerAdded {
+		t.Errorf("Expected server_added after the probe, got %s", typ)
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"slices"
+	"time"
+
+	"lusd/internal/config"
+)
+
+// maxFederationHops drops records that passed through too many directories
+const maxFederationHops = 8
+
+// FederatedRecord is a server in a federation feed or push. Via lists the
+// nodes the record passed through, oldest first.
+type FederatedRecord struct {
+	Address  string      `json:"address"`
+	LastSeen int64       `json:"lastSeen,omitempty"`
+	Info     *ServerInfo `json:"info,omitempty"`
+	Via      []string    `json:"via"`
+}
+
+// federatedSource is what one peer told us about a server
+type federatedSource struct {
+	LastSeen int64
+	Expires  int64
+}
+
+// Pusher forwards local servers to peer directories. Push is called with
+// the lock held and must not block.
+type Pusher interface {
+	Push(addr string, info *ServerInfo)
+}
+
+// PushListed makes the server list hand local servers to p once they are
+// listed, and again when their metadata changes
+func (s *ServerList) PushListed(p Pusher) {
+	s.Lock()
+	defer s.Unlock()
+	s.pusher = p
+}
+
+// federatedEntry is a server learned from peer directories
+type federatedEntry struct {
+	FirstSeen int64
+	Info      *ServerInfo
+	Via       []string
+	Sources   map[string]federatedSource // peer name -> source
+}
+
+// lastSeen returns the most recent sighting reported by any live source
+func (e *federatedEntry) lastSeen(now int64) (int64, []string) {
+	var last int64
+	var names []string
+	for name, src := range e.Sources {
+		if src.Expires <= now {
+			continue
+		}
+		names = append(names, name)
+		if src.LastSeen > last {
+			last = src.LastSeen
+		}
+	}
+	slices.Sort(names)
+	return last, names
+}
+
+// MergeFederated records what peer told us about servers at now. Records
+// that already passed through this node, are banned or invalid are skipped.
+// Returns how many records were accepted.
+func (s *ServerList) MergeFederated(peer string, stale time.Duration, records []FederatedRecord, now time.Time) int {
+	s.Lock()
+	defer s.Unlock()
+	if s.federated == nil {
+		s.federated = make(map[string]*federatedEntry)
+	}
+	node := s.Config.FederationNodeID
+	expires := now.Add(stale).Unix()
+
+	accepted := 0
+	for _, rec := range records {
+		addr, ip, ok := config.CanonicalServerAddr(rec.Address)
+		if !ok || len(rec.Via) >= maxFederationHops || slices.Contains(rec.Via, node) {
+			continue
+		}
+		if s.Config.Blacklist.Contains(ip, now) {
+			continue
+		}
+		info := rec.Info.Clone()
+		if info != nil && info.Validate() != nil {
+			info = nil
+		}
+
+		entry, exists := s.federated[addr]
+		if !exists {
+			entry = &federatedEntry{FirstSeen: now.Unix(), Sources: make(map[string]federatedSource)}
+			s.federated[addr] = entry
+		}
+		lastSeen := rec.LastSeen
+		if lastSeen <= 0 || lastSeen > now.Unix() {
+			lastSeen = now.Unix()
+		}
+		entry.Sources[peer] = federatedSource{LastSeen: lastSeen, Expires: expires}
+		entry.Via = slices.Clone(rec.Via)
+		if info != nil {
+			entry.Info = info
+		}
+		accepted++
+	}
+	return accepted
+}
+
+// ExpireFederated drops peer sightings that went stale, and servers no
+// peer lists any more
+func (s *ServerList) ExpireFederated(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	cutoff := now.Unix()
+	for addr, entry := range s.federated {
+		for name, src := range entry.Sources {
+			if src.Expires <= cutoff {
+				delete(entry.Sources, name)
+			}
+		}
+		if len(entry.Sources) == 0 {
+			delete(s.federated, addr)
+		}
+	}
+}
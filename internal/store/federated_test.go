@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+)
+
+func findRecord(records []ServerRecord, addr string) (ServerRecord, bool) {
+	for _, rec := range records {
+		if rec.Address == addr {
+			return rec, true
+		}
+	}
+	return ServerRecord{}, false
+}
+
+func TestFederationMergeAndExpire(t *testing.T) {
+	now := time.Now()
+	set := banset.New()
+	prefix, _ := banset.ParsePrefix("10.9.0.0/16")
+	set.Add(banset.Entry{Prefix: prefix})
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: set, FederationNodeID: "node-b"})
+	servers.ReportInfo("10.0.0.1", 2301, nil)
+
+	records := []FederatedRecord{
+		{Address: "10.0.0.1:2301", Via: []string{"node-a"}},
+		{Address: "10.0.0.2:2301", Via: []string{"node-a"}},
+		{Address: "10.9.0.1:2301", Via: []string{"node-a"}},
+	}
+	if n := servers.MergeFederated("a", time.Minute, records, now); n != 2 {
+		t.Errorf("Expected banned server to be skipped, accepted %d", n)
+	}
+	servers.MergeFederated("c", 10*time.Minute, records[1:2], now)
+
+	// Local reports keep their own record, with the peer attributed
+	rec, _ := findRecord(servers.GetRecords(), "10.0.0.1:2301")
+	if !slices.Equal(rec.Sources, []string{"local", "a"}) {
+		t.Errorf("Expected local and peer sources, got %v", rec.Sources)
+	}
+	rec, _ = findRecord(servers.GetRecords(), "10.0.0.2:2301")
+	if !slices.Equal(rec.Sources, []string{"a", "c"}) {
+		t.Errorf("Expected two peer sources, got %v", rec.Sources)
+	}
+
+	// Each peer's sightings expire on that peer's timeout
+	servers.ExpireFederated(now.Add(2 * time.Minute))
+	if servers.Stats().Federated != 1 {
+		t.Errorf("Expected only the server c still lists to remain, got %d", servers.Stats().Federated)
+	}
+	servers.ExpireFederated(now.Add(11 * time.Minute))
+	if servers.Stats().Federated != 0 {
+		t.Error("Expected every mirrored server to expire")
+	}
+}
+
+func TestMergeFederatedHopLimit(t *testing.T) {
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: banset.New(), FederationNodeID: "node-b"})
+
+	// Records that travelled too far are dropped
+	via := make([]string, maxFederationHops)
+	for i := range via {
+		via[i] = "hop"
+	}
+	records := []FederatedRecord{{Address: "10.0.0.9:2301", Via: via}}
+	if n := servers.MergeFederated("a", time.Minute, records, time.Now()); n != 0 {
+		t.Error("Expected record beyond the hop limit to be dropped")
+	}
+
+	// As are records that already passed through this node
+	records = []FederatedRecord{{Address: "10.0.0.9:2301", Via: []string{"node-b", "node-a"}}}
+	if n := servers.MergeFederated("a", time.Minute, records, time.Now()); n != 0 {
+		t.Error("Expected record that passed through this node to be dropped")
+	}
+}
+
+// recordingPusher remembers the addresses pushed to it
+type recordingPusher struct {
+	pushed []string
+}
+
+func (p *recordingPusher) Push(addr string, info *ServerInfo) {
+	p.pushed = append(p.pushed, addr)
+}
+
+func TestPushListed(t *testing.T) {
+	cfg := config.Config{
+		StaleTimeout:     time.Minute,
+		Blacklist:        banset.New(),
+		ProbeTimeout:     time.Second,
+		ProbeConcurrency: 1,
+		ProbeMaxFailures: 3,
+	}
+	pusher := &recordingPusher{}
+	servers := New(cfg)
+	servers.PushListed(pusher)
+	servers.Lock()
+	servers.prober = &fakeProber{alive: map[string]bool{"10.0.0.1:2301": true}}
+	servers.Unlock()
+
+	// Not pushed until a probe lists it
+	servers.Report("10.0.0.1", 2301)
+	servers.Report("10.0.0.2", 2301)
+	if len(pusher.pushed) != 0 {
+		t.Fatalf("Expected unlisted servers not to be pushed, got %v", pusher.pushed)
+	}
+
+	servers.probeAll(context.Background())
+	if !slices.Equal(pusher.pushed, []string{"10.0.0.1:2301"}) {
+		t.Fatalf("Expected the listed server to be pushed once, got %v", pusher.pushed)
+	}
+
+	// Heartbeats without new metadata are left to pulls
+	servers.Report("10.0.0.1", 2301)
+	servers.ReportInfo("10.0.0.1", 2301, &ServerInfo{Name: "Renamed", MaxPlayers: 16})
+	if !slices.Equal(pusher.pushed, []string{"10.0.0.1:2301", "10.0.0.1:2301"}) {
+		t.Errorf("Expected a push for the metadata change only, got %v", pusher.pushed)
+	}
+}
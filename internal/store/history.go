@@ -0,0 +1,35 @@
+package store
+
+import (
+	"time"
+
+	"lusd/internal/history"
+)
+
+// RecordHistory makes the server list record heartbeats, probes and
+// whether each reported server is listed to h
+func (s *ServerList) RecordHistory(h *history.Recorder) {
+	s.Lock()
+	defer s.Unlock()
+	s.history = h
+}
+
+// sampleHistory records every reported server that is listed at now, with
+// its player count. CleanupLoop calls it once a minute after removing stale
+// entries. Callers must hold the lock.
+func (s *ServerList) sampleHistory(now time.Time) {
+	if s.history == nil {
+		return
+	}
+	cutoff := now.Add(-s.Config.StaleTimeout).Unix()
+	for addr, entry := range s.Entries {
+		if !entry.Pinned && entry.LastSeen < cutoff || !s.listed(entry) {
+			continue
+		}
+		players := -1
+		if entry.Info != nil {
+			players = entry.Info.Players
+		}
+		s.history.Listed(addr, now, players)
+	}
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/history"
+)
+
+func TestServerListHistory(t *testing.T) {
+	servers := New(config.Config{StaleTimeout: time.Minute, ProbeMaxFailures: 3, Blacklist: banset.New()})
+	h := history.New(filepath.Join(t.TempDir(), history.File), 10)
+	servers.RecordHistory(h)
+
+	servers.ReportInfo("192.0.2.1", 2301, &ServerInfo{Name: "DM", Players: 3, MaxPlayers: 8})
+	servers.recordProbe("192.0.2.1:2301", nil, errors.New("timeout"))
+	servers.Lock()
+	servers.sampleHistory(time.Now())
+	servers.Unlock()
+
+	report, ok := h.Get("192.0.2.1:2301", time.Now(), time.Minute)
+	if !ok || len(report.Points) != 1 {
+		t.Fatalf("Expected one minute of history, got %+v", report)
+	}
+	if p := report.Points[0]; p.Up != 1 || p.Reports != 1 || p.FailedProbes != 1 || p.PeakPlayers != 3 {
+		t.Errorf("Unexpected sample %+v", p)
+	}
+
+	// Stale servers are not listed
+	servers.Lock()
+	servers.sampleHistory(time.Now().Add(2 * time.Minute))
+	servers.Unlock()
+	if report, _ := h.Get("192.0.2.1:2301", time.Now().Add(2*time.Minute), time.Minute); len(report.Points) != 1 {
+		t.Errorf("Expected no sample for a stale server, got %+v", report.Points)
+	}
+}
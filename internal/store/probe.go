@@ -0,0 +1,224 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"lusd/internal/logging"
+)
+
+// Query protocol constants. Liberty Unleashed servers answer the same style of
+// UDP query as the other GTA multiplayer mods: a 4-byte magic, the queried
+// IPv4 address and little-endian port, then a one byte opcode. Replies echo
+// the 11-byte header before their payload.
+const (
+	queryMagic       = "LUMP"
+	queryHeaderSize  = 11
+	queryOpcodeInfo  = 'i'
+	queryOpcodePing  = 'p'
+	maxQueryReplyLen = 2048
+)
+
+// Prober checks whether a game server is answering at addr and returns the
+// metadata it advertised, if any
+type Prober interface {
+	Probe(ctx context.Context, addr string) (*ServerInfo, error)
+}
+
+// UDPProber probes servers with the game's UDP query packet
+type UDPProber struct{}
+
+// buildQueryPacket builds a query header for the given server address
+func buildQueryPacket(addr string, opcode byte) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address")
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+
+	packet := make([]byte, queryHeaderSize)
+	copy(packet, queryMagic)
+	// The header only has room for IPv4; IPv6 servers get a zeroed address
+	if ip4 := ip.To4(); ip4 != nil {
+		copy(packet[4:8], ip4)
+	}
+	binary.LittleEndian.PutUint16(packet[8:10], uint16(port))
+	packet[10] = opcode
+	return packet, nil
+}
+
+// exchangeQuery sends a query packet to addr and returns the reply, which
+// must start with an echo of the packet
+func exchangeQuery(ctx context.Context, addr string, packet []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial error: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(packet); err != nil {
+		return nil, fmt.Errorf("write error: %w", err)
+	}
+
+	reply := make([]byte, maxQueryReplyLen)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return nil, fmt.Errorf("read error: %w", err)
+	}
+	if n < len(packet) || !bytes.Equal(reply[:len(packet)], packet) {
+		return nil, fmt.Errorf("unexpected reply")
+	}
+	return reply[:n], nil
+}
+
+func (UDPProber) Probe(ctx context.Context, addr string) (*ServerInfo, error) {
+	packet, err := buildQueryPacket(addr, queryOpcodeInfo)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := exchangeQuery(ctx, addr, packet)
+	if err != nil {
+		return nil, err
+	}
+
+	// The server answered, so a malformed payload only costs us the metadata
+	info, err := parseInfoReply(reply[queryHeaderSize:])
+	if err != nil {
+		return nil, nil
+	}
+	return info, nil
+}
+
+// StartProbing enables liveness probing. From then on reported servers are
+// only listed after they answered a probe, and are removed once they stop
+// answering for ProbeMaxFailures consecutive rounds.
+func (s *ServerList) StartProbing(ctx context.Context, prober Prober) {
+	s.Lock()
+	s.prober = prober
+	s.Unlock()
+	go s.probeLoop(ctx)
+}
+
+// probeLoop probes all reported servers every ProbeInterval until ctx is
+// done
+func (s *ServerList) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.GetConfig().ProbeInterval)
+	defer ticker.Stop()
+
+	// Probe right away so restored servers are listed again quickly
+	s.probeAll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.probeAll(ctx)
+	}
+}
+
+// probeAll runs one probing round, honouring the concurrency and rate limits
+func (s *ServerList) probeAll(ctx context.Context) {
+	s.Lock()
+	prober := s.prober
+	cfg := s.Config
+	addrs := make([]string, 0, len(s.Entries))
+	for addr := range s.Entries {
+		addrs = append(addrs, addr)
+	}
+	s.Unlock()
+
+	if prober == nil || len(addrs) == 0 {
+		return
+	}
+
+	concurrency := cfg.ProbeConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var throttle <-chan time.Time
+	if cfg.ProbeRate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(cfg.ProbeRate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		if throttle != nil && i > 0 {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+				wg.Wait()
+				return
+			}
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			probeCtx, cancel := context.WithTimeout(ctx, cfg.ProbeTimeout)
+			info, err := prober.Probe(probeCtx, addr)
+			cancel()
+			s.recordProbe(addr, info, err)
+		}(addr)
+	}
+	wg.Wait()
+}
+
+// recordProbe updates the probe state of addr with the result of a probe
+func (s *ServerList) recordProbe(addr string, info *ServerInfo, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// The entry may have been removed while the probe was in flight
+	entry, exists := s.Entries[addr]
+	if !exists {
+		return
+	}
+
+	s.history.Probe(addr, time.Now(), err == nil)
+	if err == nil {
+		wasListed := s.listed(entry)
+		updated := infoChanged(entry.Info, info)
+		entry.LastProbe = time.Now().Unix()
+		entry.probeFailures = 0
+		if info != nil {
+			entry.Info = info
+		}
+		s.entryChanged(addr, wasListed, entry, updated)
+		return
+	}
+
+	entry.probeFailures++
+	if entry.probeFailures >= s.Config.ProbeMaxFailures && !entry.Pinned {
+		slog.Info("Removing unresponsive server", append(logging.AddrAttrs(addr), "outcome", "unresponsive", "failed_probes", entry.probeFailures)...)
+		s.entryRemoved(addr, entry, RemovedUnresponsive)
+		s.serverUnreachable(addr, entry, RemovedUnresponsive)
+		delete(s.Entries, addr)
+	}
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+)
+
+// fakeProber answers probes from a fixed set of responsive addresses
+type fakeProber struct {
+	sync.Mutex
+	alive map[string]bool
+}
+
+func (p *fakeProber) Probe(ctx context.Context, addr string) (*ServerInfo, error) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.alive[addr] {
+		return nil, errors.New("no reply")
+	}
+	return &ServerInfo{Name: "Probed " + addr, Players: 1, MaxPlayers: 32}, nil
+}
+
+// startQueryStandIn runs a local UDP server that answers query packets the
+// way a game server would, echoing the header followed by a payload
+func startQueryStandIn(t *testing.T, reply bool) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	serveQueries(conn, reply)
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String()
+}
+
+// serveQueries answers query packets on conn until it is closed
+func serveQueries(conn net.PacketConn, reply bool) {
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if !reply || n != queryHeaderSize || string(buf[:4]) != queryMagic {
+				continue
+			}
+			resp := append([]byte{}, buf[:n]...)
+			resp = append(resp, 1, 3, 0, 32, 0)
+			resp = append(resp, 4, 0, 0, 0)
+			resp = append(resp, "Test"...)
+			resp = append(resp, 2, 0, 0, 0)
+			resp = append(resp, "DM"...)
+			conn.WriteTo(resp, from)
+		}
+	}()
+}
+
+func TestBuildQueryPacket(t *testing.T) {
+	packet, err := buildQueryPacket("1.2.3.4:2301", queryOpcodeInfo)
+	if err != nil {
+		t.Fatalf("buildQueryPacket failed: %v", err)
+	}
+	expected := []byte{'L', 'U', 'M', 'P', 1, 2, 3, 4, 0xFD, 0x08, 'i'}
+	if string(packet) != string(expected) {
+		t.Errorf("Expected packet %v, got %v", expected, packet)
+	}
+
+	// IPv6 servers are keyed in brackets and get a zeroed address
+	packet, err = buildQueryPacket("[2001:db8::1]:2301", queryOpcodeInfo)
+	if err != nil {
+		t.Fatalf("buildQueryPacket failed for IPv6: %v", err)
+	}
+	expected = []byte{'L', 'U', 'M', 'P', 0, 0, 0, 0, 0xFD, 0x08, 'i'}
+	if string(packet) != string(expected) {
+		t.Errorf("Expected IPv6 packet %v, got %v", expected, packet)
+	}
+
+	if _, err := buildQueryPacket("not-an-address", queryOpcodeInfo); err == nil {
+		t.Error("Expected error for invalid address")
+	}
+}
+
+func TestUDPProber(t *testing.T) {
+	addr := startQueryStandIn(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	info, err := (UDPProber{}).Probe(ctx, addr)
+	if err != nil {
+		t.Fatalf("Expected probe to succeed, got %v", err)
+	}
+	expected := ServerInfo{Name: "Test", Gamemode: "DM", Players: 3, MaxPlayers: 32, Password: true}
+	if info == nil || *info != expected {
+		t.Errorf("Expected info %+v, got %+v", expected, info)
+	}
+
+	silent := startQueryStandIn(t, false)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := (UDPProber{}).Probe(ctx, silent); err == nil {
+		t.Error("Expected probe of silent server to fail")
+	}
+}
+
+func TestServerListProbingIPv6(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	defer conn.Close()
+	serveQueries(conn, true)
+
+	servers := New(config.Config{
+		StaleTimeout:     time.Minute,
+		ProbeInterval:    time.Hour,
+		ProbeTimeout:     time.Second,
+		ProbeConcurrency: 1,
+		ProbeMaxFailures: 1,
+	})
+	servers.Lock()
+	servers.prober = UDPProber{}
+	servers.Unlock()
+
+	servers.Report("::1", conn.LocalAddr().(*net.UDPAddr).Port)
+	servers.probeAll(context.Background())
+	records := servers.GetRecords()
+	if len(records) != 1 || records[0].Info == nil || records[0].Info.Name != "Test" {
+		t.Errorf("Expected the IPv6 server to answer its probe, got %+v", records)
+	}
+}
+
+func TestServerListProbing(t *testing.T) {
+	cfg := config.Config{
+		StaleTimeout:     time.Minute,
+		Blacklist:        banset.New(),
+		ProbeInterval:    time.Hour,
+		ProbeTimeout:     time.Second,
+		ProbeConcurrency: 4,
+		ProbeRate:        1000,
+		ProbeMaxFailures: 2,
+	}
+	prober := &fakeProber{alive: map[string]bool{"127.0.0.1:2301": true}}
+
+	servers := New(cfg)
+	servers.Lock()
+	servers.prober = prober
+	servers.Unlock()
+
+	servers.Report("127.0.0.1", 2301)
+	servers.Report("127.0.0.1", 2302)
+
+	if active := servers.GetActive(); len(active) != 0 {
+		t.Errorf("Expected unprobed servers to be hidden, got %v", active)
+	}
+
+	servers.probeAll(context.Background())
+	active := servers.GetActive()
+	if len(active) != 1 || active[0] != "127.0.0.1:2301" {
+		t.Errorf("Expected only the responsive server, got %v", active)
+	}
+	if records := servers.GetRecords(); len(records) != 1 || records[0].Info == nil || records[0].Info.Name != "Probed 127.0.0.1:2301" {
+		t.Errorf("Expected probe metadata to be recorded, got %+v", records)
+	}
+
+	servers.probeAll(context.Background())
+	servers.Lock()
+	_, exists := servers.Entries["127.0.0.1:2302"]
+	servers.Unlock()
+	if exists {
+		t.Error("Expected unresponsive server to be removed")
+	}
+
+	// A server that stops answering is dropped as well
+	prober.Lock()
+	prober.alive["127.0.0.1:2301"] = false
+	prober.Unlock()
+	servers.probeAll(context.Background())
+	servers.probeAll(context.Background())
+	if active := servers.GetActive(); len(active) != 0 {
+		t.Errorf("Expected server that stopped answering to be removed, got %v", active)
+	}
+}
+
+func TestLoopsStopWithContext(t *testing.T) {
+	servers := New(config.Config{StaleTimeout: time.Minute, ProbeInterval: time.Hour, ProbeTimeout: time.Second})
+	servers.Lock()
+	servers.prober = &fakeProber{}
+	servers.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); servers.probeLoop(ctx) }()
+	go func() { defer wg.Done(); servers.CleanupLoop(ctx) }()
+	cancel()
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected probe and cleanup loops to stop once the context is done")
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"errors"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/reportsig"
+)
+
+// maxSignatureNonces bounds the nonces remembered for replay protection
+const maxSignatureNonces = 100000
+
+// Report signature errors
+var (
+	ErrSignatureRequired = errors.New("signature required")
+	ErrNotRegistered     = errors.New("signed report from unregistered server")
+)
+
+// isOfficialServer reports whether ip:port is listed in officialServers,
+// either by address or by IP alone
+func isOfficialServer(official []string, ip netip.Addr, port int) bool {
+	for _, addr := range official {
+		if ap, err := netip.ParseAddrPort(addr); err == nil {
+			if ap.Addr().Unmap() == ip && int(ap.Port()) == port {
+				return true
+			}
+			continue
+		}
+		if a, err := netip.ParseAddr(addr); err == nil && a.Unmap() == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyReport applies the signature policy to a report from ip:port.
+// Registered servers sign with their token, official servers must sign if
+// registration.requireOfficial is set, anyone else may report unsigned.
+// Returns whether the report carried a valid signature.
+func (s *ServerList) VerifyReport(ip netip.Addr, port int, form url.Values, now time.Time) (bool, error) {
+	cfg := s.GetConfig()
+	addr := config.ServerAddr(ip.String(), port)
+	reg, registered := cfg.Registrations[addr]
+
+	sig := strings.TrimSpace(form.Get("sig"))
+	if sig == "" {
+		if registered && reg.Policy == config.PolicyRequired {
+			return false, ErrSignatureRequired
+		}
+		if cfg.RegistrationRequireOfficial && isOfficialServer(cfg.OfficialServers, ip, port) {
+			return false, ErrSignatureRequired
+		}
+		return false, nil
+	}
+	if !registered {
+		return false, ErrNotRegistered
+	}
+
+	ts, err := strconv.ParseInt(form.Get("ts"), 10, 64)
+	if err != nil {
+		return false, reportsig.ErrMalformed
+	}
+	maxSkew := cfg.RegistrationMaxSkew
+	if maxSkew <= 0 {
+		maxSkew = config.DefaultSignatureMaxSkew
+	}
+	report := reportsig.Report{Port: port, Timestamp: ts, Nonce: form.Get("nonce"), Signature: sig}
+	if err := s.signatures.Verify(addr, reg.Token, report, maxSkew, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetRegistrations returns every registration sorted by address
+func (s *ServerList) GetRegistrations() []config.Registration {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]config.Registration, 0, len(s.Config.Registrations))
+	for _, reg := range s.Config.Registrations {
+		list = append(list, reg)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
+
+// SetRegistration adds reg, replacing any token already issued for its
+// address
+func (s *ServerList) SetRegistration(reg config.Registration) {
+	s.Lock()
+	defer s.Unlock()
+	// Copy on write, the old map may still be in use by readers
+	regs := make(map[string]config.Registration, len(s.Config.Registrations)+1)
+	for addr, r := range s.Config.Registrations {
+		regs[addr] = r
+	}
+	regs[reg.Address] = reg
+	s.Config.Registrations = regs
+}
+
+// RemoveRegistration revokes the token of addr. Returns false if it was not
+// registered.
+func (s *ServerList) RemoveRegistration(addr string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.Config.Registrations[addr]; !ok {
+		return false
+	}
+	regs := make(map[string]config.Registration, len(s.Config.Registrations))
+	for a, r := range s.Config.Registrations {
+		if a != addr {
+			regs[a] = r
+		}
+	}
+	s.Config.Registrations = regs
+	return true
+}
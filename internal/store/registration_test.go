@@ -0,0 +1,79 @@
+package store
+
+import (
+	"errors"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/reportsig"
+)
+
+const testRegistrationToken = "registration-token-0123456789"
+
+// signedForm builds the form fields of a signed report
+func signedForm(token string, port int, ts time.Time, nonce string) url.Values {
+	return url.Values{
+		"port":  {strconv.Itoa(port)},
+		"ts":    {strconv.FormatInt(ts.Unix(), 10)},
+		"nonce": {nonce},
+		"sig":   {reportsig.Sign(token, port, ts.Unix(), nonce)},
+	}
+}
+
+func TestVerifyReport(t *testing.T) {
+	now := time.Now()
+	servers := New(config.Config{
+		StaleTimeout:        time.Minute,
+		Blacklist:           banset.New(),
+		OfficialServers:     []string{"10.0.0.3", "10.0.0.4:2301"},
+		RegistrationMaxSkew: time.Minute,
+		Registrations: map[string]config.Registration{
+			"10.0.0.1:2301": {Address: "10.0.0.1:2301", Token: testRegistrationToken, Policy: config.PolicyRequired},
+			"10.0.0.2:2301": {Address: "10.0.0.2:2301", Token: testRegistrationToken, Policy: config.PolicyOptional},
+		},
+	})
+	ip := netip.MustParseAddr
+
+	tests := []struct {
+		name     string
+		ip       string
+		form     url.Values
+		signed   bool
+		expected error
+	}{
+		{"anonymous legacy report", "10.0.0.9", url.Values{}, false, nil},
+		{"official without requireOfficial", "10.0.0.3", url.Values{}, false, nil},
+		{"claimed and signed", "10.0.0.1", signedForm(testRegistrationToken, 2301, now, "nonce-0001"), true, nil},
+		{"replayed", "10.0.0.1", signedForm(testRegistrationToken, 2301, now, "nonce-0001"), false, reportsig.ErrReplay},
+		{"stale", "10.0.0.1", signedForm(testRegistrationToken, 2301, now.Add(-time.Hour), "nonce-0002"), false, reportsig.ErrStale},
+		{"wrong token", "10.0.0.1", signedForm("someone-elses-token-0123", 2301, now, "nonce-0003"), false, reportsig.ErrBadSignature},
+		{"claimed unsigned", "10.0.0.1", url.Values{}, false, ErrSignatureRequired},
+		{"optional unsigned", "10.0.0.2", url.Values{}, false, nil},
+		{"optional signed", "10.0.0.2", signedForm(testRegistrationToken, 2301, now, "nonce-0004"), true, nil},
+		{"signed but unregistered", "10.0.0.9", signedForm(testRegistrationToken, 2301, now, "nonce-0005"), false, ErrNotRegistered},
+	}
+	for _, tt := range tests {
+		signed, err := servers.VerifyReport(ip(tt.ip), 2301, tt.form, now)
+		if !errors.Is(err, tt.expected) || signed != tt.signed {
+			t.Errorf("%s: got %v, %v, expected %v, %v", tt.name, signed, err, tt.signed, tt.expected)
+		}
+	}
+
+	// With requireOfficial, official servers need a registration to report
+	cfg := servers.GetConfig()
+	cfg.RegistrationRequireOfficial = true
+	servers.SetConfig(cfg)
+	for _, addr := range []string{"10.0.0.3", "10.0.0.4"} {
+		if _, err := servers.VerifyReport(ip(addr), 2301, url.Values{}, now); !errors.Is(err, ErrSignatureRequired) {
+			t.Errorf("Expected unsigned report from official %s to be rejected, got %v", addr, err)
+		}
+	}
+	if _, err := servers.VerifyReport(ip("10.0.0.4"), 2302, url.Values{}, now); err != nil {
+		t.Errorf("Expected other ports of an official IP:port to stay anonymous, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Server metadata limits
+const (
+	maxServerNameLen = 64   // Max server name length in runes
+	maxGamemodeLen   = 32   // Max gamemode length in runes
+	maxPlayerCount   = 1000 // Max players and max players value
+)
+
+// ServerInfo is the metadata a game server advertises about itself
+type ServerInfo struct {
+	Name       string `json:"name"`
+	Gamemode   string `json:"gamemode"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"maxPlayers"`
+	Password   bool   `json:"password"`
+}
+
+// Clone returns a copy of info that is safe to hand out without the lock
+func (info *ServerInfo) Clone() *ServerInfo {
+	if info == nil {
+		return nil
+	}
+	c := *info
+	return &c
+}
+
+// sanitizeText strips control characters and invalid UTF-8 from s and caps
+// it at maxLen runes
+func sanitizeText(s string, maxLen int) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range strings.ToValidUTF8(s, "") {
+		if n >= maxLen {
+			break
+		}
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			continue
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Validate sanitizes the text fields of info and checks the player counts
+func (info *ServerInfo) Validate() error {
+	info.Name = sanitizeText(info.Name, maxServerNameLen)
+	info.Gamemode = sanitizeText(info.Gamemode, maxGamemodeLen)
+
+	if info.MaxPlayers < 0 || info.MaxPlayers > maxPlayerCount {
+		return fmt.Errorf("invalid max players")
+	}
+	if info.Players < 0 || info.Players > maxPlayerCount {
+		return fmt.Errorf("invalid players")
+	}
+	if info.MaxPlayers > 0 && info.Players > info.MaxPlayers {
+		return fmt.Errorf("players exceed max players")
+	}
+	return nil
+}
+
+// parseInfoReply decodes the payload of an info query reply: a password
+// flag, player count and max players, then length-prefixed hostname and
+// gamemode strings
+func parseInfoReply(payload []byte) (*ServerInfo, error) {
+	if len(payload) < 5 {
+		return nil, fmt.Errorf("short info reply")
+	}
+
+	info := &ServerInfo{
+		Password:   payload[0] != 0,
+		Players:    int(binary.LittleEndian.Uint16(payload[1:3])),
+		MaxPlayers: int(binary.LittleEndian.Uint16(payload[3:5])),
+	}
+	rest := payload[5:]
+
+	readString := func() (string, error) {
+		if len(rest) < 4 {
+			return "", fmt.Errorf("truncated string length")
+		}
+		n := binary.LittleEndian.Uint32(rest[:4])
+		if uint64(n) > uint64(len(rest)-4) {
+			return "", fmt.Errorf("truncated string")
+		}
+		s := string(rest[4 : 4+n])
+		rest = rest[4+n:]
+		return s, nil
+	}
+
+	var err error
+	if info.Name, err = readString(); err != nil {
+		return nil, err
+	}
+	if info.Gamemode, err = readString(); err != nil {
+		return nil, err
+	}
+
+	if err := info.Validate(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
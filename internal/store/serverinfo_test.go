@@ -0,0 +1,47 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseInfoReply(t *testing.T) {
+	payload := []byte{0, 2, 0, 16, 0, 3, 0, 0, 0, 'L', 'U', '1', 1, 0, 0, 0, 'X'}
+	info, err := parseInfoReply(payload)
+	if err != nil {
+		t.Fatalf("parseInfoReply failed: %v", err)
+	}
+	expected := ServerInfo{Name: "LU1", Gamemode: "X", Players: 2, MaxPlayers: 16}
+	if *info != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *info)
+	}
+
+	// A string length past the end of the packet must be rejected
+	truncated := []byte{0, 2, 0, 16, 0, 0xFF, 0xFF, 0xFF, 0xFF, 'L'}
+	if _, err := parseInfoReply(truncated); err == nil {
+		t.Error("Expected error for truncated reply")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	info := &ServerInfo{Name: "  My\x00 Server\n", Gamemode: strings.Repeat("x", 100), Players: 5, MaxPlayers: 32}
+	if err := info.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if info.Name != "My Server" {
+		t.Errorf("Expected sanitized name 'My Server', got %q", info.Name)
+	}
+	if len(info.Gamemode) != maxGamemodeLen {
+		t.Errorf("Expected gamemode capped at %d, got %d", maxGamemodeLen, len(info.Gamemode))
+	}
+
+	for _, invalid := range []ServerInfo{
+		{Players: -1},
+		{MaxPlayers: 100000},
+		{Players: 10, MaxPlayers: 5},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", invalid)
+		}
+	}
+}
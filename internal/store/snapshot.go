@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/securefile"
+)
+
+// Snapshot constants
+const (
+	maxSnapshotFileSize = 32 * 1024 * 1024 // 32MB max snapshot file size
+	snapshotFileMode    = 0600             // Owner read/write only
+	snapshotVersion     = 2
+)
+
+// snapshot represents the structure of the on-disk server list snapshot.
+// Version 1 snapshots stored only the last seen timestamp per address.
+type snapshot struct {
+	Version int                        `json:"version"`
+	SavedAt int64                      `json:"savedAt"`
+	Entries map[string]json.RawMessage `json:"entries"`
+}
+
+// SaveSnapshot atomically writes the reported entries to path.
+// Official servers are not included since they come from the config.
+func (s *ServerList) SaveSnapshot(path string) error {
+	s.snapshotMutex.Lock()
+	defer s.snapshotMutex.Unlock()
+
+	s.Lock()
+	snap := snapshot{
+		Version: snapshotVersion,
+		SavedAt: time.Now().Unix(),
+		Entries: make(map[string]json.RawMessage, len(s.Entries)),
+	}
+	for addr, entry := range s.Entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			s.Unlock()
+			return fmt.Errorf("snapshot encode error")
+		}
+		snap.Entries[addr] = data
+	}
+	s.Unlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("snapshot encode error")
+	}
+
+	return securefile.WriteAtomic(path, data, snapshotFileMode)
+}
+
+// LoadSnapshot restores reported entries from path, skipping entries that
+// are already stale, unless pinned, banned or malformed. A missing snapshot is not an error.
+// Returns the number of restored entries.
+func (s *ServerList) LoadSnapshot(path string) (int, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	data, err := securefile.Read(path, maxSnapshotFileSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("snapshot parse error")
+	}
+	if snap.Version < 1 || snap.Version > snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	cutoff := now.Add(-s.Config.StaleTimeout).Unix()
+
+	restored := 0
+	for addr, raw := range snap.Entries {
+		var entry ServerEntry
+		if snap.Version == 1 {
+			if err := json.Unmarshal(raw, &entry.LastSeen); err != nil {
+				continue
+			}
+			entry.FirstSeen = entry.LastSeen
+		} else if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		// Pinned entries are listed regardless of staleness, so keep them
+		if entry.LastSeen < cutoff && !entry.Pinned {
+			continue
+		}
+		// Validate address format and metadata
+		canonical, ip, ok := config.CanonicalServerAddr(addr)
+		if !ok {
+			slog.Warn("Skipping invalid address in snapshot", "address", addr)
+			continue
+		}
+		addr = canonical
+		// Bans added since the snapshot was written apply right away
+		if s.Config.Blacklist.Contains(ip, now) {
+			continue
+		}
+		if entry.Info != nil && entry.Info.Validate() != nil {
+			entry.Info = nil
+		}
+		// Never overwrite a fresher heartbeat received since startup
+		if cur, exists := s.Entries[addr]; exists && cur.LastSeen >= entry.LastSeen {
+			continue
+		}
+		s.Entries[addr] = &entry
+		restored++
+	}
+
+	return restored, nil
+}
+
+// SnapshotLoop periodically persists the server list to path until ctx is
+// done
+func (s *ServerList) SnapshotLoop(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.SaveSnapshot(path); err != nil {
+			slog.Error("Error writing snapshot", "error", err)
+		}
+	}
+}
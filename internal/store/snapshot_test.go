@@ -0,0 +1,175 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	cfg := config.Config{
+		StaleTimeout: time.Minute,
+		Blacklist:    banset.New(),
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	servers := New(cfg)
+	servers.Report("127.0.0.1", 2301)
+	servers.ReportInfo("10.0.0.1", 2302, &ServerInfo{Name: "Snapshot", MaxPlayers: 16})
+
+	if err := servers.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Expected temporary snapshot file to be removed")
+	}
+
+	restored := New(cfg)
+	n, err := restored.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 restored servers, got %d", n)
+	}
+
+	active := restored.GetActive()
+	if len(active) != 2 || active[0] != "10.0.0.1:2302" || active[1] != "127.0.0.1:2301" {
+		t.Errorf("Unexpected active list after restore: %v", active)
+	}
+	if entry := restored.Entries["10.0.0.1:2302"]; entry.Info == nil || entry.Info.Name != "Snapshot" {
+		t.Errorf("Expected metadata to be restored, got %+v", entry.Info)
+	}
+}
+
+func TestSnapshotRoundTripIPv6(t *testing.T) {
+	cfg := config.Config{StaleTimeout: time.Minute}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	servers := New(cfg)
+	servers.Report("2001:db8::1", 2301)
+	if _, ok := servers.Entries["[2001:db8::1]:2301"]; !ok {
+		t.Fatalf("Expected IPv6 server to be stored in brackets, got %v", servers.GetActive())
+	}
+	if err := servers.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	restored := New(cfg)
+	if n, err := restored.LoadSnapshot(path); err != nil || n != 1 {
+		t.Fatalf("Expected 1 restored IPv6 server, got n=%d err=%v", n, err)
+	}
+	if active := restored.GetActive(); len(active) != 1 || active[0] != "[2001:db8::1]:2301" {
+		t.Errorf("Unexpected active list after restore: %v", active)
+	}
+}
+
+func TestLoadSnapshotVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	data := fmt.Sprintf(`{"version":1,"savedAt":0,"entries":{"127.0.0.1:2301":%d}}`, time.Now().Unix())
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	servers := New(config.Config{StaleTimeout: time.Minute})
+	if n, err := servers.LoadSnapshot(path); err != nil || n != 1 {
+		t.Errorf("Expected 1 restored server from version 1 snapshot, got n=%d err=%v", n, err)
+	}
+}
+
+func TestSnapshotSkipsStaleEntries(t *testing.T) {
+	cfg := config.Config{
+		StaleTimeout: time.Minute,
+		Blacklist:    banset.New(),
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	servers := New(cfg)
+	servers.Report("127.0.0.1", 2301)
+	servers.Lock()
+	servers.Entries["10.0.0.1:2302"] = &ServerEntry{LastSeen: time.Now().Add(-time.Hour).Unix()}
+	servers.Entries["not-an-ip:2303"] = &ServerEntry{LastSeen: time.Now().Unix()}
+	servers.Unlock()
+
+	if err := servers.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	restored := New(cfg)
+	n, err := restored.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 restored server, got %d", n)
+	}
+	if _, exists := restored.Entries["10.0.0.1:2302"]; exists {
+		t.Error("Expected stale server to be skipped")
+	}
+}
+
+func TestSnapshotKeepsStalePinnedEntries(t *testing.T) {
+	cfg := config.Config{
+		StaleTimeout: time.Minute,
+		Blacklist:    banset.New(),
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	servers := New(cfg)
+	servers.Report("10.0.0.1", 2301)
+	if !servers.SetPinned("10.0.0.1:2301", true) {
+		t.Fatal("Expected the entry to be pinned")
+	}
+	servers.Lock()
+	servers.Entries["10.0.0.1:2301"].LastSeen = time.Now().Add(-time.Hour).Unix()
+	servers.Unlock()
+	if err := servers.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	restored := New(cfg)
+	if n, err := restored.LoadSnapshot(path); err != nil || n != 1 {
+		t.Fatalf("Expected the stale pinned server to be restored, got n=%d err=%v", n, err)
+	}
+	if entry := restored.Entries["10.0.0.1:2301"]; entry == nil || !entry.Pinned {
+		t.Errorf("Expected the pin to survive a restart, got %+v", entry)
+	}
+}
+
+func TestLoadSnapshotSkipsBannedAndInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	now := time.Now().Unix()
+	data := fmt.Sprintf(`{"version":2,"savedAt":0,"entries":{
+		"1.2.3.4:8000":{"lastSeen":%d},
+		"10.0.0.1:0":{"lastSeen":%d},
+		"10.0.0.1:70000":{"lastSeen":%d},
+		"10.0.0.2:02301":{"lastSeen":%d}}}`, now, now, now, now)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	// Banned after the snapshot was written
+	blacklist := banset.New()
+	prefix, _ := banset.ParsePrefix("1.2.3.4")
+	blacklist.Add(banset.Entry{Prefix: prefix})
+	servers := New(config.Config{StaleTimeout: time.Minute, Blacklist: blacklist})
+	if n, err := servers.LoadSnapshot(path); err != nil || n != 1 {
+		t.Fatalf("Expected only the valid unbanned server to be restored, got n=%d err=%v", n, err)
+	}
+	if active := servers.GetActive(); len(active) != 1 || active[0] != "10.0.0.2:2301" {
+		t.Errorf("Expected the canonical address only, got %v", active)
+	}
+}
+
+func TestLoadSnapshotMissingFile(t *testing.T) {
+	servers := New(config.Config{StaleTimeout: time.Minute})
+	n, err := servers.LoadSnapshot(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || n != 0 {
+		t.Errorf("Expected missing snapshot to be ignored, got n=%d err=%v", n, err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package store holds the server directory: reported entries, servers
+// mirrored from federation peers, bans, registrations and the liveness
+// checks that decide which servers are listed.
+package store
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/events"
+	"lusd/internal/history"
+	"lusd/internal/logging"
+	"lusd/internal/reportsig"
+	"lusd/internal/webhook"
+)
+
+// ServerEntry is a reported server and everything known about it
+type ServerEntry struct {
+	FirstSeen int64       `json:"firstSeen"`
+	LastSeen  int64       `json:"lastSeen"`
+	LastProbe int64       `json:"lastProbe,omitempty"` // last successful probe
+	Pinned    bool        `json:"pinned,omitempty"`    // listed regardless of staleness
+	Signed    bool        `json:"signed,omitempty"`    // last report carried a valid signature
+	Verified  bool        `json:"verified,omitempty"`  // answered an ownership challenge
+	Info      *ServerInfo `json:"info,omitempty"`
+
+	probeFailures int   // consecutive failed probes
+	challengedAt  int64 // when the last challenge was sent
+}
+
+// ServerRecord is a listed server as exposed by the JSON endpoints
+type ServerRecord struct {
+	Address   string      `json:"address"`
+	Official  bool        `json:"official"`
+	FirstSeen int64       `json:"firstSeen,omitempty"`
+	LastSeen  int64       `json:"lastSeen,omitempty"`
+	Info      *ServerInfo `json:"info,omitempty"`
+	Sources   []string    `json:"sources,omitempty"` // "local" and the peers that list it
+	Via       []string    `json:"-"`                 // federation chain of a mirrored server
+}
+
+// ServerList is the directory of reported and mirrored servers
+type ServerList struct {
+	sync.Mutex
+	Entries map[string]*ServerEntry
+	Config  config.Config
+
+	snapshotMutex sync.Mutex          // serializes snapshot writes
+	prober        Prober              // set once StartProbing has been called
+	challenger    Challenger          // set once StartChallenges has been called
+	events        *events.Bus         // set once PublishEvents has been called
+	webhooks      *webhook.Dispatcher // set once NotifyWebhooks has been called
+	history       *history.Recorder   // set once RecordHistory has been called
+	pusher        Pusher              // set once PushListed has been called
+	staleEvicted  uint64              // entries removed by CleanupLoop
+
+	federated  map[string]*federatedEntry // servers mirrored from peer directories
+	signatures *reportsig.Verifier        // nonces of signed reports
+
+	challengesInFlight int
+}
+
+// ServerStats summarizes the server list for monitoring
+type ServerStats struct {
+	Active       int
+	Official     int
+	Entries      int
+	Federated    int
+	Pending      int // entries waiting for a challenge answer
+	StaleEvicted uint64
+}
+
+// New creates a server list. Stale entries are removed while CleanupLoop
+// runs.
+func New(cfg config.Config) *ServerList {
+	s := &ServerList{
+		Entries:    make(map[string]*ServerEntry),
+		Config:     cfg,
+		signatures: reportsig.NewVerifier(maxSignatureNonces),
+	}
+	return s
+}
+
+func (s *ServerList) Report(ip string, port int) {
+	s.ReportInfo(ip, port, nil)
+}
+
+// ReportInfo records a heartbeat along with the metadata the server sent.
+// A nil info keeps whatever metadata is already known.
+func (s *ServerList) ReportInfo(ip string, port int, info *ServerInfo) {
+	s.ReportSigned(ip, port, info, false)
+}
+
+// ReportSigned records a heartbeat like ReportInfo, noting whether it
+// carried a valid signature
+func (s *ServerList) ReportSigned(ip string, port int, info *ServerInfo, signed bool) {
+	addr := config.ServerAddr(ip, port)
+	now := time.Now().Unix()
+	s.Lock()
+	defer s.Unlock()
+
+	entry, exists := s.Entries[addr]
+	if !exists {
+		entry = &ServerEntry{FirstSeen: now}
+		s.Entries[addr] = entry
+	}
+	wasListed := exists && s.listed(entry)
+	updated := infoChanged(entry.Info, info)
+	entry.LastSeen = now
+	entry.Signed = signed
+	if info != nil {
+		entry.Info = info
+	}
+	s.history.Heartbeat(addr, time.Unix(now, 0))
+	if !exists {
+		s.serverRegistered(addr, entry)
+	}
+	s.entryChanged(addr, wasListed, entry, updated)
+	s.maybeChallenge(addr, entry, time.Unix(now, 0))
+}
+
+// GetConfig returns a copy of the current configuration
+func (s *ServerList) GetConfig() config.Config {
+	s.Lock()
+	defer s.Unlock()
+	return s.Config
+}
+
+// SetConfig swaps in a new configuration and returns the previous one
+func (s *ServerList) SetConfig(cfg config.Config) config.Config {
+	s.Lock()
+	defer s.Unlock()
+	old := s.Config
+	s.Config = cfg
+	if !slices.Equal(old.OfficialServers, cfg.OfficialServers) {
+		s.officialChanged()
+	}
+	return old
+}
+
+func (s *ServerList) GetActive() []string {
+	records := s.GetRecords()
+	list := make([]string, 0, len(records))
+	for _, rec := range records {
+		list = append(list, rec.Address)
+	}
+	return list
+}
+
+// GetRecords returns all listed servers sorted by address
+func (s *ServerList) GetRecords() []ServerRecord {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().Unix()
+	cutoff := time.Now().Add(-s.Config.StaleTimeout).Unix()
+
+	// Use a map to avoid duplicates
+	activeMap := make(map[string]*ServerRecord)
+
+	// Add all non-stale servers from reported entries
+	for addr, entry := range s.Entries {
+		if !entry.Pinned && entry.LastSeen < cutoff || !s.listed(entry) {
+			continue
+		}
+		activeMap[addr] = &ServerRecord{
+			Address:   addr,
+			FirstSeen: entry.FirstSeen,
+			LastSeen:  entry.LastSeen,
+			Info:      entry.Info.Clone(),
+			Sources:   []string{config.LocalSource},
+		}
+	}
+	// Add servers mirrored from peer directories, local reports win
+	for addr, entry := range s.federated {
+		lastSeen, sources := entry.lastSeen(now)
+		if len(sources) == 0 {
+			continue
+		}
+		if rec, exists := activeMap[addr]; exists {
+			rec.Sources = append(rec.Sources, sources...)
+			continue
+		}
+		activeMap[addr] = &ServerRecord{
+			Address:   addr,
+			FirstSeen: entry.FirstSeen,
+			LastSeen:  lastSeen,
+			Info:      entry.Info.Clone(),
+			Sources:   sources,
+			Via:       entry.Via,
+		}
+	}
+	// Add all official servers
+	for _, addr := range s.Config.OfficialServers {
+		if rec, exists := activeMap[addr]; exists {
+			rec.Official = true
+			continue
+		}
+		activeMap[addr] = &ServerRecord{Address: addr, Official: true}
+	}
+
+	// Convert to sorted slice
+	list := make([]ServerRecord, 0, len(activeMap))
+	for _, rec := range activeMap {
+		list = append(list, *rec)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
+
+// Stats returns the current server list counters
+func (s *ServerList) Stats() ServerStats {
+	active := len(s.GetRecords())
+	s.Lock()
+	defer s.Unlock()
+	pending := 0
+	for _, entry := range s.Entries {
+		if s.pending(entry) {
+			pending++
+		}
+	}
+	return ServerStats{
+		Active:       active,
+		Official:     len(s.Config.OfficialServers),
+		Entries:      len(s.Entries),
+		Federated:    len(s.federated),
+		Pending:      pending,
+		StaleEvicted: s.staleEvicted,
+	}
+}
+
+// CleanupLoop removes stale entries, expired bans and signature nonces, and
+// samples the server history once a minute until ctx is done
+func (s *ServerList) CleanupLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.Lock()
+		s.pruneBans(time.Now())
+		s.signatures.Prune(time.Now())
+		cutoff := time.Now().Add(-s.Config.StaleTimeout).Unix()
+		for addr, entry := range s.Entries {
+			if entry.LastSeen < cutoff && !entry.Pinned {
+				slog.Info("Removing stale server", append(logging.AddrAttrs(addr), "outcome", "stale", "last_seen", entry.LastSeen)...)
+				s.entryRemoved(addr, entry, RemovedStale)
+				s.serverUnreachable(addr, entry, RemovedStale)
+				delete(s.Entries, addr)
+				s.staleEvicted++
+			}
+		}
+		s.sampleHistory(time.Now())
+		s.Unlock()
+	}
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+)
+
+func TestServerList(t *testing.T) {
+	cfg := config.Config{
+		Port:             80,
+		AllowedUserAgent: "LU-Server/0.1",
+		StaleTimeout:     time.Minute,
+		Blacklist:        banset.New(),
+		OfficialServers:  []string{"192.168.1.100:1234"},
+		LogFile:          "",
+		LogEnabled:       false,
+	}
+
+	servers := New(cfg)
+
+	// Test reporting a server
+	servers.Report("127.0.0.1", 2301)
+
+	active := servers.GetActive()
+	found := false
+	for _, addr := range active {
+		if addr == "127.0.0.1:2301" {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Error("Expected to find reported server in active list")
+	}
+
+	// Test official servers are included
+	found = false
+	for _, addr := range active {
+		if addr == "192.168.1.100:1234" {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Error("Expected to find official server in active list")
+	}
+}
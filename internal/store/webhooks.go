@@ -0,0 +1,46 @@
+package store
+
+import (
+	"net/netip"
+
+	"lusd/internal/config"
+	"lusd/internal/webhook"
+)
+
+// RegisteredWebhook is the data of the server_registered webhook event
+type RegisteredWebhook struct {
+	Address string      `json:"address"`
+	Signed  bool        `json:"signed"`
+	Info    *ServerInfo `json:"info,omitempty"`
+}
+
+// UnreachableWebhook is the data of the official_unreachable webhook event
+type UnreachableWebhook struct {
+	Address  string `json:"address"`
+	LastSeen int64  `json:"lastSeen"`
+	Reason   string `json:"reason"` // stale or unresponsive
+}
+
+// NotifyWebhooks makes the server list send new registrations and
+// official servers that become unreachable to d
+func (s *ServerList) NotifyWebhooks(d *webhook.Dispatcher) {
+	s.Lock()
+	defer s.Unlock()
+	s.webhooks = d
+}
+
+// serverRegistered notifies webhooks of the first report of addr, or the
+// first since it was removed. Callers must hold the lock.
+func (s *ServerList) serverRegistered(addr string, entry *ServerEntry) {
+	s.webhooks.Notify(config.WebhookServerRegistered, RegisteredWebhook{Address: addr, Signed: entry.Signed, Info: entry.Info.Clone()})
+}
+
+// serverUnreachable notifies webhooks if addr, which is being removed for
+// reason, is an official server. Callers must hold the lock.
+func (s *ServerList) serverUnreachable(addr string, entry *ServerEntry, reason string) {
+	ap, err := netip.ParseAddrPort(addr)
+	if err != nil || !isOfficialServer(s.Config.OfficialServers, ap.Addr().Unmap(), int(ap.Port())) {
+		return
+	}
+	s.webhooks.Notify(config.WebhookOfficialUnreachable, UnreachableWebhook{Address: addr, LastSeen: entry.LastSeen, Reason: reason})
+}
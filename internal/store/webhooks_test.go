@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lusd/internal/banset"
+	"lusd/internal/config"
+	"lusd/internal/webhook"
+)
+
+func TestServerListWebhooks(t *testing.T) {
+	got := make(chan webhook.Payload, 8)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhook.Payload
+		json.NewDecoder(r.Body).Decode(&p)
+		got <- p
+	}))
+	defer receiver.Close()
+
+	servers := New(config.Config{
+		StaleTimeout:     time.Minute,
+		Blacklist:        banset.New(),
+		OfficialServers:  []string{"192.0.2.1"},
+		ProbeInterval:    time.Hour,
+		ProbeTimeout:     time.Second,
+		ProbeMaxFailures: 1,
+		WebhookTargets:   []config.WebhookTarget{{Name: "mods", URL: receiver.URL, Secret: "webhook-secret-0123456789"}},
+		WebhookTimeout:   time.Second,
+		WebhookQueueSize: 10,
+	})
+	hooks := webhook.New(servers.GetConfig, "lusd/test", "")
+	servers.NotifyWebhooks(hooks)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	servers.StartProbing(ctx, &fakeProber{})
+	go hooks.Run(ctx)
+
+	wait := func(event string) json.RawMessage {
+		t.Helper()
+		select {
+		case p := <-got:
+			if p.Event != event {
+				t.Errorf("Expected %s, got %s", event, p.Event)
+			}
+			return p.Data
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %s", event)
+			return nil
+		}
+	}
+
+	// Only the first report of an address is a registration
+	servers.ReportInfo("192.0.2.1", 2301, &ServerInfo{Name: "Official"})
+	servers.Report("192.0.2.1", 2301)
+	var registered RegisteredWebhook
+	if json.Unmarshal(wait(config.WebhookServerRegistered), &registered); registered.Address != "192.0.2.1:2301" || registered.Info.Name != "Official" {
+		t.Errorf("Unexpected registration %+v", registered)
+	}
+
+	// An official server that stops answering probes is unreachable
+	servers.recordProbe("192.0.2.1:2301", nil, context.DeadlineExceeded)
+	var unreachable UnreachableWebhook
+	if json.Unmarshal(wait(config.WebhookOfficialUnreachable), &unreachable); unreachable.Reason != RemovedUnresponsive {
+		t.Errorf("Unexpected unreachable event %+v", unreachable)
+	}
+	select {
+	case p := <-got:
+		t.Errorf("Unexpected event %+v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,125 @@
+// Admin dashboard: manages bans and official servers through the admin
+// API. The token is kept in session storage, so it is gone once the tab
+// is closed.
+"use strict";
+
+(function () {
+  const tokenKey = "lusd-admin-token";
+  const signin = document.getElementById("signin");
+  const dashboard = document.getElementById("dashboard");
+  const signout = document.getElementById("signout");
+
+  function showDashboard(signedIn) {
+    signin.hidden = signedIn;
+    dashboard.hidden = !signedIn;
+    signout.hidden = !signedIn;
+  }
+
+  // admin calls the admin API with the token, signing out if it is rejected
+  async function admin(path, options) {
+    const opts = Object.assign({}, options);
+    opts.headers = Object.assign({ Authorization: "Bearer " + sessionStorage.getItem(tokenKey) }, opts.headers);
+    if (opts.body !== undefined) {
+      opts.headers["Content-Type"] = "application/json";
+      opts.body = JSON.stringify(opts.body);
+    }
+    try {
+      return await fetchJSON(path, opts);
+    } catch (err) {
+      if (err.status === 401) {
+        sessionStorage.removeItem(tokenKey);
+        showDashboard(false);
+      }
+      throw err;
+    }
+  }
+
+  function removeButton(label, onClick) {
+    const button = el("button", { type: "button", className: "danger", textContent: label });
+    button.addEventListener("click", onClick);
+    return button;
+  }
+
+  async function loadBans() {
+    const { bans } = await admin("/admin/bans");
+    document.getElementById("bans").replaceChildren(...bans.map((ban) =>
+      el("tr", null,
+        el("td", { className: "addr", textContent: ban.ip }),
+        el("td", { textContent: ban.reason || "" }),
+        el("td", { textContent: ban.expires ? formatTime(ban.expires) : "Never" }),
+        el("td", { className: "num" }, removeButton("Unban", () =>
+          change(admin("/admin/bans?ip=" + encodeURIComponent(ban.ip), { method: "DELETE" }), "Unbanned " + ban.ip))))));
+  }
+
+  async function loadOfficial() {
+    const { officialServers } = await admin("/admin/official");
+    document.getElementById("officialServers").replaceChildren(...officialServers.map((addr) =>
+      el("tr", null,
+        el("td", { className: "addr", textContent: addr }),
+        el("td", { className: "num" }, removeButton("Remove", () =>
+          change(admin("/admin/official?address=" + encodeURIComponent(addr), { method: "DELETE" }), "Removed " + addr))))));
+  }
+
+  async function refresh() {
+    try {
+      await Promise.all([loadBans(), loadOfficial()]);
+      showDashboard(true);
+    } catch (err) {
+      setStatus(err.status === 401 ? "Invalid admin token" : "Could not load the directory state: " + err.message, true);
+    }
+  }
+
+  // change waits for a request that modifies the state, then reloads it
+  async function change(request, done) {
+    try {
+      await request;
+      setStatus(done);
+      await refresh();
+      return true;
+    } catch (err) {
+      setStatus(err.message, true);
+      return false;
+    }
+  }
+
+  signin.addEventListener("submit", (e) => {
+    e.preventDefault();
+    sessionStorage.setItem(tokenKey, document.getElementById("token").value);
+    document.getElementById("token").value = "";
+    setStatus("");
+    refresh();
+  });
+
+  signout.addEventListener("click", () => {
+    sessionStorage.removeItem(tokenKey);
+    showDashboard(false);
+    setStatus("Signed out");
+  });
+
+  document.getElementById("ban").addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const ip = document.getElementById("banIP").value.trim();
+    const body = {
+      ip: ip,
+      reason: document.getElementById("banReason").value.trim(),
+      duration: document.getElementById("banDuration").value.trim(),
+    };
+    if (await change(admin("/admin/bans", { method: "POST", body: body }), "Banned " + ip)) {
+      e.target.reset();
+    }
+  });
+
+  document.getElementById("official").addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const address = document.getElementById("officialAddress").value.trim();
+    if (await change(admin("/admin/official", { method: "POST", body: { address: address } }), "Added " + address)) {
+      e.target.reset();
+    }
+  });
+
+  if (sessionStorage.getItem(tokenKey)) {
+    refresh();
+  } else {
+    showDashboard(false);
+  }
+})();
@@ -0,0 +1,104 @@
+// Server browser: the filters map onto the /api/v1/servers parameters and
+// the list reloads when the event stream reports a change.
+"use strict";
+
+(function () {
+  const form = document.getElementById("filters");
+  const tbody = document.getElementById("servers");
+  const more = document.getElementById("more");
+  const typingDelay = 300;
+  const eventDelay = 2000; // changes often come in bursts
+  let cursor = "";
+  let shown = 0;
+  let generation = 0;
+  let reloadTimer = null;
+
+  function query() {
+    const params = new URLSearchParams({
+      sort: document.getElementById("sort").value,
+      order: document.getElementById("order").value,
+      limit: "100",
+    });
+    const q = document.getElementById("q").value.trim();
+    if (q) {
+      params.set("q", q);
+    }
+    for (const id of ["hasPlayers", "noPassword", "official"]) {
+      if (document.getElementById(id).checked) {
+        params.set(id, "true");
+      }
+    }
+    return params;
+  }
+
+  function row(server) {
+    const info = server.info || {};
+    const name = el("td", null, info.name || server.address);
+    if (server.official) {
+      name.append(el("span", { className: "badge", textContent: "Official" }));
+    }
+    if (info.password) {
+      name.append(el("span", { className: "badge muted", textContent: "Password" }));
+    }
+    const players = server.info ? info.players + " / " + info.maxPlayers : "-";
+    return el("tr", null,
+      name,
+      el("td", { textContent: info.gamemode || "" }),
+      el("td", { className: "num", textContent: players }),
+      el("td", { className: "addr", textContent: server.address }));
+  }
+
+  // load fetches the first page, or the next one if append is set
+  async function load(append) {
+    const params = query();
+    if (append && cursor) {
+      params.set("cursor", cursor);
+    }
+    const current = ++generation;
+    try {
+      const list = await fetchJSON("/api/v1/servers?" + params);
+      if (current !== generation) {
+        return; // the filters changed meanwhile
+      }
+      if (!append) {
+        tbody.replaceChildren();
+        shown = 0;
+      }
+      tbody.append(...list.servers.map(row));
+      shown += list.servers.length;
+      cursor = list.nextCursor || "";
+      more.hidden = !cursor;
+      setStatus(list.total === 1 ? "1 server" : list.total + " servers");
+    } catch (err) {
+      setStatus("Could not load the server list: " + err.message, true);
+    }
+  }
+
+  function reloadSoon(delay) {
+    clearTimeout(reloadTimer);
+    reloadTimer = setTimeout(() => load(false), delay);
+  }
+
+  form.addEventListener("input", () => reloadSoon(typingDelay));
+  form.addEventListener("change", () => load(false));
+  form.addEventListener("submit", (e) => {
+    e.preventDefault();
+    load(false);
+  });
+  more.addEventListener("click", () => load(true));
+
+  // Live updates while the event stream is enabled; only the first page
+  // is reloaded so a long list does not jump while being read
+  if (window.EventSource) {
+    const stream = new EventSource("/api/v1/events");
+    for (const type of ["server_added", "server_updated", "server_removed", "official_changed", "reset"]) {
+      stream.addEventListener(type, () => {
+        if (shown <= 100) {
+          reloadSoon(eventDelay);
+        }
+      });
+    }
+  }
+
+  load(false);
+})();
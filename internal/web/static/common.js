@@ -0,0 +1,47 @@
+// Helpers shared by the pages. Everything coming from the API is inserted
+// as text, never as HTML.
+"use strict";
+
+// el creates an element with the given properties and children
+function el(tag, props, ...children) {
+  const node = document.createElement(tag);
+  Object.assign(node, props || {});
+  for (const child of children) {
+    if (child !== null && child !== undefined) {
+      node.append(child);
+    }
+  }
+  return node;
+}
+
+// setStatus shows msg in the status line of the page
+function setStatus(msg, isError) {
+  const status = document.getElementById("status");
+  status.textContent = msg || "";
+  status.classList.toggle("error", Boolean(isError));
+}
+
+// fetchJSON requests url and returns the decoded body, throwing an error
+// with the status and response text for anything but 2xx. Validation
+// errors of the admin API come as {"errors": [...]}.
+async function fetchJSON(url, options) {
+  const res = await fetch(url, Object.assign({ cache: "no-store" }, options));
+  if (!res.ok) {
+    let text = (await res.text()).trim();
+    try {
+      text = JSON.parse(text).errors.join("; ");
+    } catch (e) {
+      // plain text
+    }
+    const err = new Error(text || res.status + " " + res.statusText);
+    err.status = res.status;
+    throw err;
+  }
+  return res.json();
+}
+
+// formatTime formats a Unix time or RFC 3339 string in the local time zone
+function formatTime(t) {
+  const date = typeof t === "number" ? new Date(t * 1000) : new Date(t);
+  return date.toLocaleString();
+}
@@ -0,0 +1,44 @@
+// Stats page: totals over the listed servers from /api/v1/stats.
+"use strict";
+
+(function () {
+  const refreshInterval = 30000;
+
+  function formatUptime(seconds) {
+    const days = Math.floor(seconds / 86400);
+    const hours = Math.floor((seconds % 86400) / 3600);
+    const minutes = Math.floor((seconds % 3600) / 60);
+    return days > 0 ? days + "d " + hours + "h" : hours + "h " + minutes + "m";
+  }
+
+  function total(label, value) {
+    return el("div", null, el("dt", { textContent: label }), el("dd", { textContent: String(value) }));
+  }
+
+  async function load() {
+    try {
+      const stats = await fetchJSON("/api/v1/stats");
+      document.getElementById("totals").replaceChildren(
+        total("Servers", stats.servers),
+        total("Players", stats.players),
+        total("Slots", stats.slots),
+        total("With players", stats.populated),
+        total("Official", stats.official),
+        total("Password protected", stats.passworded),
+        total("From peers", stats.mirrored),
+        total("Directory uptime", formatUptime(stats.uptime)),
+        total("Version", stats.version));
+      document.getElementById("gamemodes").replaceChildren(...stats.gamemodes.map((g) =>
+        el("tr", null,
+          el("td", { textContent: g.name }),
+          el("td", { className: "num", textContent: String(g.servers) }),
+          el("td", { className: "num", textContent: String(g.players) }))));
+      setStatus("Updated " + new Date().toLocaleTimeString());
+    } catch (err) {
+      setStatus("Could not load the stats: " + err.message, true);
+    }
+  }
+
+  load();
+  setInterval(load, refreshInterval);
+})();
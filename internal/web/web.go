@@ -0,0 +1,80 @@
+// Package web holds the embedded pages of the directory: the public server
+// browser, the stats page and the admin dashboard. The pages only load
+// scripts and styles from the directory itself and talk to the JSON API,
+// so they are served with a strict content security policy.
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// AssetPath is the prefix the scripts and styles are served under
+const AssetPath = "/ui/"
+
+// ContentSecurityPolicy allows the pages nothing but their own scripts,
+// styles and API requests
+const ContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+//go:embed static
+var static embed.FS
+
+// asset is an embedded file and its ETag
+type asset struct {
+	data []byte
+	etag string
+}
+
+// assets are the embedded files by name, read once at startup
+var assets = loadAssets()
+
+func loadAssets() map[string]asset {
+	loaded := make(map[string]asset)
+	entries, _ := fs.ReadDir(static, "static")
+	for _, e := range entries {
+		data, err := static.ReadFile("static/" + e.Name())
+		if err != nil || e.IsDir() {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		loaded[e.Name()] = asset{data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+	}
+	return loaded
+}
+
+// Serve writes the embedded file name, answering conditional requests with
+// 304 Not Modified. Browsers revalidate on every load so an upgrade never
+// mixes old scripts with new pages.
+func Serve(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a, ok := assets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", ContentSecurityPolicy)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", a.etag)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(a.data))
+}
+
+// ServeAsset serves the script or style named by the path of r below
+// AssetPath. Pages are only served at their own routes.
+func ServeAsset(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, AssetPath)
+	if name != path.Base(name) || path.Ext(name) == ".html" {
+		http.NotFound(w, r)
+		return
+	}
+	Serve(w, r, name)
+}
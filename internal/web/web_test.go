@@ -0,0 +1,80 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	w := httptest.NewRecorder()
+	Serve(w, httptest.NewRequest("GET", "/", nil), "index.html")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected the page, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Content-Security-Policy") != ContentSecurityPolicy {
+		t.Errorf("Expected the content security policy, got %q", w.Header().Get("Content-Security-Policy"))
+	}
+
+	// Unchanged files are revalidated without a body
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	Serve(w, req, "index.html")
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	Serve(w, httptest.NewRequest("POST", "/", nil), "index.html")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestServeAsset(t *testing.T) {
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/ui/browser.js", http.StatusOK},
+		{"/ui/style.css", http.StatusOK},
+		{"/ui/admin.html", http.StatusNotFound},
+		{"/ui/missing.js", http.StatusNotFound},
+		{"/ui/", http.StatusNotFound},
+		{"/ui/static/style.css", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		ServeAsset(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.code, w.Code)
+		}
+	}
+}
+
+// TestPagesSelfContained checks the pages only use what the content
+// security policy allows: no inline scripts, styles or event handlers
+func TestPagesSelfContained(t *testing.T) {
+	for name, a := range assets {
+		if !strings.HasSuffix(name, ".html") {
+			continue
+		}
+		page := string(a.data)
+		for _, banned := range []string{"<script>", "<style", " style=", " onclick=", " onsubmit=", "javascript:"} {
+			if strings.Contains(page, banned) {
+				t.Errorf("%s contains %q", name, banned)
+			}
+		}
+		for _, ref := range []string{`src="`, `rel="stylesheet" href="`} {
+			for rest := page; strings.Contains(rest, ref); {
+				_, rest, _ = strings.Cut(rest, ref)
+				target, _, _ := strings.Cut(rest, `"`)
+				if file, ok := strings.CutPrefix(target, AssetPath); !ok || assets[file].data == nil {
+					t.Errorf("%s refers to %s, which is not an embedded asset", name, target)
+				}
+			}
+		}
+	}
+}
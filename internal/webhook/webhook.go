@@ -0,0 +1,494 @@
+// Package webhook notifies configured URLs of directory events. Deliveries
+// are signed with HMAC-SHA256, retried with exponential backoff and kept
+// in a queue file so they survive restarts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"lusd/internal/config"
+	"lusd/internal/securefile"
+)
+
+// QueueFile holds undelivered events, in the state directory
+const QueueFile = "webhook-queue.json"
+
+// Request headers of a delivery
+const (
+	EventHeader     = "X-Lusd-Event"
+	DeliveryHeader  = "X-Lusd-Delivery"
+	TimestampHeader = "X-Lusd-Timestamp"
+	SignatureHeader = "X-Lusd-Signature"
+)
+
+// Delivery limits
+const (
+	queueVersion     = 1
+	queueFileMode    = 0600
+	maxQueueFileSize = 64 * 1024 * 1024 // 64MB
+	baseBackoff      = 10 * time.Second
+	maxBackoff       = 10 * time.Minute
+	persistInterval  = time.Second
+	maxAbuseKeys     = 10000
+	maxResponseSize  = 64 * 1024 // read and discarded so connections are reused
+	maxPending       = 1024      // events not yet queued for their targets
+)
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID    string          `json:"id"`
+	Event string          `json:"event"`
+	Time  int64           `json:"time"`
+	Node  string          `json:"node"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// AbuseData is the data of the abuse event
+type AbuseData struct {
+	IP     string `json:"ip"`
+	Kind   string `json:"kind"` // rejection reason, such as rate_limited or blacklisted
+	Count  int    `json:"count"`
+	Window int64  `json:"window"` // seconds
+}
+
+// delivery is an event waiting to be delivered to one target
+type delivery struct {
+	ID          string          `json:"id"`
+	Target      string          `json:"target"`
+	Event       string          `json:"event"`
+	Body        json.RawMessage `json:"body"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+}
+
+// queueFile is the format of QueueFile
+type queueFile struct {
+	Version    int         `json:"version"`
+	Deliveries []*delivery `json:"deliveries"`
+}
+
+// event is a notification not yet queued for its targets
+type event struct {
+	name string
+	time int64
+	data json.RawMessage
+}
+
+// abuseKey identifies the rejections counted together
+type abuseKey struct {
+	ip   netip.Addr
+	kind string
+}
+
+// abuseCount counts rejections within a window
+type abuseCount struct {
+	start time.Time
+	count int
+}
+
+// Dispatcher queues events and delivers them to the configured targets.
+// A nil Dispatcher ignores events.
+type Dispatcher struct {
+	getConfig func() config.Config
+	userAgent string
+	queuePath string
+	client    *http.Client
+	backoff   time.Duration // wait after the first failed attempt
+
+	mu      sync.Mutex
+	pending []event
+	queue   []*delivery // in event order, delivered in order per target
+	dirty   bool        // queue changed since it was last saved
+	wake    chan struct{}
+	abuse   map[abuseKey]*abuseCount
+}
+
+// New returns a dispatcher reading its targets through getConfig on every
+// event, so they follow config reloads. The queue is kept at queuePath;
+// an empty path keeps it in memory only.
+func New(getConfig func() config.Config, userAgent, queuePath string) *Dispatcher {
+	return &Dispatcher{
+		getConfig: getConfig,
+		userAgent: userAgent,
+		queuePath: queuePath,
+		client:    &http.Client{},
+		backoff:   baseBackoff,
+		wake:      make(chan struct{}, 1),
+		abuse:     make(map[abuseKey]*abuseCount),
+	}
+}
+
+// Sign returns the signature header value of body sent at timestamp: the
+// hex HMAC-SHA256 of "timestamp.body" under secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify sends name with data encoded as JSON to every target that wants
+// it. It never blocks and does not read the config, so it may be called
+// with the server list locked; Run queues the event for the targets.
+func (d *Dispatcher) Notify(name string, data any) {
+	if d == nil {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	if len(d.pending) < maxPending {
+		d.pending = append(d.pending, event{name: name, time: time.Now().Unix(), data: raw})
+	}
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queuePending queues the events passed to Notify for every target that
+// wants them. Events are dropped when the queue is full.
+func (d *Dispatcher) queuePending(cfg config.Config) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.pending {
+		id := newID()
+		body, err := json.Marshal(Payload{ID: id, Event: e.name, Time: e.time, Node: cfg.FederationNodeID, Data: e.data})
+		if err != nil {
+			continue
+		}
+		for _, target := range cfg.WebhookTargets {
+			if !target.Wants(e.name) {
+				continue
+			}
+			if len(d.queue) >= cfg.WebhookQueueSize {
+				slog.Warn("Webhook queue full, dropping event", "target", target.Name, "event", e.name)
+				continue
+			}
+			d.queue = append(d.queue, &delivery{ID: id, Target: target.Name, Event: e.name, Body: body})
+			d.dirty = true
+		}
+	}
+	d.pending = nil
+}
+
+// Abuse counts a rejection of ip for kind and sends an abuse event when
+// webhooks.abuseThreshold rejections happen within webhooks.abuseWindow.
+// The event is sent once per window.
+func (d *Dispatcher) Abuse(ip netip.Addr, kind string) {
+	if d == nil {
+		return
+	}
+	cfg := d.getConfig()
+	if len(cfg.WebhookTargets) == 0 {
+		return
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	key := abuseKey{ip: ip.Unmap(), kind: kind}
+	c, ok := d.abuse[key]
+	if !ok || now.Sub(c.start) >= cfg.WebhookAbuseWindow {
+		if !ok && len(d.abuse) >= maxAbuseKeys {
+			d.sweepAbuse(now, cfg.WebhookAbuseWindow)
+			if len(d.abuse) >= maxAbuseKeys {
+				d.mu.Unlock()
+				return
+			}
+		}
+		c = &abuseCount{start: now}
+		d.abuse[key] = c
+	}
+	c.count++
+	count := c.count
+	d.mu.Unlock()
+
+	if count == cfg.WebhookAbuseThreshold {
+		d.Notify(config.WebhookAbuse, AbuseData{
+			IP:     key.ip.String(),
+			Kind:   kind,
+			Count:  count,
+			Window: int64(cfg.WebhookAbuseWindow / time.Second),
+		})
+	}
+}
+
+// sweepAbuse forgets windows that have ended. Callers must hold the lock.
+func (d *Dispatcher) sweepAbuse(now time.Time, window time.Duration) {
+	for key, c := range d.abuse {
+		if now.Sub(c.start) >= window {
+			delete(d.abuse, key)
+		}
+	}
+}
+
+// Load restores the queue saved by an earlier run and returns the number
+// of deliveries restored. A missing file is not an error.
+func (d *Dispatcher) Load() (int, error) {
+	if d.queuePath == "" {
+		return 0, nil
+	}
+	if _, err := os.Stat(d.queuePath); os.IsNotExist(err) {
+		return 0, nil
+	}
+	data, err := securefile.Read(d.queuePath, maxQueueFileSize)
+	if err != nil {
+		return 0, err
+	}
+	var q queueFile
+	if err := json.Unmarshal(data, &q); err != nil {
+		return 0, fmt.Errorf("webhook queue parse error")
+	}
+	if q.Version != queueVersion {
+		return 0, fmt.Errorf("unsupported webhook queue version %d", q.Version)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, dl := range q.Deliveries {
+		if dl != nil && dl.Target != "" && json.Valid(dl.Body) {
+			d.queue = append(d.queue, dl)
+		}
+	}
+	return len(d.queue), nil
+}
+
+// Save writes the queue if it changed since it was last saved
+func (d *Dispatcher) Save() error {
+	d.mu.Lock()
+	if !d.dirty || d.queuePath == "" {
+		d.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(queueFile{Version: queueVersion, Deliveries: append([]*delivery{}, d.queue...)})
+	d.dirty = false
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := securefile.WriteAtomic(d.queuePath, data, queueFileMode); err != nil {
+		d.mu.Lock()
+		d.dirty = true
+		d.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Len returns the number of queued deliveries
+func (d *Dispatcher) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queue)
+}
+
+// Run delivers queued events until ctx is done, saving the queue as it
+// changes. Targets are delivered concurrently, the events of one target in
+// order: a failing target holds back its later events until it recovers
+// or the event runs out of attempts.
+func (d *Dispatcher) Run(ctx context.Context) {
+	save := time.NewTicker(persistInterval)
+	defer save.Stop()
+	for {
+		wait := time.Hour
+		if next, ok := d.deliverDue(ctx); ok {
+			wait = max(time.Until(next), 0)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-d.wake:
+		case <-timer.C:
+		case <-save.C:
+		}
+		timer.Stop()
+		if err := d.Save(); err != nil {
+			slog.Error("Error writing webhook queue", "error", err)
+		}
+	}
+}
+
+// deliverDue makes one attempt at the first delivery of every target that
+// is due, and returns when the next one is due, false if none is queued
+func (d *Dispatcher) deliverDue(ctx context.Context) (time.Time, bool) {
+	cfg := d.getConfig()
+	d.queuePending(cfg)
+	targets := make(map[string]config.WebhookTarget, len(cfg.WebhookTargets))
+	for _, t := range cfg.WebhookTargets {
+		targets[t.Name] = t
+	}
+	now := time.Now()
+
+	// The first delivery of every target, dropping those of removed targets
+	d.mu.Lock()
+	heads := make(map[string]*delivery)
+	kept := d.queue[:0]
+	for _, dl := range d.queue {
+		if _, ok := targets[dl.Target]; !ok {
+			slog.Warn("Dropping webhook event of a removed target", "target", dl.Target, "event", dl.Event, "delivery", dl.ID)
+			d.dirty = true
+			continue
+		}
+		kept = append(kept, dl)
+		if heads[dl.Target] == nil {
+			heads[dl.Target] = dl
+		}
+	}
+	clear(d.queue[len(kept):])
+	d.queue = kept
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var results sync.Map
+	for name, dl := range heads {
+		if dl.NextAttempt.After(now) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retryAfter, err := d.deliver(ctx, targets[name], dl, cfg.WebhookTimeout)
+			results.Store(dl, result{retryAfter, err})
+		}()
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	results.Range(func(k, v any) bool {
+		d.record(k.(*delivery), v.(result), cfg.WebhookMaxAttempts, ctx.Err() != nil)
+		return true
+	})
+
+	var next time.Time
+	seen := make(map[string]bool)
+	for _, dl := range d.queue {
+		if seen[dl.Target] {
+			continue
+		}
+		if len(seen) == 0 || dl.NextAttempt.Before(next) {
+			next = dl.NextAttempt
+		}
+		seen[dl.Target] = true
+	}
+	return next, len(seen) > 0
+}
+
+// result is the outcome of one delivery attempt
+type result struct {
+	retryAfter time.Duration // requested by the target, zero if none
+	err        error
+}
+
+// errPermanent marks responses that are not retried
+var errPermanent = errors.New("rejected by target")
+
+// record applies the outcome of an attempt to dl. Callers must hold the
+// lock.
+func (d *Dispatcher) record(dl *delivery, res result, maxAttempts int, canceled bool) {
+	switch {
+	case res.err == nil:
+		slog.Debug("Delivered webhook event", "target", dl.Target, "event", dl.Event, "delivery", dl.ID)
+	case canceled:
+		return // shutting down, not an attempt
+	case errors.Is(res.err, errPermanent):
+		slog.Warn("Webhook event rejected, dropping it", "target", dl.Target, "event", dl.Event, "delivery", dl.ID, "error", res.err)
+	case dl.Attempts+1 >= maxAttempts:
+		slog.Warn("Webhook event failed too often, dropping it", "target", dl.Target, "event", dl.Event, "delivery", dl.ID, "attempts", dl.Attempts+1, "error", res.err)
+	default:
+		dl.Attempts++
+		dl.NextAttempt = time.Now().Add(max(backoff(d.backoff, dl.Attempts), res.retryAfter))
+		d.dirty = true
+		slog.Info("Webhook delivery failed, retrying", "target", dl.Target, "event", dl.Event, "delivery", dl.ID, "attempt", dl.Attempts, "next_attempt", dl.NextAttempt, "error", res.err)
+		return
+	}
+	for i, queued := range d.queue {
+		if queued == dl {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			d.dirty = true
+			break
+		}
+	}
+}
+
+// backoff returns the wait after the given number of failed attempts,
+// doubling from base up to maxBackoff with up to 20% jitter
+func backoff(base time.Duration, attempts int) time.Duration {
+	wait := maxBackoff
+	if attempts < 16 {
+		wait = min(base<<(attempts-1), maxBackoff)
+	}
+	return wait + mathrand.N(wait/5+1)
+}
+
+// deliver posts dl to target once. A 2xx response is a success; other 4xx
+// responses than 408 and 429 are not retried.
+func (d *Dispatcher) deliver(ctx context.Context, target config.WebhookTarget, dl *delivery, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(dl.Body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", d.userAgent)
+	req.Header.Set(EventHeader, dl.Event)
+	req.Header.Set(DeliveryHeader, dl.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(target.Secret, timestamp, dl.Body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return 0, nil
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500:
+		return retryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("unexpected status %d", code)
+	default:
+		return 0, fmt.Errorf("%w: status %d", errPermanent, code)
+	}
+}
+
+// retryAfter parses a Retry-After header in seconds, capped at maxBackoff
+func retryAfter(v string) time.Duration {
+	seconds, err := strconv.Atoi(v)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxBackoff)
+}
+
+// newID returns a random delivery ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
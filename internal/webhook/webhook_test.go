@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"lusd/internal/config"
+)
+
+const testSecret = "webhook-secret-0123456789"
+
+// receiver is a local webhook target that checks signatures and answers
+// with the queued status codes, then 204
+type receiver struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	statuses []int
+	attempts int
+	got      chan Payload
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	rc := &receiver{t: t, statuses: statuses, got: make(chan Payload, 16)}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	return rc, srv
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	timestamp, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if r.Header.Get(SignatureHeader) != Sign(testSecret, timestamp, body) {
+		rc.t.Errorf("Invalid signature %q", r.Header.Get(SignatureHeader))
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.attempts++
+	if len(rc.statuses) > 0 {
+		status := rc.statuses[0]
+		rc.statuses = rc.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil || p.Event != r.Header.Get(EventHeader) || p.ID != r.Header.Get(DeliveryHeader) {
+		rc.t.Errorf("Unexpected delivery %s: %v", body, err)
+	}
+	rc.got <- p
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// count returns the number of requests received
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.attempts
+}
+
+// waitDrained waits until d has no queued deliveries
+func waitDrained(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); d.Len() > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the queue to drain, %d left", d.Len())
+		}
+	}
+}
+
+// wait returns the next delivered payload
+func (rc *receiver) wait() Payload {
+	rc.t.Helper()
+	select {
+	case p := <-rc.got:
+		return p
+	case <-time.After(5 * time.Second):
+		rc.t.Fatal("Expected a delivery")
+		return Payload{}
+	}
+}
+
+func testConfig(targets ...config.WebhookTarget) config.Config {
+	return config.Config{
+		FederationNodeID:      "test",
+		WebhookTargets:        targets,
+		WebhookMaxAttempts:    3,
+		WebhookTimeout:        time.Second,
+		WebhookQueueSize:      100,
+		WebhookAbuseThreshold: 3,
+		WebhookAbuseWindow:    time.Minute,
+	}
+}
+
+// startDispatcher runs a dispatcher with a short backoff until the test ends
+func startDispatcher(t *testing.T, cfg config.Config, queuePath string) (*Dispatcher, context.CancelFunc) {
+	d := New(func() config.Config { return cfg }, "lusd/test", queuePath)
+	d.backoff = 10 * time.Millisecond
+	if _, err := d.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return d, stop
+}
+
+func TestDeliverSigned(t *testing.T) {
+	all, allSrv := newReceiver(t)
+	abuse, abuseSrv := newReceiver(t)
+	cfg := testConfig(
+		config.WebhookTarget{Name: "all", URL: allSrv.URL, Secret: testSecret},
+		config.WebhookTarget{Name: "abuse", URL: abuseSrv.URL, Secret: testSecret, Events: []string{config.WebhookAbuse}},
+	)
+	d, _ := startDispatcher(t, cfg, "")
+
+	d.Notify(config.WebhookServerRegistered, map[string]string{"address": "192.0.2.1:2301"})
+	if p := all.wait(); p.Event != config.WebhookServerRegistered || p.Node != "test" || string(p.Data) != `{"address":"192.0.2.1:2301"}` {
+		t.Errorf("Unexpected payload %+v", p)
+	}
+
+	// Abuse is reported once the threshold is reached within the window
+	ip := netip.MustParseAddr("198.51.100.7")
+	for i := 0; i < 5; i++ {
+		d.Abuse(ip, "rate_limited")
+	}
+	var data AbuseData
+	if p := abuse.wait(); json.Unmarshal(p.Data, &data) != nil || data.IP != "198.51.100.7" || data.Count != 3 || data.Window != 60 {
+		t.Errorf("Unexpected abuse payload %+v", p)
+	}
+	all.wait()
+
+	time.Sleep(50 * time.Millisecond)
+	if abuse.count() != 1 || all.count() != 2 {
+		t.Errorf("Expected one abuse event per window, got %d and %d deliveries", abuse.count(), all.count())
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	rc, srv := newReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	cfg := testConfig(config.WebhookTarget{Name: "hooks", URL: srv.URL, Secret: testSecret})
+	d, _ := startDispatcher(t, cfg, "")
+
+	// Events of a target stay in order while the first one is retried
+	d.Notify("first", 1)
+	d.Notify("second", 2)
+	if first, second := rc.wait(), rc.wait(); first.Event != "first" || second.Event != "second" {
+		t.Errorf("Expected the events in order, got %s and %s", first.Event, second.Event)
+	}
+	if rc.count() != 4 {
+		t.Errorf("Expected 4 attempts, got %d", rc.count())
+	}
+
+	// Rejected events and those out of attempts are dropped
+	rc.mu.Lock()
+	rc.statuses = []int{http.StatusBadRequest, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+	rc.mu.Unlock()
+	d.Notify("rejected", 3)
+	d.Notify("failing", 4)
+	d.Notify("third", 5)
+	if p := rc.wait(); p.Event != "third" {
+		t.Errorf("Expected only the third event, got %s", p.Event)
+	}
+	waitDrained(t, d)
+}
+
+func TestQueuePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), QueueFile)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	// Events for a target that is down are saved on shutdown
+	cfg := testConfig(config.WebhookTarget{Name: "hooks", URL: down.URL, Secret: testSecret})
+	cfg.WebhookMaxAttempts = 100
+	d, stop := startDispatcher(t, cfg, path)
+	d.Notify(config.WebhookOfficialUnreachable, map[string]string{"address": "192.0.2.1:2301"})
+	for deadline := time.Now().Add(5 * time.Second); d.Len() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the event to be queued")
+		}
+	}
+	stop()
+	if err := d.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// The next run delivers them once the target is back
+	rc, srv := newReceiver(t)
+	cfg.WebhookTargets[0].URL = srv.URL
+	restarted, _ := startDispatcher(t, cfg, path)
+	if p := rc.wait(); p.Event != config.WebhookOfficialUnreachable {
+		t.Errorf("Expected the saved event, got %+v", p)
+	}
+	waitDrained(t, restarted)
+}
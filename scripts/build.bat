@@ -25,17 +25,17 @@ REM Build for different platforms
 echo Building for Linux amd64...
 set GOOS=linux
 set GOARCH=amd64
-go build -ldflags="%LDFLAGS%" -o build/%APP_NAME%-linux-amd64 cmd/lusd/main.go
+go build -ldflags="%LDFLAGS%" -o build/%APP_NAME%-linux-amd64 ./cmd/lusd
 
 echo Building for Windows amd64...
 set GOOS=windows
 set GOARCH=amd64
-go build -ldflags="%LDFLAGS%" -o build/%APP_NAME%-windows-amd64.exe cmd/lusd/main.go
+go build -ldflags="%LDFLAGS%" -o build/%APP_NAME%-windows-amd64.exe ./cmd/lusd
 
 echo Building for macOS amd64...
 set GOOS=darwin
 set GOARCH=amd64
-go build -ldflags="%LDFLAGS%" -o build/%APP_NAME%-darwin-amd64 cmd/lusd/main.go
+go build -ldflags="%LDFLAGS%" -o build/%APP_NAME%-darwin-amd64 ./cmd/lusd
 
 echo Build completed successfully!
 echo Binaries available in build/ directory:
@@ -25,19 +25,19 @@ LDFLAGS="$LDFLAGS -X main.CommitHash=$COMMIT_HASH"
 
 # Build for different platforms
 echo "Building for Linux amd64..."
-GOOS=linux GOARCH=amd64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-linux-amd64 cmd/lusd/main.go
+GOOS=linux GOARCH=amd64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-linux-amd64 ./cmd/lusd
 
 echo "Building for Linux arm64..."
-GOOS=linux GOARCH=arm64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-linux-arm64 cmd/lusd/main.go
+GOOS=linux GOARCH=arm64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-linux-arm64 ./cmd/lusd
 
 echo "Building for Windows amd64..."
-GOOS=windows GOARCH=amd64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-windows-amd64.exe cmd/lusd/main.go
+GOOS=windows GOARCH=amd64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-windows-amd64.exe ./cmd/lusd
 
 echo "Building for macOS amd64..."
-GOOS=darwin GOARCH=amd64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-darwin-amd64 cmd/lusd/main.go
+GOOS=darwin GOARCH=amd64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-darwin-amd64 ./cmd/lusd
 
 echo "Building for macOS arm64..."
-GOOS=darwin GOARCH=arm64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-darwin-arm64 cmd/lusd/main.go
+GOOS=darwin GOARCH=arm64 go build -ldflags="$LDFLAGS" -o build/${APP_NAME}-darwin-arm64 ./cmd/lusd
 
 # Make Linux/macOS binaries executable
 chmod +x build/${APP_NAME}-linux-* build/${APP_NAME}-darwin-*
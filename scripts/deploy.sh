@@ -57,9 +57,6 @@ ssh $SERVER_USER@$SERVER_HOST << 'EOF'
     sudo chmod +x /opt/lusd/lusd
     sudo chmod 644 /etc/lusd/config.json
     
-    # Link config
-    sudo ln -sf /etc/lusd/config.json /opt/lusd/config.json
-    
     # Reload systemd and start service
     sudo systemctl daemon-reload
     sudo systemctl enable lusd-server